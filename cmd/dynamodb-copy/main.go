@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/goccha/dynamodb-verse/pkg/batches"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+var (
+	version  = "v0.0.0"
+	revision = "0000000"
+)
+
+func main() {
+	var ver bool
+	var srcTable, dstTable, checkpoint string
+	var segments int
+	src := foundations.OptionBuilder{}
+	flag.StringVar(&src.Region, "src-region", "", "AWS Region of the source table")
+	flag.StringVar(&src.Endpoint, "src-endpoint", "", "AWS DynamoDB Endpoint of the source table")
+	flag.StringVar(&src.Profile, "src-profile", "", "AWS Profile of the source table")
+	flag.BoolVar(&src.Local, "src-local", false, "source is dynamodb-local")
+	dst := foundations.OptionBuilder{}
+	flag.StringVar(&dst.Region, "dst-region", "", "AWS Region of the destination table")
+	flag.StringVar(&dst.Endpoint, "dst-endpoint", "", "AWS DynamoDB Endpoint of the destination table")
+	flag.StringVar(&dst.Profile, "dst-profile", "", "AWS Profile of the destination table")
+	flag.BoolVar(&dst.Local, "dst-local", false, "destination is dynamodb-local")
+	var debug bool
+	flag.BoolVar(&debug, "debug", false, "debug mode")
+
+	flag.StringVar(&srcTable, "src-table", "", "source table name")
+	flag.StringVar(&dstTable, "dst-table", "", "destination table name (default: src-table)")
+	flag.IntVar(&segments, "segments", int(foundations.DefaultScanSegments), "number of parallel scan segments")
+	flag.StringVar(&checkpoint, "checkpoint", "", "file to save the progress and resume from (default: <src-table>.checkpoint.json)")
+	flag.BoolVar(&ver, "version", false, "show version")
+	flag.Parse()
+
+	if ver {
+		fmt.Printf("%s\n", Version())
+		return
+	}
+	if srcTable == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if dstTable == "" {
+		dstTable = srcTable
+	}
+	if checkpoint == "" {
+		checkpoint = srcTable + ".checkpoint.json"
+	}
+	src.Debug, dst.Debug = debug, debug
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	srcCli, err := foundations.Setup(ctx, src.Build(ctx)...)
+	if err != nil {
+		panic(err)
+	}
+	dstCli, err := foundations.Setup(ctx, dst.Build(ctx)...)
+	if err != nil {
+		panic(err)
+	}
+	p, err := batches.Copy(ctx, srcCli, srcTable, dstCli, dstTable,
+		batches.CopySegments(int32(segments)), batches.CopyCheckpoint(checkpoint))
+	fmt.Printf("scanned=%d written=%d\n", p.Scanned, p.Written)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "copy stopped, run again to resume from %s: %v\n", checkpoint, err)
+		os.Exit(1)
+	}
+}
+
+func Version() string {
+	return fmt.Sprintf("%s-%s", strings.ReplaceAll(version, "/", "_"), revision)
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"github.com/goccha/dynamodb-verse/pkg/emulator"
 	"github.com/goccha/dynamodb-verse/pkg/foundations"
 	"github.com/goccha/dynamodb-verse/pkg/migrate"
 	"github.com/goccha/envar"
@@ -19,6 +23,8 @@ var (
 func main() {
 	var ver bool
 	var dirPath string
+	var emulate bool
+	var emulatorFile, emulatorAddr string
 	options := foundations.OptionBuilder{}
 	flag.StringVar(&options.Region, "region", "", "AWS Region")
 	flag.StringVar(&options.Endpoint, "endpoint", "", "AWS DynamoDB Endpoint")
@@ -26,6 +32,10 @@ func main() {
 	flag.BoolVar(&options.Local, "local", true, "for dynamodb-local")
 	flag.BoolVar(&options.Debug, "debug", false, "debug mode")
 
+	flag.BoolVar(&emulate, "emulator", false, "run against an in-process DynamoDB emulator")
+	flag.StringVar(&emulatorFile, "emulator-file", "", "file to load and save the emulator tables")
+	flag.StringVar(&emulatorAddr, "emulator-addr", "", "keep serving the emulator on this address after migration")
+
 	flag.StringVar(&dirPath, "path", "", "Directory path for configuration files")
 	flag.BoolVar(&ver, "version", false, "show version")
 	flag.Parse()
@@ -35,7 +45,14 @@ func main() {
 		return
 	}
 	ctx := context.Background()
-	cli, err := foundations.Setup(ctx, options.Build(ctx)...)
+	opts := options.Build(ctx)
+	var stop func() error
+	if emulate || emulatorFile != "" || emulatorAddr != "" {
+		var endpoint string
+		endpoint, stop, opts = startEmulator(ctx, emulatorFile, emulatorAddr)
+		fmt.Printf("emulator=%s\n", endpoint)
+	}
+	cli, err := foundations.Setup(ctx, opts...)
 	if err != nil {
 		panic(err)
 	}
@@ -45,6 +62,33 @@ func main() {
 	if err = migrate.New(cli, dirPath).Run(ctx, migrate.SaveRecord); err != nil {
 		panic(err)
 	}
+	if stop != nil {
+		if emulatorAddr != "" {
+			sigCtx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			<-sigCtx.Done()
+			cancel()
+		}
+		if err = stop(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func startEmulator(ctx context.Context, file, addr string) (endpoint string, stop func() error, opts []foundations.ConfigOption) {
+	s, err := emulator.NewServer(ctx, emulator.WithFile(file))
+	if err != nil {
+		panic(err)
+	}
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	if endpoint, stop, err = s.Listen(ctx, addr); err != nil {
+		panic(err)
+	}
+	if opts, err = emulator.ConfigOptions(ctx, endpoint); err != nil {
+		panic(err)
+	}
+	return endpoint, stop, opts
 }
 
 func Version() string {
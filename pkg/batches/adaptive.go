@@ -0,0 +1,162 @@
+package batches
+
+import (
+	"context"
+	"sync"
+
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+type adaptive struct {
+	min       int
+	max       int
+	threshold float64
+	factor    float64
+	onChange  func(concurrency int)
+	options   []Option
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+type AdaptiveOption func(a *adaptive)
+
+// BuilderOptions Applies opt to the Builder of the processor, e.g. MaxRetry and RetryPolicy.
+func BuilderOptions(opt ...Option) AdaptiveOption {
+	return func(a *adaptive) {
+		a.options = append(a.options, opt...)
+	}
+}
+
+// UnprocessedThreshold Decreases the concurrency when the ratio of the unprocessed items of a request exceeds ratio. The default is 0.1.
+func UnprocessedThreshold(ratio float64) AdaptiveOption {
+	return func(a *adaptive) {
+		a.threshold = ratio
+	}
+}
+
+// DecreaseFactor Multiplies the concurrency by factor when it is decreased. The default is 0.5.
+func DecreaseFactor(factor float64) AdaptiveOption {
+	return func(a *adaptive) {
+		if factor > 0 && factor < 1 {
+			a.factor = factor
+		}
+	}
+}
+
+// OnConcurrency Calls f with the number of the concurrent workers whenever it changes.
+func OnConcurrency(f func(concurrency int)) AdaptiveOption {
+	return func(a *adaptive) {
+		a.onChange = f
+	}
+}
+
+// NewAdaptiveProcessor Returns a processor that runs BatchWriteItem with minSize to maxSize concurrent workers.
+// The concurrency is increased by one after every request that processed all items and decreased by
+// DecreaseFactor after a throttled request or a request that left more unprocessed items than UnprocessedThreshold (AIMD).
+func NewAdaptiveProcessor(minSize, maxSize int, opt ...AdaptiveOption) BatchProcessor {
+	if minSize < 1 {
+		minSize = 1
+	}
+	if maxSize < minSize {
+		maxSize = minSize
+	}
+	a := &adaptive{
+		min:       minSize,
+		max:       maxSize,
+		threshold: 0.1,
+		factor:    0.5,
+		limit:     minSize,
+	}
+	a.cond = sync.NewCond(&a.mu)
+	for _, o := range opt {
+		o(a)
+	}
+	b := New(a.options...)
+	b.option.observe = a.observe
+	return &MultiProcessor{
+		b:        []*Builder{b},
+		counter:  -1,
+		adaptive: a,
+	}
+}
+
+// observe リクエストの結果から同時実行数を増減する
+func (a *adaptive) observe(sent, unprocessed int, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	limit := a.limit
+	switch {
+	case err != nil:
+		if !errors.Is(foundations.Classify("", err), foundations.ErrThrottled) {
+			return
+		}
+		limit = int(float64(limit) * a.factor)
+	case sent > 0 && float64(unprocessed)/float64(sent) > a.threshold:
+		limit = int(float64(limit) * a.factor)
+	case unprocessed == 0:
+		limit++
+	}
+	limit = max(a.min, min(a.max, limit))
+	if limit == a.limit {
+		return
+	}
+	a.limit = limit
+	a.cond.Broadcast()
+	if a.onChange != nil {
+		a.onChange(limit)
+	}
+}
+
+// acquire 同時実行数に空きができるまで待つ
+func (a *adaptive) acquire(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.cond.Broadcast()
+	})
+	defer stop()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for a.active >= a.limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		a.cond.Wait()
+	}
+	a.active++
+	return nil
+}
+
+func (a *adaptive) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.active--
+	a.cond.Broadcast()
+}
+
+func (p *MultiProcessor) runAdaptive(ctx context.Context, cli WriteClient, opt ...options.Option) error {
+	b := p.b[0]
+	if b.err != nil {
+		return b.err
+	}
+	eg, gctx := errgroup.WithContext(ctx)
+	for _, v := range b.items {
+		if err := p.adaptive.acquire(gctx); err != nil {
+			break
+		}
+		eg.Go(func() error {
+			defer p.adaptive.release()
+			return b.runItem(gctx, cli, v, opt...)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,71 @@
+package batches
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+func TestAdaptiveProcessor(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	ctx, cli, repo := setupUsers(t, dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		if operation != "BatchWriteItem" {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 20 {
+			return &types.ProvisionedThroughputExceededException{Message: aws.String("throttled")}
+		}
+		return nil
+	}))
+	var reported []int
+	p := NewAdaptiveProcessor(1, 4,
+		BuilderOptions(RetryPolicy(&foundations.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})),
+		OnConcurrency(func(concurrency int) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, concurrency)
+		}),
+	)
+	for i := 0; i < 1000; i++ {
+		p.Put(PutItems(repo.PutItem(ctx, &User{ID: fmt.Sprintf("u%04d", i), Name: "name"}))...)
+	}
+	if err := p.Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	top := -1
+	for i, v := range reported {
+		if v == 4 {
+			top = i
+			break
+		}
+	}
+	if top < 0 {
+		t.Fatalf("expected the concurrency to grow to 4, got %v", reported)
+	}
+	decreased := false
+	for _, v := range reported[top:] {
+		decreased = decreased || v < 4
+	}
+	if !decreased {
+		t.Fatalf("expected the concurrency to decrease after throttling, got %v", reported)
+	}
+	list, err := repo.Scan(ctx, cli, expression.ConditionBuilder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1000 {
+		t.Fatalf("expected 1000 users, got %d", len(list))
+	}
+}
@@ -3,7 +3,6 @@ package batches
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -36,13 +35,49 @@ func (builder *Batch[T]) HasError() bool {
 	return builder.err != nil
 }
 
+// dedupe DuplicatePolicyに従って同じキーのエンティティをまとめる
+func (builder *Batch[T]) dedupe(keyOf func(v T) (map[string]types.AttributeValue, error)) ([]T, error) {
+	if builder.option.duplicates == KeepDuplicates {
+		return builder.entities, nil
+	}
+	kept, err := dedupe(&builder.option, len(builder.entities), func(i int) (string, map[string]types.AttributeValue, error) {
+		item, err := keyOf(builder.entities[i])
+		return builder.tableName, item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]T, 0, len(kept))
+	for _, i := range kept {
+		entities = append(entities, builder.entities[i])
+	}
+	return entities, nil
+}
+
+func marshalItem[T any](v T) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMap(v)
+}
+
+// marshalKey キースキーマが分かればキー属性だけを返す
+func marshalKey[T any](opt *batchOption, tableName string, v T) (map[string]types.AttributeValue, error) {
+	av, err := attributevalue.MarshalMap(v)
+	if err != nil {
+		return nil, err
+	}
+	return opt.keyOrItem(tableName, av)
+}
+
 func (builder *Batch[T]) Put(ctx context.Context, cli WriteClient) error {
-	for i := 0; i < len(builder.entities); i += MaxWriteItems {
+	entities, err := builder.dedupe(marshalItem[T])
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(entities); i += MaxWriteItems {
 		end := i + MaxWriteItems
-		if end > len(builder.entities) {
-			end = len(builder.entities)
+		if end > len(entities) {
+			end = len(entities)
 		}
-		if err := batchWrite(ctx, cli, builder.tableName, builder.entities[i:end], builder.option); err != nil {
+		if err := builder.option.handleFailure(ctx, batchWrite(ctx, cli, builder.tableName, entities[i:end], builder.option)); err != nil {
 			return err
 		}
 	}
@@ -68,27 +103,32 @@ func batchWrite[T any](ctx context.Context, cli WriteClient, tableName string, e
 	b := backoff.New(opt.maxInterval, opt.interval)
 	i := 0
 	for ; len(items) > 0 && i < opt.maxRetry; i++ {
+		if i > 0 {
+			if err = wait(ctx, b.Duration()); err != nil {
+				return newBatchError(map[string][]types.WriteRequest{tableName: items}, err)
+			}
+		}
 		var out *dynamodb.BatchWriteItemOutput
-		out, err = cli.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]types.WriteRequest{
-				tableName: items,
-			},
+		err = opt.retryPolicy(ctx).Do(ctx, func(ctx context.Context) (err error) {
+			out, err = cli.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{
+					tableName: items,
+				},
+			})
+			return err
 		})
 		if err != nil {
-			return fmt.Errorf("batch write to %s: %w", tableName, err)
+			return newBatchError(map[string][]types.WriteRequest{tableName: items}, fmt.Errorf("batch write to %s: %w", tableName, foundations.Classify(tableName, err)))
 		}
 		if len(out.UnprocessedItems[tableName]) > 0 {
 			items = append(items[:0], out.UnprocessedItems[tableName]...) // スライスを初期化して未処理のitemsがあれば追加
-			if len(items) > 0 {
-				<-time.After(b.Duration())
-			}
 		} else {
 			break
 		}
 	}
 	b.Reset()
 	if i >= opt.maxRetry {
-		return fmt.Errorf("batch write to %s exceeded max retry limit", tableName)
+		return newBatchError(map[string][]types.WriteRequest{tableName: items}, retryExceeded(tableName, fmt.Errorf("batch write to %s exceeded max retry limit", tableName)))
 	}
 	return nil
 }
@@ -96,16 +136,24 @@ func batchWrite[T any](ctx context.Context, cli WriteClient, tableName string, e
 type DeleteKeyFunc[T any] func(v T) map[string]types.AttributeValue
 
 func (builder *Batch[T]) Delete(ctx context.Context, cli WriteClient, f ...DeleteKeyFunc[T]) error {
-	for i := 0; i < len(builder.entities); i += MaxWriteItems {
-		end := i + MaxWriteItems
-		if end > len(builder.entities) {
-			end = len(builder.entities)
+	var getDeleteKey DeleteKeyFunc[T]
+	keyOf := marshalItem[T]
+	if len(f) > 0 {
+		getDeleteKey = f[0]
+		keyOf = func(v T) (map[string]types.AttributeValue, error) {
+			return getDeleteKey(v), nil
 		}
-		var getDeleteKey DeleteKeyFunc[T]
-		if len(f) > 0 {
-			getDeleteKey = f[0]
+	}
+	entities, err := builder.dedupe(keyOf)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(entities); i += MaxWriteItems {
+		end := i + MaxWriteItems
+		if end > len(entities) {
+			end = len(entities)
 		}
-		if err := batchDelete(ctx, cli, builder.tableName, builder.entities[i:end], getDeleteKey, builder.option); err != nil {
+		if err := builder.option.handleFailure(ctx, batchDelete(ctx, cli, builder.tableName, entities[i:end], getDeleteKey, builder.option)); err != nil {
 			return err
 		}
 	}
@@ -121,10 +169,8 @@ func batchDelete[T any](ctx context.Context, cli WriteClient, tableName string,
 		var av map[string]types.AttributeValue
 		if getDeleteKey != nil {
 			av = getDeleteKey(v)
-		} else {
-			if av, err = attributevalue.MarshalMap(v); err != nil {
-				return
-			}
+		} else if av, err = marshalKey(&opt, tableName, v); err != nil {
+			return
 		}
 		items = append(items, types.WriteRequest{
 			DeleteRequest: &types.DeleteRequest{
@@ -135,38 +181,47 @@ func batchDelete[T any](ctx context.Context, cli WriteClient, tableName string,
 	b := backoff.New(opt.maxInterval, opt.interval)
 	i := 0
 	for ; len(items) > 0 && i < opt.maxRetry; i++ {
+		if i > 0 {
+			if err = wait(ctx, b.Duration()); err != nil {
+				return newBatchError(map[string][]types.WriteRequest{tableName: items}, err)
+			}
+		}
 		var out *dynamodb.BatchWriteItemOutput
-		out, err = cli.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]types.WriteRequest{
-				tableName: items,
-			},
+		err = opt.retryPolicy(ctx).Do(ctx, func(ctx context.Context) (err error) {
+			out, err = cli.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{
+					tableName: items,
+				},
+			})
+			return err
 		})
 		if err != nil {
-			return fmt.Errorf("batch delete to %s: %w", tableName, err)
+			return newBatchError(map[string][]types.WriteRequest{tableName: items}, fmt.Errorf("batch delete to %s: %w", tableName, foundations.Classify(tableName, err)))
 		}
 		if len(out.UnprocessedItems[tableName]) > 0 {
 			items = append(items[:0], out.UnprocessedItems[tableName]...) // スライスを初期化して未処理のitemsがあれば追加
-			if len(items) > 0 {
-				<-time.After(b.Duration())
-			}
 		} else {
 			break
 		}
 	}
 	b.Reset()
 	if i >= opt.maxRetry {
-		return fmt.Errorf("batch write to %s exceeded max retry limit", tableName)
+		return newBatchError(map[string][]types.WriteRequest{tableName: items}, retryExceeded(tableName, fmt.Errorf("batch write to %s exceeded max retry limit", tableName)))
 	}
 	return nil
 }
 
 func (builder *Batch[T]) Get(ctx context.Context, cli GetClient, fetch foundations.FetchItemFunc) (err error) {
-	for i := 0; i < len(builder.entities); i += MaxGetItems {
+	entities, err := builder.dedupe(marshalItem[T])
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(entities); i += MaxGetItems {
 		end := i + MaxGetItems
-		if end > len(builder.entities) {
-			end = len(builder.entities)
+		if end > len(entities) {
+			end = len(entities)
 		}
-		if err = batchGet(ctx, cli, builder.tableName, builder.entities[i:end], fetch, builder.option); err != nil {
+		if err = batchGet(ctx, cli, builder.tableName, entities[i:end], fetch, builder.option); err != nil {
 			return err
 		}
 	}
@@ -180,7 +235,7 @@ func batchGet[T any](ctx context.Context, cli GetClient, tableName string, entit
 	attrs := make([]map[string]types.AttributeValue, 0, len(entities))
 	var av map[string]types.AttributeValue
 	for _, v := range entities {
-		if av, err = attributevalue.MarshalMap(v); err != nil {
+		if av, err = marshalKey(&opt, tableName, v); err != nil {
 			return
 		}
 		attrs = append(attrs, av)
@@ -189,15 +244,25 @@ func batchGet[T any](ctx context.Context, cli GetClient, tableName string, entit
 	keys[tableName] = types.KeysAndAttributes{
 		Keys: attrs,
 	}
+	if keys, err = opt.requestItems(keys); err != nil {
+		return
+	}
 	b := backoff.New(opt.maxInterval, opt.interval)
-	i := 0
-	for ; len(keys) > 0 && i < opt.maxRetry; i++ {
+	for i := 0; len(keys) > 0 && i < opt.maxRetry; i++ {
+		if i > 0 {
+			if err = wait(ctx, b.Duration()); err != nil {
+				return err
+			}
+		}
 		var out *dynamodb.BatchGetItemOutput
-		out, err = cli.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
-			RequestItems: keys,
+		err = opt.retryPolicy(ctx).Do(ctx, func(ctx context.Context) (err error) {
+			out, err = cli.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: keys,
+			})
+			return err
 		})
 		if err != nil {
-			return errors.WithStack(err)
+			return errors.WithStack(foundations.Classify(tableName, err))
 		}
 		for table, values := range out.Responses {
 			for _, v := range values {
@@ -207,13 +272,15 @@ func batchGet[T any](ctx context.Context, cli GetClient, tableName string, entit
 			}
 		}
 		keys = out.UnprocessedKeys
-		if len(keys) > 0 {
-			<-time.After(b.Duration())
-		}
 	}
 	b.Reset()
-	if i >= opt.maxRetry {
-		return fmt.Errorf("batch get to %s exceeded max retry limit", tableName)
+	if len(keys) > 0 {
+		return retryExceeded(tableName, fmt.Errorf("batch get to %s exceeded max retry limit", tableName))
 	}
 	return nil
 }
+
+// retryExceeded 未処理のアイテムが残ったのはスロットリングによるものとして扱う
+func retryExceeded(tableName string, err error) error {
+	return &foundations.Error{Kind: foundations.ErrThrottled, Table: tableName, Err: err}
+}
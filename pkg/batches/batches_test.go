@@ -0,0 +1,75 @@
+package batches
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+func TestBatchKeys(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("members"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	users := make([]User, 0, 30)
+	for i := 0; i < 30; i++ {
+		users = append(users, User{ID: fmt.Sprintf("m%02d", i), Name: "name"})
+	}
+	if err := NewBatch("members", users).Put(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	fetch := func(count *int) foundations.FetchItemFunc {
+		return func(tableName string, value foundations.Record) error {
+			*count++
+			return nil
+		}
+	}
+	// キースキーマが無ければエンティティ全体がキーになる
+	if err := NewBatch("members", users).Get(ctx, cli, fetch(new(int))); err == nil {
+		t.Fatal("expected an error for the non-key attributes")
+	}
+	// DBごとのレジストリに登録し、グローバルなレジストリは変更しない
+	db := foundations.NewDB(cli, foundations.Keys(foundations.NewKeyRegistry()))
+	if err := foundations.RegisterKeys[User](db.KeyRegistry(), "members"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := foundations.DefaultKeyRegistry.Lookup("members"); ok {
+		t.Fatal("expected the default registry not to be changed")
+	}
+	keys := KeyRegistry(db.KeyRegistry())
+	count := 0
+	if err := NewBatch("members", users, keys).Get(ctx, cli, fetch(&count)); err != nil {
+		t.Fatal(err)
+	}
+	if count != 30 {
+		t.Fatalf("expected 30 items, got %d", count)
+	}
+	if err := NewBatch("members", users[:10], keys).Delete(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	if err := Truncate[User](ctx, cli, func() (string, expression.Expression, error) {
+		return "members", expression.Expression{}, nil
+	}, nil, keys); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cli.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("members")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Count != 0 {
+		t.Fatalf("expected no items, got %d", out.Count)
+	}
+}
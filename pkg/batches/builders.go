@@ -2,7 +2,6 @@ package batches
 
 import (
 	"context"
-	"time"
 
 	"github.com/cloudflare/backoff"
 
@@ -19,19 +18,20 @@ const (
 
 type WriteItemFunc func() (table string, item map[string]types.AttributeValue, err error)
 
-func PutItems(items ...foundations.WriteItemFunc) []WriteItemFunc {
+// PutItems Converts items for BatchWriteItem, which drops their condition expressions. ConditionalWriter keeps them.
+func PutItems(items ...foundations.WriteItem) []WriteItemFunc {
 	res := make([]WriteItemFunc, 0, len(items))
 	for _, v := range items {
 		f := v
 		res = append(res, func() (table string, item map[string]types.AttributeValue, err error) {
-			table, item, _, err = f()
+			table, item, _, _, err = f.WriteItem()
 			return
 		})
 	}
 	return res
 }
 
-func DeleteItems(items ...foundations.WriteItemFunc) []WriteItemFunc {
+func DeleteItems(items ...foundations.WriteItem) []WriteItemFunc {
 	return PutItems(items...)
 }
 
@@ -68,9 +68,13 @@ func (bi *writeItem) add(table string, req types.WriteRequest) (item *writeItem,
 }
 func (bi *writeItem) run(ctx context.Context, cli WriteClient, opt ...options.Option) (err error) {
 	b := backoff.New(bi.option.maxInterval, bi.option.interval)
-	i := 0
 	body := bi.items
-	for ; len(body) > 0 && i < bi.option.maxRetry; i++ {
+	for i := 0; len(body) > 0 && i < bi.option.maxRetry; i++ {
+		if i > 0 {
+			if err = wait(ctx, b.Duration()); err != nil {
+				return errors.WithStack(newBatchError(body, err))
+			}
+		}
 		var out *dynamodb.BatchWriteItemOutput
 		input := &dynamodb.BatchWriteItemInput{
 			RequestItems: body,
@@ -78,18 +82,25 @@ func (bi *writeItem) run(ctx context.Context, cli WriteClient, opt ...options.Op
 		for _, f := range opt {
 			input = f(input).(*dynamodb.BatchWriteItemInput)
 		}
-		out, err = cli.BatchWriteItem(ctx, input)
+		err = bi.option.retryPolicy(ctx).Do(ctx, func(ctx context.Context) (err error) {
+			out, err = cli.BatchWriteItem(ctx, input)
+			if bi.option.observe != nil {
+				unprocessed := 0
+				if out != nil {
+					unprocessed = countRequests(out.UnprocessedItems)
+				}
+				bi.option.observe(countRequests(body), unprocessed, err)
+			}
+			return err
+		})
 		if err != nil {
-			return errors.WithStack(err)
+			return errors.WithStack(newBatchError(body, foundations.Classify("", err)))
 		}
 		body = out.UnprocessedItems // 未処理のアイテム
-		if len(body) > 0 {
-			<-time.After(b.Duration())
-		}
 	}
 	b.Reset()
-	if i >= bi.option.maxRetry {
-		return errors.WithStack(errors.New("max retry exceeded"))
+	if len(body) > 0 {
+		return errors.WithStack(newBatchError(body, retryExceeded("", errors.New("max retry exceeded"))))
 	}
 	return nil
 }
@@ -116,6 +127,14 @@ type Builder struct {
 	err     error
 	monitor Monitor
 	option  batchOption
+	seen    map[string]requestAt
+}
+
+// requestAt 追加済みのリクエストの位置
+type requestAt struct {
+	item  *writeItem
+	table string
+	index int
 }
 
 func (builder *Builder) Monitor(monitor Monitor) *Builder {
@@ -142,14 +161,13 @@ func (builder *Builder) Put(items ...WriteItemFunc) *Builder {
 		if table, item, err := v(); err != nil {
 			builder.err = err
 			return builder
-		} else {
-			if it, newItem := builder.get(len(items)).add(table, types.WriteRequest{
-				PutRequest: &types.PutRequest{
-					Item: item,
-				},
-			}); newItem {
-				builder.items = append(builder.items, it)
-			}
+		} else if err = builder.add(len(items), table, item, types.WriteRequest{
+			PutRequest: &types.PutRequest{
+				Item: item,
+			},
+		}); err != nil {
+			builder.err = err
+			return builder
 		}
 	}
 	return builder
@@ -163,19 +181,52 @@ func (builder *Builder) Delete(items ...WriteItemFunc) *Builder {
 		if table, item, err := v(); err != nil {
 			builder.err = err
 			return builder
-		} else {
-			if it, newItem := builder.get(len(items)).add(table, types.WriteRequest{
-				DeleteRequest: &types.DeleteRequest{
-					Key: item,
-				},
-			}); newItem {
-				builder.items = append(builder.items, it)
-			}
+		} else if item, err = builder.option.keyOrItem(table, item); err != nil {
+			builder.err = err
+			return builder
+		} else if err = builder.add(len(items), table, item, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{
+				Key: item,
+			},
+		}); err != nil {
+			builder.err = err
+			return builder
 		}
 	}
 	return builder
 }
 
+// add DuplicatePolicyに従って同じキーのリクエストをまとめる
+func (builder *Builder) add(length int, table string, item map[string]types.AttributeValue, req types.WriteRequest) error {
+	var key string
+	if builder.option.duplicates != KeepDuplicates {
+		var err error
+		if key, err = builder.option.keyOf(table, item); err != nil {
+			return err
+		}
+		if at, ok := builder.seen[key]; ok {
+			switch builder.option.duplicates {
+			case LastWriteWins:
+				at.item.items[at.table][at.index] = req
+			case FailOnDuplicate:
+				return errors.WithStack(&DuplicateKeyError{Table: table, Key: item})
+			}
+			return nil
+		}
+	}
+	it, newItem := builder.get(length).add(table, req)
+	if newItem {
+		builder.items = append(builder.items, it)
+	}
+	if key != "" {
+		if builder.seen == nil {
+			builder.seen = map[string]requestAt{}
+		}
+		builder.seen[key] = requestAt{item: it, table: table, index: len(it.items[table]) - 1}
+	}
+	return nil
+}
+
 func (builder *Builder) get(length int) *writeItem {
 	var bi *writeItem
 	index := len(builder.items) - 1
@@ -197,14 +248,23 @@ func (builder *Builder) Run(ctx context.Context, cli WriteClient, opt ...options
 		return builder.err
 	}
 	for _, v := range builder.items {
-		if err = v.run(ctx, cli, opt...); err != nil {
-			if err = builder.monitoring(v.items, err); err != nil {
-				return err
-			}
-		}
-		if err = builder.monitoring(v.items, err); err != nil {
+		if err = builder.runItem(ctx, cli, v, opt...); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// runItem A request that is not applied is returned as a BatchError unless it is written to the DeadLetterSink.
+func (builder *Builder) runItem(ctx context.Context, cli WriteClient, v *writeItem, opt ...options.Option) error {
+	err := builder.option.handleFailure(ctx, v.run(ctx, cli, opt...))
+	return builder.monitoring(v.items, err)
+}
+
+func countRequests(items map[string][]types.WriteRequest) int {
+	n := 0
+	for _, requests := range items {
+		n += len(requests)
+	}
+	return n
+}
@@ -0,0 +1,283 @@
+package batches
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/pkg/errors"
+)
+
+// ErrBulkWriterClosed is returned when items are written after BulkWriter.Close.
+var ErrBulkWriterClosed = errors.New("bulk writer closed")
+
+// BulkError is the report of the requests that failed in a BulkWriter.
+type BulkError struct {
+	Errors []error
+}
+
+func (e *BulkError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d batch writes failed: %v", len(e.Errors), e.Errors[0])
+}
+
+func (e *BulkError) Unwrap() []error {
+	return e.Errors
+}
+
+type BulkOption func(w *BulkWriter)
+
+// FlushInterval Flushes the pending items when d has elapsed since the last flush. The default is a second.
+func FlushInterval(d time.Duration) BulkOption {
+	return func(w *BulkWriter) {
+		w.interval = d
+	}
+}
+
+// Concurrency Runs at most n BatchWriteItem requests at once. Writes block while all of them are running. The default is 4.
+func Concurrency(n int) BulkOption {
+	return func(w *BulkWriter) {
+		if n > 0 {
+			w.concurrency = n
+		}
+	}
+}
+
+// WriterOptions Applies opt to the retries of the requests, e.g. MaxRetry and RetryPolicy.
+func WriterOptions(opt ...Option) BulkOption {
+	return func(w *BulkWriter) {
+		for _, o := range opt {
+			o(&w.option)
+		}
+	}
+}
+
+// RequestOptions Applies opt to every BatchWriteItemInput.
+func RequestOptions(opt ...options.Option) BulkOption {
+	return func(w *BulkWriter) {
+		w.opt = append(w.opt, opt...)
+	}
+}
+
+// BulkMonitor Calls monitor with the items of every request. The error returned by monitor is reported in place of err.
+func BulkMonitor(monitor Monitor) BulkOption {
+	return func(w *BulkWriter) {
+		w.monitor = monitor
+	}
+}
+
+// BulkWriter writes items in the background as they arrive, instead of keeping all of them in memory like Builder.
+// A request is sent as soon as MaxWriteItems items are pending or FlushInterval elapses.
+type BulkWriter struct {
+	ctx         context.Context
+	cli         WriteClient
+	opt         []options.Option
+	option      batchOption
+	interval    time.Duration
+	concurrency int
+	monitor     Monitor
+
+	mu      sync.Mutex
+	pending *writeItem
+	closed  bool
+	errs    []error
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	// flushing dispatchのwg.AddがFlushのwg.Waitと並行しないようにする
+	flushing sync.RWMutex
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewBulkWriter Returns a BulkWriter that sends the requests with ctx. Close must be called to write the rest of the items.
+func NewBulkWriter(ctx context.Context, cli WriteClient, opt ...BulkOption) *BulkWriter {
+	w := &BulkWriter{
+		ctx:         ctx,
+		cli:         cli,
+		option:      defaultBatchOption(),
+		interval:    time.Second,
+		concurrency: 4,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	for _, o := range opt {
+		o(w)
+	}
+	w.sem = make(chan struct{}, w.concurrency)
+	go w.tick()
+	return w
+}
+
+func (w *BulkWriter) tick() {
+	defer close(w.done)
+	if w.interval <= 0 {
+		<-w.stop
+		return
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			w.dispatch(w.take())
+		}
+	}
+}
+
+func (w *BulkWriter) Put(items ...WriteItemFunc) error {
+	for _, v := range items {
+		table, item, err := v()
+		if err != nil {
+			return err
+		}
+		if err = w.add(table, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *BulkWriter) Delete(items ...WriteItemFunc) error {
+	for _, v := range items {
+		table, key, err := v()
+		if err != nil {
+			return err
+		}
+		if err = w.add(table, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutFrom Puts the items received from ch until it is closed.
+func (w *BulkWriter) PutFrom(ch <-chan WriteItemFunc) error {
+	return w.receive(ch, w.Put)
+}
+
+// DeleteFrom Deletes the items received from ch until it is closed.
+func (w *BulkWriter) DeleteFrom(ch <-chan WriteItemFunc) error {
+	return w.receive(ch, w.Delete)
+}
+
+func (w *BulkWriter) receive(ch <-chan WriteItemFunc, write func(items ...WriteItemFunc) error) error {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return w.ctx.Err()
+		case v, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := write(v); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *BulkWriter) add(table string, req types.WriteRequest) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrBulkWriterClosed
+	}
+	if w.pending == nil {
+		w.pending = &writeItem{items: map[string][]types.WriteRequest{}, option: &w.option}
+	}
+	w.pending.items[table] = append(w.pending.items[table], req)
+	w.pending.size++
+	var full *writeItem
+	if w.pending.size >= MaxWriteItems {
+		full, w.pending = w.pending, nil
+	}
+	w.mu.Unlock()
+	return w.dispatch(full)
+}
+
+func (w *BulkWriter) take() *writeItem {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	item := w.pending
+	w.pending = nil
+	return item
+}
+
+// dispatch Flushの間は待ってから書き込む
+func (w *BulkWriter) dispatch(item *writeItem) error {
+	w.flushing.RLock()
+	defer w.flushing.RUnlock()
+	return w.start(item)
+}
+
+// start 空きができるまで待ってからバックグラウンドで書き込む
+func (w *BulkWriter) start(item *writeItem) error {
+	if item == nil {
+		return nil
+	}
+	select {
+	case <-w.ctx.Done():
+		w.report(item, w.ctx.Err())
+		return w.ctx.Err()
+	case w.sem <- struct{}{}:
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.sem }()
+		w.report(item, w.option.handleFailure(w.ctx, item.run(w.ctx, w.cli, w.opt...)))
+	}()
+	return nil
+}
+
+func (w *BulkWriter) report(item *writeItem, err error) {
+	if w.monitor != nil {
+		err = w.monitor(item.items, err)
+	}
+	if err == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.errs = append(w.errs, err)
+}
+
+// Flush Writes the pending items and waits for the running requests.
+// It returns a BulkError of the requests that failed since the last Flush.
+func (w *BulkWriter) Flush() error {
+	w.flushing.Lock()
+	_ = w.start(w.take()) // 失敗はreportで記録される
+	w.wg.Wait()
+	w.flushing.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.errs) == 0 {
+		return nil
+	}
+	err := &BulkError{Errors: w.errs}
+	w.errs = nil
+	return err
+}
+
+// Close Flushes the pending items and stops the writer.
+func (w *BulkWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.stop)
+	<-w.done
+	return w.Flush()
+}
@@ -0,0 +1,98 @@
+package batches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+)
+
+func TestBulkWriter(t *testing.T) {
+	denied := errors.New("denied")
+	ctx, cli, repo := setupUsers(t, dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		if in, ok := input.(*dynamodb.BatchWriteItemInput); ok {
+			for _, r := range in.RequestItems["users"] {
+				if r.PutRequest != nil && r.PutRequest.Item["name"].(*types.AttributeValueMemberS).Value == "denied" {
+					return denied
+				}
+			}
+		}
+		return nil
+	}))
+	count := func() int {
+		list, err := repo.Scan(ctx, cli, expression.ConditionBuilder{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(list)
+	}
+	w := NewBulkWriter(ctx, cli, Concurrency(2), FlushInterval(10*time.Millisecond))
+	ch := make(chan WriteItemFunc)
+	go func() {
+		defer close(ch)
+		for i := 0; i < 503; i++ {
+			ch <- PutItems(repo.PutItem(ctx, &User{ID: fmt.Sprintf("u%04d", i), Name: "name"}))[0]
+		}
+	}()
+	if err := w.PutFrom(ch); err != nil {
+		t.Fatal(err)
+	}
+	// 25件に満たない残りは間隔が経過すると書き込まれる
+	deadline := time.Now().Add(time.Second)
+	for count() != 503 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := count(); n != 503 {
+		t.Fatalf("expected 503 users, got %d", n)
+	}
+	if err := w.Delete(DeleteItems(repo.DeleteItem(&User{ID: "u0000"}))...); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Put(PutItems(repo.PutItem(ctx, &User{ID: "x", Name: "denied"}))...); err != nil {
+		t.Fatal(err)
+	}
+	err := w.Close()
+	var bulk *BulkError
+	if !errors.As(err, &bulk) || len(bulk.Errors) != 1 || !errors.Is(err, denied) {
+		t.Fatalf("expected the error of the request, got %v", err)
+	}
+	if n := count(); n != 502 {
+		t.Fatalf("expected 502 users, got %d", n)
+	}
+	if err = w.Put(PutItems(repo.PutItem(ctx, &User{ID: "y"}))...); !errors.Is(err, ErrBulkWriterClosed) {
+		t.Fatalf("expected ErrBulkWriterClosed, got %v", err)
+	}
+}
+
+func TestBulkWriterFlushWhileTicking(t *testing.T) {
+	ctx, cli, repo := setupUsers(t)
+	// 間隔による書き込みとFlushが並行しても全件が書き込まれる
+	w := NewBulkWriter(ctx, cli, FlushInterval(time.Microsecond))
+	for i := 0; i < 300; i++ {
+		if err := w.Put(PutItems(repo.PutItem(ctx, &User{ID: fmt.Sprintf("u%04d", i), Name: "name"}))...); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	list, err := repo.Scan(ctx, cli, expression.ConditionBuilder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 300 {
+		t.Fatalf("expected 300 users, got %d", len(list))
+	}
+}
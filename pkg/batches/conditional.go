@@ -0,0 +1,313 @@
+package batches
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/pkg/errors"
+)
+
+type Operation string
+
+const (
+	OperationPut    Operation = "Put"
+	OperationDelete Operation = "Delete"
+	OperationUpdate Operation = "Update"
+)
+
+// WriteResult is the result of an item of a ConditionalWriter.
+type WriteResult struct {
+	Table     string
+	Operation Operation
+	// Item is the item of a put or the key of a delete and an update.
+	Item map[string]types.AttributeValue
+	// Single is true if the item was written with PutItem, DeleteItem or UpdateItem instead of BatchWriteItem.
+	Single bool
+	Err    error
+}
+
+// WriteResults are in the order the items were added, which is the order of the writes on the same key.
+type WriteResults []WriteResult
+
+func (r WriteResults) Failed() WriteResults {
+	var failed WriteResults
+	for _, v := range r {
+		if v.Err != nil {
+			failed = append(failed, v)
+		}
+	}
+	return failed
+}
+
+// Err Returns a BulkError of the items that failed, or nil.
+func (r WriteResults) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(failed))
+	for _, v := range failed {
+		errs = append(errs, v.Err)
+	}
+	return &BulkError{Errors: errs}
+}
+
+type ConditionalClient interface {
+	WriteClient
+	foundations.WriteClient
+}
+
+type ConditionalOption func(w *ConditionalWriter)
+
+// ItemConcurrency Runs at most n PutItem, DeleteItem and UpdateItem requests at once. The default is 8.
+func ItemConcurrency(n int) ConditionalOption {
+	return func(w *ConditionalWriter) {
+		if n > 0 {
+			w.concurrency = n
+		}
+	}
+}
+
+// BatchOptions Applies opt to the BatchWriteItem requests, e.g. MaxRetry and RetryPolicy.
+func BatchOptions(opt ...Option) ConditionalOption {
+	return func(w *ConditionalWriter) {
+		for _, o := range opt {
+			o(&w.option)
+		}
+	}
+}
+
+type conditionalItem struct {
+	table   string
+	item    map[string]types.AttributeValue
+	expr    expression.Expression
+	version string
+}
+
+func (v *conditionalItem) single() bool {
+	return v.expr.Condition() != nil
+}
+
+func (v *conditionalItem) writeItemFunc() foundations.VersionedWriteItemFunc {
+	return func() (string, map[string]types.AttributeValue, expression.Expression, string, error) {
+		return v.table, v.item, v.expr, v.version, nil
+	}
+}
+
+// ConditionalWriter writes the items with conditions with PutItem, DeleteItem or UpdateItem concurrently,
+// since BatchWriteItem can not carry condition expressions, and the others with BatchWriteItem.
+// Updates are always written with UpdateItem.
+// The writes on the same key are made in the order they were added, and the writes on different keys in any order.
+// The keys of puts are derived with KeyAttributes, KeysOf or KeyRegistry of BatchOptions;
+// a put whose key is unknown is not written at the same time as the items written with single requests.
+type ConditionalWriter struct {
+	items       []*conditionalItem
+	results     WriteResults
+	err         error
+	concurrency int
+	option      batchOption
+}
+
+func NewConditionalWriter(opt ...ConditionalOption) *ConditionalWriter {
+	w := &ConditionalWriter{
+		concurrency: 8,
+		option:      defaultBatchOption(),
+	}
+	for _, o := range opt {
+		o(w)
+	}
+	return w
+}
+
+func (w *ConditionalWriter) HasError() bool {
+	return w.err != nil
+}
+
+func (w *ConditionalWriter) Put(items ...foundations.WriteItem) *ConditionalWriter {
+	return w.add(OperationPut, items)
+}
+
+func (w *ConditionalWriter) Delete(items ...foundations.WriteItem) *ConditionalWriter {
+	return w.add(OperationDelete, items)
+}
+
+func (w *ConditionalWriter) Update(items ...foundations.WriteItem) *ConditionalWriter {
+	return w.add(OperationUpdate, items)
+}
+
+func (w *ConditionalWriter) add(op Operation, items []foundations.WriteItem) *ConditionalWriter {
+	if w.err != nil {
+		return w
+	}
+	for _, f := range items {
+		table, item, expr, version, err := f.WriteItem()
+		if err != nil {
+			w.err = err
+			return w
+		}
+		if op == OperationDelete {
+			if item, err = w.option.keyOrItem(table, item); err != nil {
+				w.err = err
+				return w
+			}
+		}
+		v := &conditionalItem{table: table, item: item, expr: expr, version: version}
+		w.items = append(w.items, v)
+		w.results = append(w.results, WriteResult{Table: table, Operation: op, Item: item, Single: op == OperationUpdate || v.single()})
+	}
+	return w
+}
+
+// Run Writes the items and returns the result of every item. The error is WriteResults.Err.
+func (w *ConditionalWriter) Run(ctx context.Context, cli ConditionalClient, opt ...options.Option) (WriteResults, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	results := make(WriteResults, len(w.results))
+	copy(results, w.results)
+	for _, indexes := range w.segments(results) {
+		w.runBatches(ctx, cli, results, indexes, opt)
+		w.runSingles(ctx, cli, results, indexes, opt)
+	}
+	return results, results.Err()
+}
+
+// segment 同じキーへの書き込みを含まない、まとめて書き込めるアイテム
+type segment struct {
+	indexes []int
+	// keys 含まれるアイテムのキー
+	keys           map[string]bool
+	singles        bool
+	unknown        bool
+	unknownSingles bool
+}
+
+// conflicts 同じキーへの書き込みの順序が変わる可能性があるか。キーが分からないアイテムはすべてのキーと重なるとみなす
+// BatchWriteItemは同じキーを重複して含められず、チャンクの間の順序も保証されないので、同じキーは常に分ける
+func (s *segment) conflicts(key string, known, single bool) bool {
+	if !known {
+		return s.singles || single && len(s.indexes) > 0
+	}
+	if s.unknownSingles || single && s.unknown {
+		return true
+	}
+	_, ok := s.keys[key]
+	return ok
+}
+
+func (s *segment) add(i int, key string, known, single bool) {
+	s.indexes = append(s.indexes, i)
+	s.singles = s.singles || single
+	if !known {
+		s.unknown = true
+		s.unknownSingles = s.unknownSingles || single
+		return
+	}
+	s.keys[key] = true
+}
+
+// segments 同じキーへの書き込みが追加した順に行われるように、アイテムを順に書き込む区間に分ける
+func (w *ConditionalWriter) segments(results WriteResults) [][]int {
+	var segments [][]int
+	current := &segment{keys: map[string]bool{}}
+	for i, v := range results {
+		var key string
+		var err error
+		if v.Operation == OperationPut {
+			key, err = w.option.keyOf(v.Table, v.Item)
+		} else {
+			key = v.Table + "\x00" + keyString(v.Item) // 削除と更新のItemはキー
+		}
+		known := err == nil
+		if current.conflicts(key, known, v.Single) {
+			segments = append(segments, current.indexes)
+			current = &segment{keys: map[string]bool{}}
+		}
+		current.add(i, key, known, v.Single)
+	}
+	if len(current.indexes) > 0 {
+		segments = append(segments, current.indexes)
+	}
+	return segments
+}
+
+// runBatches 条件の無いPutとDeleteをBatchWriteItemで書き込む
+func (w *ConditionalWriter) runBatches(ctx context.Context, cli WriteClient, results WriteResults, indexes []int, opt []options.Option) {
+	var chunk *writeItem
+	var chunked []int
+	flush := func() {
+		if chunk == nil {
+			return
+		}
+		err := chunk.run(ctx, cli, opt...)
+		failed := map[string]error{}
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			for _, f := range batchErr.Failed {
+				failed[f.Table+"\x00"+keyString(f.Key())] = f.Err
+			}
+		}
+		for _, i := range chunked {
+			if e, ok := failed[results[i].Table+"\x00"+keyString(results[i].Item)]; ok {
+				results[i].Err = e
+			} else if batchErr == nil && err != nil {
+				results[i].Err = err
+			}
+		}
+		chunk, chunked = nil, nil
+	}
+	for _, i := range indexes {
+		v := results[i]
+		if v.Single {
+			continue
+		}
+		if chunk == nil {
+			chunk = &writeItem{items: map[string][]types.WriteRequest{}, option: &w.option}
+		}
+		req := types.WriteRequest{PutRequest: &types.PutRequest{Item: v.Item}}
+		if v.Operation == OperationDelete {
+			req = types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: v.Item}}
+		}
+		chunk.items[v.Table] = append(chunk.items[v.Table], req)
+		chunk.size++
+		chunked = append(chunked, i)
+		if chunk.size >= MaxWriteItems {
+			flush()
+		}
+	}
+	flush()
+}
+
+// runSingles 条件付きのアイテムと更新を並行して書き込む
+func (w *ConditionalWriter) runSingles(ctx context.Context, cli foundations.WriteClient, results WriteResults, indexes []int, opt []options.Option) {
+	sem := make(chan struct{}, w.concurrency)
+	wg := sync.WaitGroup{}
+	for _, i := range indexes {
+		v := results[i]
+		if !v.Single {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var err error
+			f := w.items[i].writeItemFunc()
+			switch v.Operation {
+			case OperationPut:
+				_, err = foundations.Put(ctx, cli, f, opt...)
+			case OperationDelete:
+				_, err = foundations.Delete(ctx, cli, f, opt...)
+			case OperationUpdate:
+				_, err = foundations.Update(ctx, cli, f, opt...)
+			}
+			results[i].Err = err
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,110 @@
+package batches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+func TestConditionalWriter(t *testing.T) {
+	var mu sync.Mutex
+	operations := map[string]int{}
+	ctx, cli, repo := setupUsers(t, dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		operations[operation]++
+		return nil
+	}))
+	if err := PutAll(ctx, cli, repo, []User{{ID: "exists", Name: "old"}}); err != nil {
+		t.Fatal(err)
+	}
+	notExists := func() (expression.Expression, error) {
+		return expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("id"))).Build()
+	}
+	w := NewConditionalWriter(ItemConcurrency(2))
+	for i := 0; i < 30; i++ {
+		w.Put(repo.PutItem(ctx, &User{ID: fmt.Sprintf("u%02d", i), Name: "name"}))
+	}
+	w.Put(foundations.PutItem(ctx, "users", &User{ID: "new", Name: "new"}, notExists))
+	w.Put(foundations.PutItem(ctx, "users", &User{ID: "exists", Name: "new"}, notExists))
+	w.Update(repo.UpdateItem(ctx, &User{ID: "u00"}, func(ctx context.Context, builder *expression.UpdateBuilder) expression.UpdateBuilder {
+		return builder.Set(expression.Name("name"), expression.Value("updated"))
+	}))
+	results, err := w.Run(ctx, cli)
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Errors) != 1 || !errors.Is(err, foundations.ErrConditionFailed) {
+		t.Fatalf("expected a failed condition, got %v", err)
+	}
+	if len(results) != 33 || results[0].Single || !results[30].Single || results[30].Err != nil || results[31].Err == nil || !results[32].Single {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if failed := results.Failed(); len(failed) != 1 || failed[0].Table != "users" || failed[0].Operation != OperationPut {
+		t.Fatalf("unexpected failed results: %+v", failed)
+	}
+	if operations["BatchWriteItem"] != 3 || operations["PutItem"] != 2 || operations["UpdateItem"] != 1 {
+		t.Fatalf("unexpected operations: %v", operations)
+	}
+	if u, err := repo.Get(ctx, cli, repo.Key(&User{ID: "exists"})); err != nil || u.Name != "old" {
+		t.Fatalf("expected the existing item to be kept, got %v %v", u, err)
+	}
+	if u, err := repo.Get(ctx, cli, repo.Key(&User{ID: "u00"})); err != nil || u.Name != "updated" {
+		t.Fatalf("expected the item to be updated, got %v %v", u, err)
+	}
+}
+
+func TestConditionalWriterOrder(t *testing.T) {
+	notExists := func() (expression.Expression, error) {
+		return expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("id"))).Build()
+	}
+	for _, opt := range [][]ConditionalOption{nil, {BatchOptions(KeyAttributes("users", "id"))}} {
+		ctx, cli, repo := setupUsers(t)
+		// 同じキーへの書き込みは追加した順に行われる
+		w := NewConditionalWriter(opt...).
+			Put(foundations.PutItem(ctx, "users", &User{ID: "u1", Name: "first"}, notExists)).
+			Put(foundations.PutItem(ctx, "users", &User{ID: "u2", Name: "first"}, notExists)).
+			Put(repo.PutItem(ctx, &User{ID: "u1", Name: "second"})).
+			Delete(repo.DeleteItem(&User{ID: "u2"}))
+		results, err := w.Run(ctx, cli)
+		if err != nil {
+			t.Fatalf("unexpected results: %+v", results)
+		}
+		if u, err := repo.Get(ctx, cli, repo.Key(&User{ID: "u1"})); err != nil || u.Name != "second" {
+			t.Fatalf("expected the last put to win, got %v %v", u, err)
+		}
+		if _, err = repo.Get(ctx, cli, repo.Key(&User{ID: "u2"})); !foundations.IsNotFound(err) {
+			t.Fatalf("expected the item to be deleted, got %v", err)
+		}
+	}
+}
+
+func TestConditionalWriterSameKey(t *testing.T) {
+	ctx, cli, repo := setupUsers(t)
+	// 条件の無い書き込みが同じキーに続いても、1つのBatchWriteItemには入れない
+	w := NewConditionalWriter(BatchOptions(KeyAttributes("users", "id"))).
+		Put(repo.PutItem(ctx, &User{ID: "u1", Name: "first"})).
+		Put(repo.PutItem(ctx, &User{ID: "u1", Name: "second"})).
+		Put(repo.PutItem(ctx, &User{ID: "u2", Name: "first"})).
+		Delete(foundations.WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+			return "users", map[string]types.AttributeValue{
+				"id":   &types.AttributeValueMemberS{Value: "u2"},
+				"name": &types.AttributeValueMemberS{Value: "first"},
+			}, expression.Expression{}, nil
+		}))
+	results, err := w.Run(ctx, cli)
+	if err != nil {
+		t.Fatalf("unexpected results: %+v, %v", results, err)
+	}
+	if u, err := repo.Get(ctx, cli, repo.Key(&User{ID: "u1"})); err != nil || u.Name != "second" {
+		t.Fatalf("expected the last put to win, got %v %v", u, err)
+	}
+	if _, err = repo.Get(ctx, cli, repo.Key(&User{ID: "u2"})); !foundations.IsNotFound(err) {
+		t.Fatalf("expected the item to be deleted, got %v", err)
+	}
+}
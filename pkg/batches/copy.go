@@ -0,0 +1,214 @@
+package batches
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/pkg/errors"
+)
+
+// TransformFunc Returns the item to write in place of item, or skip to write nothing.
+type TransformFunc func(item foundations.Record) (out foundations.Record, skip bool, err error)
+
+// CopyProgress is the progress of Copy since it was started or resumed.
+type CopyProgress struct {
+	Scanned int64
+	Written int64
+	Skipped int64
+}
+
+type copyConfig struct {
+	segments   int32
+	transform  TransformFunc
+	checkpoint string
+	options    []Option
+	scan       []options.Option
+	progress   func(p CopyProgress)
+}
+
+type CopyOption func(c *copyConfig)
+
+// CopySegments Scans the source table with n parallel segments. The default is foundations.DefaultScanSegments.
+// A resumed copy keeps the segments of the checkpoint.
+func CopySegments(n int32) CopyOption {
+	return func(c *copyConfig) {
+		c.segments = n
+	}
+}
+
+// Transform Applies f to every item before it is written.
+func Transform(f TransformFunc) CopyOption {
+	return func(c *copyConfig) {
+		c.transform = f
+	}
+}
+
+// CopyCheckpoint Saves the LastEvaluatedKey of every segment to the file at path after its page has been written,
+// and resumes from the file if it exists. The file is removed when the copy finishes.
+func CopyCheckpoint(path string) CopyOption {
+	return func(c *copyConfig) {
+		c.checkpoint = path
+	}
+}
+
+// CopyWriterOptions Applies opt to the BatchWriteItem requests, e.g. MaxRetry, RetryPolicy and DeadLetter.
+func CopyWriterOptions(opt ...Option) CopyOption {
+	return func(c *copyConfig) {
+		c.options = append(c.options, opt...)
+	}
+}
+
+// CopyScanOptions Applies opt to the ScanInput of every segment, e.g. options.Limit to checkpoint in smaller pages.
+func CopyScanOptions(opt ...options.Option) CopyOption {
+	return func(c *copyConfig) {
+		c.scan = append(c.scan, opt...)
+	}
+}
+
+// OnCopyProgress Calls f after every page has been written. Calls are serialized.
+func OnCopyProgress(f func(p CopyProgress)) CopyOption {
+	return func(c *copyConfig) {
+		c.progress = f
+	}
+}
+
+// copyState チェックポイントファイルの内容
+type copyState struct {
+	Segments int32                              `json:"segments"`
+	Keys     map[int32]foundations.EvaluatedKey `json:"keys"`
+}
+
+func loadCopyState(path string) (*copyState, error) {
+	bin, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	state := &copyState{}
+	if err = json.Unmarshal(bin, state); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return state, nil
+}
+
+// save 書き込み途中でクラッシュしても壊れないように一時ファイルから置き換える
+func (s *copyState) save(path string) error {
+	bin, err := json.Marshal(s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(bin); err != nil {
+		_ = tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp.Name(), path))
+}
+
+// Copy Scans the items of srcTable with parallel segments and writes them to dstTable with BatchWriteItem.
+// src and dst may be clients of different endpoints or regions. Every page is written before its segment goes on,
+// so a copy that failed is resumed from CopyCheckpoint without losing items.
+func Copy(ctx context.Context, src foundations.ScanClient, srcTable string, dst WriteClient, dstTable string, opt ...CopyOption) (CopyProgress, error) {
+	conf := &copyConfig{segments: foundations.DefaultScanSegments}
+	for _, o := range opt {
+		o(conf)
+	}
+	var progress CopyProgress
+	state := &copyState{Segments: conf.segments}
+	if conf.checkpoint != "" {
+		saved, err := loadCopyState(conf.checkpoint)
+		if err != nil {
+			return progress, err
+		}
+		if saved != nil {
+			state = saved
+		}
+	}
+	scanOpts := []foundations.ParallelScanOption{foundations.Segments(state.Segments), foundations.ScanOptions(conf.scan...)}
+	if state.Keys != nil {
+		scanOpts = append(scanOpts, foundations.ResumeFrom(state.Keys))
+	} else {
+		state.Keys = make(map[int32]foundations.EvaluatedKey, state.Segments)
+		for segment := int32(0); segment < state.Segments; segment++ {
+			state.Keys[segment] = nil
+		}
+	}
+	var mu sync.Mutex
+	if conf.checkpoint != "" {
+		scanOpts = append(scanOpts, foundations.Checkpoint(func(segment int32, key foundations.EvaluatedKey) error {
+			if key == nil {
+				delete(state.Keys, segment)
+			} else {
+				state.Keys[segment] = key
+			}
+			return state.save(conf.checkpoint)
+		}))
+	}
+	_, err := foundations.ParallelScanPages(ctx, src, func() (string, expression.Expression, error) {
+		return srcTable, expression.Expression{}, nil
+	}, func(ctx context.Context, segment int32, items foundations.Records) error {
+		b := New(conf.options...)
+		written, skipped := 0, 0
+		for _, v := range items {
+			item := foundations.Record(v)
+			if conf.transform != nil {
+				var skip bool
+				var err error
+				if item, skip, err = conf.transform(item); err != nil {
+					return err
+				}
+				if skip {
+					skipped++
+					continue
+				}
+			}
+			b.Put(func() (string, map[string]types.AttributeValue, error) {
+				return dstTable, item, nil
+			})
+			written++
+		}
+		if err := b.Run(ctx, dst); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		progress.Scanned += int64(len(items))
+		progress.Written += int64(written)
+		progress.Skipped += int64(skipped)
+		if conf.progress != nil {
+			conf.progress(progress)
+		}
+		return nil
+	}, scanOpts...)
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		return progress, err
+	}
+	if conf.checkpoint != "" {
+		if err = os.Remove(conf.checkpoint); err != nil && !os.IsNotExist(err) {
+			return progress, errors.WithStack(err)
+		}
+	}
+	return progress, nil
+}
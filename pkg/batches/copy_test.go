@@ -0,0 +1,105 @@
+package batches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	createTable := func(cli *dynamodbfake.Client, table string) {
+		if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName:            aws.String(table),
+			AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeN}},
+			KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+			BillingMode:          types.BillingModePayPerRequest,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := dynamodbfake.New()
+	createTable(src, "source")
+	b := New()
+	for i := 0; i < 100; i++ {
+		item := map[string]types.AttributeValue{
+			"id":   &types.AttributeValueMemberN{Value: fmt.Sprint(i)},
+			"name": &types.AttributeValueMemberS{Value: fmt.Sprintf("n%d", i)},
+		}
+		b.Put(func() (string, map[string]types.AttributeValue, error) { return "source", item, nil })
+	}
+	if err := b.Run(ctx, src); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	fail := true
+	writes := 0
+	dst := dynamodbfake.New(dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if operation == "BatchWriteItem" {
+			if writes++; fail && writes > 5 {
+				return errors.New("unavailable")
+			}
+		}
+		return nil
+	}))
+	createTable(dst, "destination")
+	transform := Transform(func(item foundations.Record) (foundations.Record, bool, error) {
+		id, _ := strconv.Atoi(item["id"].(*types.AttributeValueMemberN).Value)
+		if id%10 == 0 {
+			return nil, true, nil
+		}
+		item["copied"] = &types.AttributeValueMemberBOOL{Value: true}
+		return item, false, nil
+	})
+	checkpoint := filepath.Join(t.TempDir(), "copy.json")
+	opts := []CopyOption{transform, CopySegments(2), CopyCheckpoint(checkpoint), CopyScanOptions(options.Limit(10)),
+		CopyWriterOptions(RetryPolicy(&foundations.RetryPolicy{MaxAttempts: 1}))}
+	first, err := Copy(ctx, src, "source", dst, "destination", opts...)
+	if err == nil {
+		t.Fatal("expected the copy to fail")
+	}
+	if _, err = os.Stat(checkpoint); err != nil {
+		t.Fatalf("expected the checkpoint to be saved: %v", err)
+	}
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	second, err := Copy(ctx, src, "source", dst, "destination", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Scanned+second.Scanned > 110 || second.Scanned >= 100 {
+		t.Fatalf("expected the copy to be resumed, got %+v %+v", first, second)
+	}
+	if _, err = os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Fatalf("expected the checkpoint to be removed: %v", err)
+	}
+	out, err := dst.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("destination")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Count != 90 {
+		t.Fatalf("expected 90 items, got %d", out.Count)
+	}
+	for _, item := range out.Items {
+		if item["copied"] == nil || item["name"] == nil {
+			t.Fatalf("unexpected item: %v", item)
+		}
+	}
+}
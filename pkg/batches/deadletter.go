@@ -0,0 +1,178 @@
+package batches
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+)
+
+// deadLetterRecord JSON Linesの1行
+type deadLetterRecord struct {
+	Table  string                    `json:"table"`
+	Put    map[string]attributeValue `json:"put,omitempty"`
+	Delete map[string]attributeValue `json:"delete,omitempty"`
+	Reason string                    `json:"reason,omitempty"`
+}
+
+// attributeValue is an AttributeValue in the JSON format of the DynamoDB API.
+type attributeValue struct {
+	S    *string                    `json:"S,omitempty"`
+	N    *string                    `json:"N,omitempty"`
+	B    []byte                     `json:"B,omitempty"`
+	BOOL *bool                      `json:"BOOL,omitempty"`
+	NULL *bool                      `json:"NULL,omitempty"`
+	SS   []string                   `json:"SS,omitempty"`
+	NS   []string                   `json:"NS,omitempty"`
+	BS   [][]byte                   `json:"BS,omitempty"`
+	L    *[]attributeValue          `json:"L,omitempty"`
+	M    *map[string]attributeValue `json:"M,omitempty"`
+}
+
+func encodeItem(item map[string]types.AttributeValue) map[string]attributeValue {
+	m := make(map[string]attributeValue, len(item))
+	for k, v := range item {
+		m[k] = encodeValue(v)
+	}
+	return m
+}
+
+func encodeValue(v types.AttributeValue) attributeValue {
+	switch val := v.(type) {
+	case *types.AttributeValueMemberS:
+		return attributeValue{S: &val.Value}
+	case *types.AttributeValueMemberN:
+		return attributeValue{N: &val.Value}
+	case *types.AttributeValueMemberB:
+		return attributeValue{B: val.Value}
+	case *types.AttributeValueMemberBOOL:
+		return attributeValue{BOOL: &val.Value}
+	case *types.AttributeValueMemberNULL:
+		return attributeValue{NULL: &val.Value}
+	case *types.AttributeValueMemberSS:
+		return attributeValue{SS: val.Value}
+	case *types.AttributeValueMemberNS:
+		return attributeValue{NS: val.Value}
+	case *types.AttributeValueMemberBS:
+		return attributeValue{BS: val.Value}
+	case *types.AttributeValueMemberL:
+		l := make([]attributeValue, 0, len(val.Value))
+		for _, e := range val.Value {
+			l = append(l, encodeValue(e))
+		}
+		return attributeValue{L: &l}
+	case *types.AttributeValueMemberM:
+		m := encodeItem(val.Value)
+		return attributeValue{M: &m}
+	}
+	return attributeValue{}
+}
+
+func decodeItem(m map[string]attributeValue) map[string]types.AttributeValue {
+	if m == nil {
+		return nil
+	}
+	item := make(map[string]types.AttributeValue, len(m))
+	for k, v := range m {
+		item[k] = v.decode()
+	}
+	return item
+}
+
+func (v attributeValue) decode() types.AttributeValue {
+	switch {
+	case v.S != nil:
+		return &types.AttributeValueMemberS{Value: *v.S}
+	case v.N != nil:
+		return &types.AttributeValueMemberN{Value: *v.N}
+	case v.B != nil:
+		return &types.AttributeValueMemberB{Value: v.B}
+	case v.BOOL != nil:
+		return &types.AttributeValueMemberBOOL{Value: *v.BOOL}
+	case v.NULL != nil:
+		return &types.AttributeValueMemberNULL{Value: *v.NULL}
+	case v.SS != nil:
+		return &types.AttributeValueMemberSS{Value: v.SS}
+	case v.NS != nil:
+		return &types.AttributeValueMemberNS{Value: v.NS}
+	case v.BS != nil:
+		return &types.AttributeValueMemberBS{Value: v.BS}
+	case v.M != nil:
+		return &types.AttributeValueMemberM{Value: decodeItem(*v.M)}
+	case v.L != nil:
+		l := make([]types.AttributeValue, 0, len(*v.L))
+		for _, e := range *v.L {
+			l = append(l, e.decode())
+		}
+		return &types.AttributeValueMemberL{Value: l}
+	}
+	return nil
+}
+
+// JSONLinesSink writes the failed requests as JSON Lines that Replay can read.
+type JSONLinesSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{enc: json.NewEncoder(w)}
+}
+
+func (s *JSONLinesSink) Write(ctx context.Context, failed []FailedRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range failed {
+		rec := deadLetterRecord{Table: f.Table}
+		switch {
+		case f.Request.PutRequest != nil:
+			rec.Put = encodeItem(f.Request.PutRequest.Item)
+		case f.Request.DeleteRequest != nil:
+			rec.Delete = encodeItem(f.Request.DeleteRequest.Key)
+		default:
+			continue
+		}
+		if f.Err != nil {
+			rec.Reason = f.Err.Error()
+		}
+		if err := s.enc.Encode(&rec); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Replay Writes the requests read from the JSON Lines of JSONLinesSink again.
+func Replay(ctx context.Context, cli WriteClient, r io.Reader, opt ...Option) error {
+	b := New(opt...)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // 1アイテムは最大400KB
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec deadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return errors.WithStack(err)
+		}
+		f := func() (string, map[string]types.AttributeValue, error) {
+			if rec.Put != nil {
+				return rec.Table, decodeItem(rec.Put), nil
+			}
+			return rec.Table, decodeItem(rec.Delete), nil
+		}
+		if rec.Put != nil {
+			b.Put(f)
+		} else {
+			b.Delete(f)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return b.Run(ctx, cli)
+}
@@ -0,0 +1,204 @@
+package batches
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/pkg/errors"
+)
+
+// DuplicatePolicy decides what to do with the requests on the same key in a batch, which BatchWriteItem rejects.
+type DuplicatePolicy int
+
+const (
+	// KeepDuplicates sends the requests as they are.
+	KeepDuplicates DuplicatePolicy = iota
+	// LastWriteWins keeps the last request on a key.
+	LastWriteWins
+	// FirstWriteWins keeps the first request on a key.
+	FirstWriteWins
+	// FailOnDuplicate returns a DuplicateKeyError.
+	FailOnDuplicate
+)
+
+// ErrDuplicateKey is matched by DuplicateKeyError.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// DuplicateKeyError is returned by FailOnDuplicate.
+type DuplicateKeyError struct {
+	Table string
+	Key   map[string]types.AttributeValue
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("%s: %s %s", ErrDuplicateKey, e.Table, keyString(e.Key))
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return ErrDuplicateKey
+}
+
+// Duplicates Applies policy to the requests on the same key. The keys of the tables are set with KeyAttributes or KeysOf.
+func Duplicates(policy DuplicatePolicy) Option {
+	return func(input *batchOption) *batchOption {
+		if input != nil {
+			input.duplicates = policy
+		}
+		return input
+	}
+}
+
+// KeyAttributes Sets the names of the hash key and the range key of the table to detect duplicates.
+// The key schemas of KeyRegistry, foundations.DefaultKeyRegistry by default, are used for the other tables.
+func KeyAttributes(table string, names ...string) Option {
+	return func(input *batchOption) *batchOption {
+		if input != nil {
+			if input.keys == nil {
+				input.keys = map[string][]string{}
+			}
+			input.keys[table] = names
+		}
+		return input
+	}
+}
+
+// KeysOf Sets the key attributes of the table of repo to detect duplicates.
+func KeysOf[T any](repo *foundations.Repository[T]) Option {
+	return KeyAttributes(repo.TableName(), repo.KeyNames()...)
+}
+
+// keyOf 重複判定に使うキーの文字列を返す
+func (opt *batchOption) keyOf(table string, item map[string]types.AttributeValue) (string, error) {
+	names, ok := opt.keys[table]
+	if !ok {
+		s, ok := opt.registry.Lookup(table)
+		if !ok {
+			return "", fmt.Errorf("key attributes of %s are unknown to detect duplicates", table)
+		}
+		names = s.Names()
+	}
+	key := make(map[string]types.AttributeValue, len(names))
+	for _, name := range names {
+		v, ok := item[name]
+		if !ok {
+			return "", fmt.Errorf("%s has no key attribute %s", table, name)
+		}
+		key[name] = v
+	}
+	return table + "\x00" + keyString(key), nil
+}
+
+// keyOrItem Returns the key attributes of item with KeyAttributes or KeyRegistry, or item as it is if the key is unknown.
+func (opt *batchOption) keyOrItem(table string, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	names, ok := opt.keys[table]
+	if !ok {
+		return opt.registry.KeyOrItem(table, item)
+	}
+	key := make(map[string]types.AttributeValue, len(names))
+	for _, name := range names {
+		v, ok := item[name]
+		if !ok {
+			return nil, fmt.Errorf("%s has no key attribute %s", table, name)
+		}
+		key[name] = v
+	}
+	return key, nil
+}
+
+// dedupe Returns the positions of the items to keep in the order of the first occurrences.
+func dedupe(opt *batchOption, n int, itemOf func(i int) (string, map[string]types.AttributeValue, error)) ([]int, error) {
+	kept := make([]int, 0, n)
+	slots := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		table, item, err := itemOf(i)
+		if err != nil {
+			return nil, err
+		}
+		key, err := opt.keyOf(table, item)
+		if err != nil {
+			return nil, err
+		}
+		slot, ok := slots[key]
+		if !ok {
+			slots[key] = len(kept)
+			kept = append(kept, i)
+			continue
+		}
+		switch opt.duplicates {
+		case LastWriteWins:
+			kept[slot] = i
+		case FailOnDuplicate:
+			return nil, errors.WithStack(&DuplicateKeyError{Table: table, Key: item})
+		}
+	}
+	return kept, nil
+}
+
+func sortedNames(key map[string]types.AttributeValue) []string {
+	names := make([]string, 0, len(key))
+	for name := range key {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keyString キーを一意な文字列にする。名前と値の前に長さを置き、数値は正規化する
+func keyString(key map[string]types.AttributeValue) string {
+	names := sortedNames(key)
+	var sb strings.Builder
+	for _, name := range names {
+		var kind, value string
+		switch v := key[name].(type) {
+		case *types.AttributeValueMemberS:
+			kind, value = "S", v.Value
+		case *types.AttributeValueMemberN:
+			kind, value = "N", canonicalNumber(v.Value)
+		case *types.AttributeValueMemberB:
+			kind, value = "B", string(v.Value)
+		default:
+			kind, value = fmt.Sprintf("%T", v), fmt.Sprintf("%v", v)
+		}
+		fmt.Fprintf(&sb, "%d:%s%s%d:%s", len(name), name, kind, len(value), value)
+	}
+	return sb.String()
+}
+
+// canonicalNumber "1", "1.0", "10e-1" のように表記の異なる同じ数値を同じ文字列にする
+func canonicalNumber(n string) string {
+	s := strings.TrimSpace(n)
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		if s[0] == '-' {
+			sign = "-"
+		}
+		s = s[1:]
+	}
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return n
+		}
+		s, exp = s[:i], e
+	}
+	digits := s
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits = s[:i] + s[i+1:]
+		exp -= len(s) - i - 1
+	}
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return n
+	}
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		return "0"
+	}
+	trimmed := strings.TrimRight(digits, "0")
+	exp += len(digits) - len(trimmed)
+	return sign + trimmed + "e" + strconv.Itoa(exp)
+}
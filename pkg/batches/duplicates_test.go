@@ -0,0 +1,93 @@
+package batches
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+func TestDuplicates(t *testing.T) {
+	ctx, cli, repo := setupUsers(t)
+	users := []User{{ID: "u1", Name: "first"}, {ID: "u2", Name: "first"}, {ID: "u1", Name: "last"}}
+	items := func() []WriteItemFunc {
+		list := make([]foundations.WriteItem, 0, len(users))
+		for i := range users {
+			list = append(list, repo.PutItem(ctx, &users[i]))
+		}
+		return PutItems(list...)
+	}
+	if err := New().Put(items()...).Run(ctx, cli); err == nil {
+		t.Fatal("expected BatchWriteItem to reject the duplicates")
+	}
+	if err := New(Duplicates(LastWriteWins)).Put(items()...).Run(ctx, cli); err == nil {
+		t.Fatal("expected an error for the unknown key attributes")
+	}
+
+	tests := []struct {
+		policy DuplicatePolicy
+		name   string
+	}{
+		{policy: LastWriteWins, name: "last"},
+		{policy: FirstWriteWins, name: "first"},
+	}
+	for _, tt := range tests {
+		if err := New(Duplicates(tt.policy), KeysOf(repo)).Put(items()...).Run(ctx, cli); err != nil {
+			t.Fatal(err)
+		}
+		if u, err := repo.Get(ctx, cli, repo.Key(&User{ID: "u1"})); err != nil || u.Name != tt.name {
+			t.Fatalf("expected %s, got %v %v", tt.name, u, err)
+		}
+		if err := NewBatch("users", users, Duplicates(tt.policy), KeysOf(repo)).Put(ctx, cli); err != nil {
+			t.Fatal(err)
+		}
+		if u, err := repo.Get(ctx, cli, repo.Key(&User{ID: "u1"})); err != nil || u.Name != tt.name {
+			t.Fatalf("expected %s, got %v %v", tt.name, u, err)
+		}
+	}
+
+	err := New(Duplicates(FailOnDuplicate), KeyAttributes("users", "id")).Put(items()...).Run(ctx, cli)
+	var dupErr *DuplicateKeyError
+	if !errors.As(err, &dupErr) || !errors.Is(err, ErrDuplicateKey) || dupErr.Table != "users" {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	}
+	if err = NewBatch("users", users, Duplicates(FailOnDuplicate), KeysOf(repo)).Delete(ctx, cli); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	}
+
+	count := 0
+	_, err = Get(repo.Key(&User{ID: "u1"}), repo.Key(&User{ID: "u2"}), repo.Key(&User{ID: "u1"})).Run(ctx, cli, func(tableName string, values foundations.Records) error {
+		count += len(values)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 items, got %d", count)
+	}
+}
+
+func TestKeyString(t *testing.T) {
+	s := func(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+	n := func(v string) types.AttributeValue { return &types.AttributeValueMemberN{Value: v} }
+	tests := []struct {
+		a, b  map[string]types.AttributeValue
+		equal bool
+	}{
+		{map[string]types.AttributeValue{"id": s("a;b=S:c")}, map[string]types.AttributeValue{"id": s("a"), "b": s("c")}, false},
+		{map[string]types.AttributeValue{"pk": s("x;sk=S:y")}, map[string]types.AttributeValue{"pk": s("x"), "sk": s("y")}, false},
+		{map[string]types.AttributeValue{"id": n("1")}, map[string]types.AttributeValue{"id": n("1.0")}, true},
+		{map[string]types.AttributeValue{"id": n("100")}, map[string]types.AttributeValue{"id": n("1E2")}, true},
+		{map[string]types.AttributeValue{"id": n("-0.50")}, map[string]types.AttributeValue{"id": n("-.5")}, true},
+		{map[string]types.AttributeValue{"id": n("0")}, map[string]types.AttributeValue{"id": n("-0.00")}, true},
+		{map[string]types.AttributeValue{"id": n("10")}, map[string]types.AttributeValue{"id": n("1")}, false},
+		{map[string]types.AttributeValue{"id": n("1")}, map[string]types.AttributeValue{"id": s("1")}, false},
+	}
+	for _, tt := range tests {
+		if got := keyString(tt.a) == keyString(tt.b); got != tt.equal {
+			t.Errorf("keyString(%v) == keyString(%v) = %v, want %v", keyString(tt.a), keyString(tt.b), got, tt.equal)
+		}
+	}
+}
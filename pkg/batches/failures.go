@@ -0,0 +1,87 @@
+package batches
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+)
+
+// FailedRequest is a write request that was not applied.
+type FailedRequest struct {
+	Table   string
+	Request types.WriteRequest
+	// Err is the reason, e.g. the error of the request or the retries exceeded by the unprocessed item.
+	Err error
+}
+
+// Key Returns the key of a delete request or the item of a put request, which includes the key.
+func (r FailedRequest) Key() map[string]types.AttributeValue {
+	switch {
+	case r.Request.DeleteRequest != nil:
+		return r.Request.DeleteRequest.Key
+	case r.Request.PutRequest != nil:
+		return r.Request.PutRequest.Item
+	}
+	return nil
+}
+
+// BatchError lists the write requests that were not applied. It matches Err with errors.Is and errors.As.
+type BatchError struct {
+	Failed []FailedRequest
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d write requests were not applied: %v", len(e.Failed), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// newBatchError items are the requests left when err occurred.
+func newBatchError(items map[string][]types.WriteRequest, err error) *BatchError {
+	tables := make([]string, 0, len(items))
+	for table := range items {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	failed := make([]FailedRequest, 0, countRequests(items))
+	for _, table := range tables {
+		for _, req := range items[table] {
+			failed = append(failed, FailedRequest{Table: table, Request: req, Err: err})
+		}
+	}
+	return &BatchError{Failed: failed, Err: err}
+}
+
+// DeadLetterSink stores the requests that were not applied so they can be replayed later.
+type DeadLetterSink interface {
+	Write(ctx context.Context, failed []FailedRequest) error
+}
+
+// DeadLetter Writes the requests that were not applied to sink instead of returning them as a BatchError.
+// Errors of sink are returned with the BatchError.
+func DeadLetter(sink DeadLetterSink) Option {
+	return func(input *batchOption) *batchOption {
+		if input != nil {
+			input.deadLetter = sink
+		}
+		return input
+	}
+}
+
+// handleFailure 失敗したリクエストをデッドレターに書き込めたらエラーにしない
+func (opt *batchOption) handleFailure(ctx context.Context, err error) error {
+	var batchErr *BatchError
+	if err == nil || opt == nil || opt.deadLetter == nil || !errors.As(err, &batchErr) {
+		return err
+	}
+	if e := opt.deadLetter.Write(ctx, batchErr.Failed); e != nil {
+		return errors.Wrapf(err, "dead letter: %v", e)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package batches
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+func TestBatchError(t *testing.T) {
+	ctx, cli, repo := setupUsers(t, dynamodbfake.WithBatchWriteLimit(4))
+	items := func(prefix string) []WriteItemFunc {
+		list := make([]foundations.WriteItem, 0, 10)
+		for i := 0; i < 10; i++ {
+			list = append(list, repo.PutItem(ctx, &User{ID: fmt.Sprintf("%s%02d", prefix, i), Name: "name"}))
+		}
+		return PutItems(list...)
+	}
+	monitored := 0
+	err := New(MaxRetry(1), RetryInterval(time.Millisecond, time.Millisecond)).Monitor(func(items map[string][]types.WriteRequest, err error) error {
+		monitored++
+		return err
+	}).Put(items("a")...).Run(ctx, cli)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 6 {
+		t.Fatalf("expected 6 failed requests, got %v", err)
+	}
+	if !errors.Is(err, foundations.ErrThrottled) || batchErr.Failed[0].Table != "users" || batchErr.Failed[0].Key()["id"] == nil {
+		t.Fatalf("unexpected error: %+v", batchErr.Failed[0])
+	}
+	if monitored != 1 {
+		t.Fatalf("expected the monitor to be called once, got %d", monitored)
+	}
+
+	// デッドレターに書き込んで後から再実行する
+	var buf bytes.Buffer
+	if err = New(MaxRetry(1), RetryInterval(time.Millisecond, time.Millisecond), DeadLetter(NewJSONLinesSink(&buf))).Put(items("b")...).Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 6 {
+		t.Fatalf("expected 6 dead letters, got %d", lines)
+	}
+	if err = Replay(ctx, cli, &buf, MaxRetry(5), RetryInterval(time.Millisecond, time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	list, err := repo.Scan(ctx, cli, expression.Name("id").BeginsWith("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 10 {
+		t.Fatalf("expected 10 users, got %v", list)
+	}
+}
+
+func TestMaxRetryOnce(t *testing.T) {
+	ctx, cli, repo := setupUsers(t)
+	// 最後の試行で全て処理されれば成功する
+	users := []User{{ID: "u1", Name: "name"}, {ID: "u2", Name: "name"}}
+	if err := New(MaxRetry(1)).Put(PutItems(repo.PutItem(ctx, &users[0]), repo.PutItem(ctx, &users[1]))...).Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	got := 0
+	keys := []map[string]string{{"id": "u1"}, {"id": "u2"}}
+	if err := NewBatch("users", keys, MaxRetry(1)).Get(ctx, cli, func(tableName string, value foundations.Record) error {
+		got++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got != 2 {
+		t.Fatalf("expected 2 users, got %d", got)
+	}
+}
@@ -3,8 +3,11 @@ package batches
 import (
 	"context"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/cloudflare/backoff"
 	"github.com/goccha/dynamodb-verse/pkg/foundations"
 	"github.com/pkg/errors"
 )
@@ -14,48 +17,61 @@ const (
 )
 
 type getItem struct {
-	keys map[string]types.KeysAndAttributes
-	size int
+	keys   map[string]types.KeysAndAttributes
+	size   int
+	option *batchOption
 }
 
 func (gi *getItem) Size() int {
 	return gi.size
 }
 func (gi *getItem) Keys(table string, value map[string]types.AttributeValue, attrs []string) (key *getItem, newItem bool) {
-	key = gi
-	if v, ok := key.keys[table]; ok {
-		if gi.size < MaxGetItems {
-			key.keys[table] = types.KeysAndAttributes{
-				Keys:            append(v.Keys, value),
-				AttributesToGet: attrs,
-			}
-		} else {
-			key = &getItem{
-				keys: make(map[string]types.KeysAndAttributes),
-				size: 0,
-			}
-			key.Keys(table, value, attrs)
-			return key, true
+	if gi.size >= MaxGetItems {
+		// テーブルに関わらず1回のリクエストはMaxGetItems件まで
+		key = &getItem{
+			keys:   make(map[string]types.KeysAndAttributes),
+			size:   0,
+			option: gi.option,
+		}
+		key.Keys(table, value, attrs)
+		return key, true
+	}
+	if v, ok := gi.keys[table]; ok {
+		gi.keys[table] = types.KeysAndAttributes{
+			Keys:            append(v.Keys, value),
+			AttributesToGet: attrs,
 		}
 	} else {
 		keys := make([]map[string]types.AttributeValue, 0, MaxGetItems)
-		key.keys[table] = types.KeysAndAttributes{
+		gi.keys[table] = types.KeysAndAttributes{
 			Keys:            append(keys, value),
 			AttributesToGet: attrs,
 		}
 	}
-	key.size++
-	return key, false
+	gi.size++
+	return gi, false
 }
 
 func (gi *getItem) run(ctx context.Context, cli GetClient, fetch foundations.FetchItemsFunc) (out *dynamodb.BatchGetItemOutput, err error) {
-	keys := gi.keys
-	for len(keys) > 0 {
-		out, err = cli.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
-			RequestItems: keys,
+	keys, err := gi.option.requestItems(gi.keys)
+	if err != nil {
+		return nil, err
+	}
+	b := backoff.New(gi.option.maxInterval, gi.option.interval)
+	for i := 0; len(keys) > 0 && i < gi.option.maxRetry; i++ {
+		if i > 0 {
+			if err = wait(ctx, b.Duration()); err != nil {
+				return nil, err
+			}
+		}
+		err = gi.option.retryPolicy(ctx).Do(ctx, func(ctx context.Context) (err error) {
+			out, err = cli.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: keys,
+			})
+			return err
 		})
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, errors.WithStack(foundations.Classify("", err))
 		}
 		if fetch != nil {
 			for table, values := range out.Responses {
@@ -66,19 +82,76 @@ func (gi *getItem) run(ctx context.Context, cli GetClient, fetch foundations.Fet
 		}
 		keys = out.UnprocessedKeys
 	}
+	b.Reset()
+	if len(keys) > 0 {
+		return nil, errors.WithStack(retryExceeded("", errors.New("max retry exceeded")))
+	}
 	return out, nil
 }
 
+// requestItems テーブルごとの射影と強い整合性読み込みを設定する
+func (opt *batchOption) requestItems(keys map[string]types.KeysAndAttributes) (map[string]types.KeysAndAttributes, error) {
+	items := make(map[string]types.KeysAndAttributes, len(keys))
+	for table, v := range keys {
+		attrs := v.AttributesToGet
+		if p, ok := opt.projections[table]; ok {
+			attrs = p
+		}
+		req := types.KeysAndAttributes{Keys: v.Keys}
+		if opt.consistentRead[table] {
+			req.ConsistentRead = aws.Bool(true)
+		}
+		if len(attrs) > 0 {
+			// 結果をキーと対応付けられるようにキー属性も取得する
+			names := make([]expression.NameBuilder, 0, len(attrs)+2)
+			seen := make(map[string]struct{}, len(attrs)+2)
+			for _, a := range append(sortedNames(v.Keys[0]), attrs...) {
+				if _, ok := seen[a]; !ok {
+					seen[a] = struct{}{}
+					names = append(names, expression.Name(a))
+				}
+			}
+			expr, err := expression.NewBuilder().WithProjection(expression.NamesList(names[0], names[1:]...)).Build()
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			req.ProjectionExpression = expr.Projection()
+			req.ExpressionAttributeNames = expr.Names()
+		}
+		items[table] = req
+	}
+	return items, nil
+}
+
 func Get(keys ...foundations.GetKeyFunc) *GetBuilder {
+	return NewGetBuilder().Keys(keys...)
+}
+
+// NewGetBuilder Returns a GetBuilder with opt, e.g. MaxRetry, RetryInterval, Projection and ConsistentRead.
+func NewGetBuilder(opt ...Option) *GetBuilder {
 	builder := &GetBuilder{
-		items: make([]*getItem, 0, len(keys)),
+		items:  []*getItem{},
+		option: defaultBatchOption(),
+	}
+	for _, o := range opt {
+		o(&builder.option)
 	}
-	return builder.Keys(keys...)
+	return builder
 }
 
+// GetBuilder sends the keys with BatchGetItem. The same keys of a table are requested once, since BatchGetItem rejects duplicates.
+// Unprocessed keys are retried with MaxRetry and RetryInterval.
 type GetBuilder struct {
-	items []*getItem
-	err   error
+	items     []*getItem
+	err       error
+	seen      map[string]struct{}
+	requested []requestedKey
+	option    batchOption
+}
+
+type requestedKey struct {
+	table string
+	key   map[string]types.AttributeValue
 }
 
 func (builder *GetBuilder) HasError() bool {
@@ -95,6 +168,15 @@ func (builder *GetBuilder) Keys(keys ...foundations.GetKeyFunc) *GetBuilder {
 			builder.err = err
 			return builder
 		} else {
+			builder.requested = append(builder.requested, requestedKey{table: table, key: key})
+			k := table + "\x00" + keyString(key)
+			if _, ok := builder.seen[k]; ok {
+				continue
+			}
+			if builder.seen == nil {
+				builder.seen = map[string]struct{}{}
+			}
+			builder.seen[k] = struct{}{}
 			if it, newItem := builder.get(len(keys)).Keys(table, key, attr); newItem {
 				builder.items = append(builder.items, it)
 			}
@@ -109,7 +191,8 @@ func (builder *GetBuilder) get(length int) *getItem {
 	if index < 0 {
 		builder.items = make([]*getItem, 0, length)
 		gi = &getItem{
-			keys: make(map[string]types.KeysAndAttributes),
+			keys:   make(map[string]types.KeysAndAttributes),
+			option: &builder.option,
 		}
 		builder.items = append(builder.items, gi)
 	} else {
@@ -133,3 +216,74 @@ func (builder *GetBuilder) Run(ctx context.Context, cli GetClient, fetch foundat
 type GetClient interface {
 	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
 }
+
+// Results are the items of the keys of a GetBuilder.
+type Results struct {
+	requested []requestedKey
+	items     map[string]foundations.Record
+}
+
+// Fetch Gets the items of the keys. The results of the tables are taken out with Records or ResultsOf in the order of the keys.
+func (builder *GetBuilder) Fetch(ctx context.Context, cli GetClient) (*Results, error) {
+	names := make(map[string][]string)
+	for _, v := range builder.requested {
+		if _, ok := names[v.table]; !ok {
+			names[v.table] = sortedNames(v.key)
+		}
+	}
+	res := &Results{requested: builder.requested, items: make(map[string]foundations.Record, len(builder.requested))}
+	_, err := builder.Run(ctx, cli, func(table string, values foundations.Records) error {
+		for _, v := range values {
+			key := make(map[string]types.AttributeValue, len(names[table]))
+			for _, name := range names[table] {
+				key[name] = v[name]
+			}
+			res.items[table+"\x00"+keyString(key)] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Records Returns the items of table in the order of the keys. Missing items are nil.
+func (r *Results) Records(table string) foundations.Records {
+	records := make(foundations.Records, 0, len(r.requested))
+	for _, v := range r.requested {
+		if v.table == table {
+			records = append(records, r.items[table+"\x00"+keyString(v.key)])
+		}
+	}
+	return records
+}
+
+// Result is the item of a key. Item is nil if it is missing.
+type Result[T any] struct {
+	Key  map[string]types.AttributeValue
+	Item *T
+}
+
+func (r Result[T]) Found() bool {
+	return r.Item != nil
+}
+
+// ResultsOf Returns the items of table as T in the order of the keys.
+func ResultsOf[T any](ctx context.Context, r *Results, table string) ([]Result[T], error) {
+	results := make([]Result[T], 0, len(r.requested))
+	for _, v := range r.requested {
+		if v.table != table {
+			continue
+		}
+		res := Result[T]{Key: v.key}
+		if item, ok := r.items[table+"\x00"+keyString(v.key)]; ok {
+			res.Item = new(T)
+			if err := item.Unmarshal(ctx, res.Item); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
@@ -0,0 +1,156 @@
+package batches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+type Group struct {
+	ID    string `dynamodbav:"gid" dynamodbkey:"hash"`
+	Title string `dynamodbav:"title"`
+	Owner string `dynamodbav:"owner"`
+}
+
+func TestGetBuilder(t *testing.T) {
+	ctx := context.Background()
+	var requests []*dynamodb.BatchGetItemInput
+	cli := dynamodbfake.New(dynamodbfake.WithBatchGetLimit(3), dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		if in, ok := input.(*dynamodb.BatchGetItemInput); ok {
+			requests = append(requests, in)
+		}
+		return nil
+	}))
+	for _, v := range []struct{ table, key string }{{"users", "id"}, {"groups", "gid"}} {
+		if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName:            aws.String(v.table),
+			AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String(v.key), AttributeType: types.ScalarAttributeTypeS}},
+			KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String(v.key), KeyType: types.KeyTypeHash}},
+			BillingMode:          types.BillingModePayPerRequest,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users, err := foundations.NewRepository[User]("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := foundations.NewRepository[Group]("groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = PutAll(ctx, cli, users, []User{{ID: "u1", Name: "one"}, {ID: "u3", Name: "three"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = PutAll(ctx, cli, groups, []Group{{ID: "g1", Title: "title", Owner: "u1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewGetBuilder(RetryInterval(time.Millisecond, time.Millisecond), Projection("groups", "title"), ConsistentRead("users")).
+		Keys(users.Key(&User{ID: "u3"}), groups.Key(&Group{ID: "g2"}), users.Key(&User{ID: "u2"}), groups.Key(&Group{ID: "g1"}), users.Key(&User{ID: "u1"}))
+	res, err := b.Fetch(ctx, cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected the unprocessed keys to be retried once, got %d requests", len(requests))
+	}
+	if in := requests[0].RequestItems; !aws.ToBool(in["users"].ConsistentRead) || in["groups"].ProjectionExpression == nil || in["groups"].AttributesToGet != nil {
+		t.Fatalf("unexpected request: %+v", in)
+	}
+	list, err := ResultsOf[User](ctx, res, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ""
+	for _, v := range list {
+		if v.Found() {
+			got += v.Item.Name + ","
+		} else {
+			got += "-,"
+		}
+	}
+	if got != "three,-,one," {
+		t.Fatalf("unexpected users: %s", got)
+	}
+	gs, err := ResultsOf[Group](ctx, res, "groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gs) != 2 || gs[0].Found() || !gs[1].Found() || gs[1].Item.ID != "g1" || gs[1].Item.Title != "title" || gs[1].Item.Owner != "" {
+		t.Fatalf("unexpected groups: %+v", gs)
+	}
+	if records := res.Records("users"); len(records) != 3 || records[1] != nil {
+		t.Fatalf("unexpected records: %v", records)
+	}
+
+	keys := make([]foundations.GetKeyFunc, 0, 10)
+	for i := 0; i < 10; i++ {
+		keys = append(keys, users.Key(&User{ID: fmt.Sprintf("u%d", i)}))
+	}
+	_, err = NewGetBuilder(MaxRetry(2), RetryInterval(time.Millisecond, time.Millisecond)).Keys(keys...).Fetch(ctx, cli)
+	if !errors.Is(err, foundations.ErrThrottled) {
+		t.Fatalf("expected the retries to be exceeded, got %v", err)
+	}
+}
+
+func TestGetBuilderLimits(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	ctx, cli, users := setupUsers(t, dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		if in, ok := input.(*dynamodb.BatchGetItemInput); ok {
+			n := 0
+			for _, v := range in.RequestItems {
+				n += len(v.Keys)
+			}
+			mu.Lock()
+			sizes = append(sizes, n)
+			mu.Unlock()
+		}
+		return nil
+	}))
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("groups"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("gid"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("gid"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := foundations.NewRepository[Group]("groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 別のテーブルのキーでも1回のリクエストはMaxGetItems件まで
+	keys := make([]foundations.GetKeyFunc, 0, MaxGetItems+1)
+	for i := 0; i < MaxGetItems; i++ {
+		keys = append(keys, users.Key(&User{ID: fmt.Sprintf("u%03d", i)}))
+	}
+	keys = append(keys, groups.Key(&Group{ID: "g1"}))
+	if _, err = NewGetBuilder().Keys(keys...).Fetch(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 2 || sizes[0]+sizes[1] != MaxGetItems+1 || sizes[0] > MaxGetItems || sizes[1] > MaxGetItems {
+		t.Fatalf("unexpected request sizes: %v", sizes)
+	}
+
+	// 再試行の待機はコンテキストの終了で打ち切られる
+	_, throttled, _ := setupUsers(t, dynamodbfake.WithBatchGetLimit(1))
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = NewGetBuilder(MaxRetry(3), RetryInterval(time.Hour, time.Hour)).
+		Keys(users.Key(&User{ID: "u1"}), users.Key(&User{ID: "u2"})).Fetch(timeout, throttled)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 10*time.Second {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+}
@@ -1,13 +1,26 @@
 package batches
 
 import (
+	"context"
 	"time"
+
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
 )
 
 type batchOption struct {
 	maxRetry    int
 	interval    time.Duration
 	maxInterval time.Duration
+	retry       *foundations.RetryPolicy
+	// observe BatchWriteItemの結果を通知する
+	observe    func(sent, unprocessed int, err error)
+	deadLetter DeadLetterSink
+	duplicates DuplicatePolicy
+	// keys テーブルごとのキー属性名
+	keys           map[string][]string
+	registry       *foundations.KeyRegistry
+	projections    map[string][]string
+	consistentRead map[string]bool
 }
 
 func defaultBatchOption() batchOption {
@@ -15,6 +28,17 @@ func defaultBatchOption() batchOption {
 		maxRetry:    3,
 		interval:    time.Second,
 		maxInterval: time.Minute,
+		registry:    foundations.DefaultKeyRegistry,
+	}
+}
+
+// KeyRegistry Derives the keys of the tables without KeyAttributes with the key schemas of r in place of foundations.DefaultKeyRegistry.
+func KeyRegistry(r *foundations.KeyRegistry) Option {
+	return func(input *batchOption) *batchOption {
+		if input != nil {
+			input.registry = r
+		}
+		return input
 	}
 }
 
@@ -38,3 +62,59 @@ func RetryInterval(maxInterval, interval time.Duration) Option {
 		return input
 	}
 }
+
+// RetryPolicy Retries the failed requests with p in place of the policy of the context.
+// Unprocessed items are retried with MaxRetry and RetryInterval.
+func RetryPolicy(p *foundations.RetryPolicy) Option {
+	return func(input *batchOption) *batchOption {
+		if input != nil {
+			input.retry = p
+		}
+		return input
+	}
+}
+
+// wait 未処理のアイテムを再試行する前に待機する
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (opt *batchOption) retryPolicy(ctx context.Context) *foundations.RetryPolicy {
+	if opt != nil && opt.retry != nil {
+		return opt.retry
+	}
+	return foundations.RetryPolicyFrom(ctx)
+}
+
+// Projection Gets attrs of the items of table with ProjectionExpression. The key attributes are always returned.
+func Projection(table string, attrs ...string) Option {
+	return func(input *batchOption) *batchOption {
+		if input != nil {
+			if input.projections == nil {
+				input.projections = map[string][]string{}
+			}
+			input.projections[table] = attrs
+		}
+		return input
+	}
+}
+
+// ConsistentRead Gets the items of table with strongly consistent reads.
+func ConsistentRead(table string) Option {
+	return func(input *batchOption) *batchOption {
+		if input != nil {
+			if input.consistentRead == nil {
+				input.consistentRead = map[string]bool{}
+			}
+			input.consistentRead[table] = true
+		}
+		return input
+	}
+}
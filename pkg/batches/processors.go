@@ -61,8 +61,9 @@ func (p *SingleProcessor) Run(ctx context.Context, cli WriteClient, opt ...optio
 }
 
 type MultiProcessor struct {
-	b       []*Builder
-	counter int32
+	b        []*Builder
+	counter  int32
+	adaptive *adaptive
 }
 
 func (p *MultiProcessor) Monitor(monitor Monitor) BatchProcessor {
@@ -98,6 +99,9 @@ func (p *MultiProcessor) Delete(items ...WriteItemFunc) BatchProcessor {
 //}
 
 func (p *MultiProcessor) Run(ctx context.Context, cli WriteClient, opt ...options.Option) error {
+	if p.adaptive != nil {
+		return p.runAdaptive(ctx, cli, opt...)
+	}
 	eg, ctx := errgroup.WithContext(ctx)
 	//wg := sync.WaitGroup{}
 	for _, b := range p.b {
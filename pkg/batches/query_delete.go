@@ -0,0 +1,166 @@
+package batches
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/goccha/dynamodb-verse/pkg/transactions"
+	"github.com/pkg/errors"
+)
+
+type DeleteByQueryClient interface {
+	foundations.QueryClient
+	WriteClient
+	foundations.DescribeTableClient
+	transactions.Client
+}
+
+// DeleteByQueryResult is the number of the items matched by the query and deleted.
+type DeleteByQueryResult struct {
+	Matched int64
+	Deleted int64
+}
+
+type deleteByQueryConfig struct {
+	transaction int
+	concurrency int
+	options     []Option
+}
+
+type DeleteByQueryOption func(c *deleteByQueryConfig)
+
+// DeleteInTransactions Deletes the items with TransactWriteItems of at most size items, so that each chunk is deleted atomically.
+func DeleteInTransactions(size int) DeleteByQueryOption {
+	return func(c *deleteByQueryConfig) {
+		if size > 0 && size <= transactions.MaxItems {
+			c.transaction = size
+		}
+	}
+}
+
+// DeleteConcurrency Runs at most n BatchWriteItem requests at once. The default is 4.
+func DeleteConcurrency(n int) DeleteByQueryOption {
+	return func(c *deleteByQueryConfig) {
+		c.concurrency = n
+	}
+}
+
+// DeleteWriterOptions Applies opt to the BatchWriteItem requests, e.g. MaxRetry and RetryPolicy.
+func DeleteWriterOptions(opt ...Option) DeleteByQueryOption {
+	return func(c *deleteByQueryConfig) {
+		c.options = append(c.options, opt...)
+	}
+}
+
+// DeleteByQuery Deletes the items matched by condition, e.g. all the items of a partition key or a range of sort keys.
+// Only the key attributes of the table are queried, with the key schema of the KeyRegistry of DeleteWriterOptions,
+// foundations.DefaultKeyRegistry by default, or DescribeTable.
+// The pages are deleted with BatchWriteItem as they arrive, or with TransactWriteItems with DeleteInTransactions,
+// and no page is kept after it is deleted. An empty result is not an error even with EnableErrorWithEmptyList.
+// The result counts the items of the requests and the transactions that were applied, even if it returns an error.
+func DeleteByQuery(ctx context.Context, cli DeleteByQueryClient, condition foundations.QueryConditionFunc, opt ...DeleteByQueryOption) (DeleteByQueryResult, error) {
+	conf := &deleteByQueryConfig{concurrency: 4}
+	for _, o := range opt {
+		o(conf)
+	}
+	var res DeleteByQueryResult
+	table, _, _, err := condition()
+	if err != nil {
+		return res, err
+	}
+	writer := defaultBatchOption()
+	for _, o := range conf.options {
+		o(&writer)
+	}
+	schema, ok := writer.registry.Lookup(table)
+	if !ok {
+		if schema, err = foundations.DescribeKeySchema(ctx, cli, table); err != nil {
+			return res, err
+		}
+	}
+	var mu sync.Mutex
+	w := NewBulkWriter(ctx, cli, Concurrency(conf.concurrency), WriterOptions(conf.options...),
+		BulkMonitor(func(items map[string][]types.WriteRequest, err error) error {
+			mu.Lock()
+			defer mu.Unlock()
+			res.Deleted += int64(deletedCount(items, err))
+			return err
+		}))
+	_, err = foundations.QueryPages(ctx, cli, condition, func(tableName string, values foundations.Records) error {
+		res.Matched += int64(len(values))
+		if conf.transaction > 0 {
+			items := make([]foundations.WriteItem, 0, len(values))
+			for _, v := range values {
+				items = append(items, foundations.WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+					return table, v, expression.Expression{}, nil
+				}))
+			}
+			// 失敗するまでにコミットされたチャンクも数える
+			_, err := transactions.New(transactions.Limit(conf.transaction)).Monitor(func(items []types.TransactWriteItem, err error) {
+				if err == nil {
+					mu.Lock()
+					defer mu.Unlock()
+					res.Deleted += int64(len(items))
+				}
+			}).Delete(items...).Run(ctx, cli)
+			return err
+		}
+		for _, v := range values {
+			if err := w.Delete(func() (string, map[string]types.AttributeValue, error) {
+				return table, v, nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, projectKeys(schema))
+	if err != nil {
+		_ = w.Close() // クエリのエラーを優先する
+		return res, err
+	}
+	err = w.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	return res, err
+}
+
+// projectKeys テーブルのキー属性だけを取得する
+func projectKeys(schema foundations.KeySchema) options.Option {
+	return func(input any) any {
+		if in, ok := input.(*dynamodb.QueryInput); ok {
+			names := make(map[string]string, len(in.ExpressionAttributeNames)+2)
+			for k, v := range in.ExpressionAttributeNames {
+				names[k] = v
+			}
+			paths := make([]string, 0, 2)
+			for i, name := range schema.Names() {
+				placeholder := fmt.Sprintf("#key%d", i)
+				names[placeholder] = name
+				paths = append(paths, placeholder)
+			}
+			projection := strings.Join(paths, ", ")
+			in.ProjectionExpression = &projection
+			in.ExpressionAttributeNames = names
+		}
+		return input
+	}
+}
+
+// deletedCount 適用されたリクエストの数を返す
+func deletedCount(items map[string][]types.WriteRequest, err error) int {
+	var batchErr *BatchError
+	switch {
+	case err == nil:
+		return countRequests(items)
+	case errors.As(err, &batchErr):
+		return countRequests(items) - len(batchErr.Failed)
+	}
+	return 0
+}
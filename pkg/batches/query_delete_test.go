@@ -0,0 +1,126 @@
+package batches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+func TestDeleteByQuery(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	operations := map[string]int{}
+	failAt := 0
+	cli := dynamodbfake.New(dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if in, ok := input.(*dynamodb.QueryInput); ok && in.ProjectionExpression == nil {
+			t.Error("expected the keys to be projected")
+		}
+		operations[operation]++
+		if operation == "TransactWriteItems" && operations[operation] == failAt {
+			return errors.New("transaction failed")
+		}
+		return nil
+	}))
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String("messages"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("user"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("seq"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("user"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("seq"), KeyType: types.KeyTypeRange},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	b := New()
+	for _, user := range []string{"alice", "bob"} {
+		for i := 0; i < 60; i++ {
+			item := map[string]types.AttributeValue{
+				"user": &types.AttributeValueMemberS{Value: user},
+				"seq":  &types.AttributeValueMemberN{Value: fmt.Sprint(i)},
+				"body": &types.AttributeValueMemberS{Value: "hello"},
+			}
+			b.Put(func() (string, map[string]types.AttributeValue, error) { return "messages", item, nil })
+		}
+	}
+	if err := b.Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	condition := func(key expression.KeyConditionBuilder) foundations.QueryConditionFunc {
+		return func() (string, string, expression.Expression, error) {
+			expr, err := expression.NewBuilder().WithKeyCondition(key).Build()
+			return "messages", "", expr, err
+		}
+	}
+	count := func(user string) int32 {
+		out, err := cli.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String("messages"),
+			KeyConditionExpression:    aws.String("#u = :u"),
+			ExpressionAttributeNames:  map[string]string{"#u": "user"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":u": &types.AttributeValueMemberS{Value: user}},
+			ProjectionExpression:      aws.String("#u"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Count
+	}
+
+	res, err := DeleteByQuery(ctx, cli, condition(expression.Key("user").Equal(expression.Value("alice")).
+		And(expression.Key("seq").Between(expression.Value(10), expression.Value(19)))), DeleteInTransactions(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Matched != 10 || res.Deleted != 10 || count("alice") != 50 || operations["TransactWriteItems"] != 3 {
+		t.Fatalf("unexpected result: %+v %v", res, operations)
+	}
+	if _, ok := foundations.DefaultKeyRegistry.Lookup("messages"); ok {
+		t.Fatal("expected the key schema not to be registered")
+	}
+
+	// 2つ目のトランザクションが失敗しても、コミットされたチャンクは数える
+	mu.Lock()
+	failAt = operations["TransactWriteItems"] + 2
+	mu.Unlock()
+	res, err = DeleteByQuery(ctx, cli, condition(expression.Key("user").Equal(expression.Value("bob")).
+		And(expression.Key("seq").Between(expression.Value(0), expression.Value(9)))), DeleteInTransactions(4))
+	if err == nil {
+		t.Fatal("expected the transaction to fail")
+	}
+	if res.Matched != 10 || res.Deleted != 4 || count("bob") != 56 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	res, err = DeleteByQuery(ctx, cli, condition(expression.Key("user").Equal(expression.Value("alice"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Matched != 50 || res.Deleted != 50 || count("alice") != 0 || count("bob") != 56 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	// 空リストをエラーにする設定でも、削除するものがなければ0件で成功する
+	foundations.EnableErrorWithEmptyList(true)
+	defer foundations.EnableErrorWithEmptyList(false)
+	res, err = DeleteByQuery(ctx, cli, condition(expression.Key("user").Equal(expression.Value("alice"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Matched != 0 || res.Deleted != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
@@ -0,0 +1,53 @@
+package batches
+
+import (
+	"context"
+
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+// GetAll Returns the items of keys. Missing items are skipped and the order of the items is not kept.
+func GetAll[T any](ctx context.Context, cli GetClient, repo *foundations.Repository[T], keys ...foundations.GetKeyFunc) ([]T, error) {
+	list := make([]T, 0, len(keys))
+	if len(keys) == 0 {
+		return list, nil
+	}
+	_, err := Get(keys...).Run(ctx, cli, func(tableName string, values foundations.Records) error {
+		var page []T
+		if err := values.Unmarshal(ctx, &page); err != nil {
+			return err
+		}
+		list = append(list, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// PutAll Puts entities into the table of repo in batches of MaxWriteItems.
+// Batch writes can not be conditioned, so version attributes are incremented without being checked.
+func PutAll[T any](ctx context.Context, cli WriteClient, repo *foundations.Repository[T], entities []T, opt ...options.Option) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	items := make([]foundations.WriteItem, 0, len(entities))
+	for i := range entities {
+		items = append(items, repo.PutItem(ctx, &entities[i]))
+	}
+	return New().Put(PutItems(items...)...).Run(ctx, cli, opt...)
+}
+
+// DeleteAll Deletes entities from the table of repo in batches of MaxWriteItems.
+func DeleteAll[T any](ctx context.Context, cli WriteClient, repo *foundations.Repository[T], entities []T, opt ...options.Option) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	items := make([]foundations.WriteItem, 0, len(entities))
+	for i := range entities {
+		items = append(items, repo.DeleteItem(&entities[i]))
+	}
+	return New().Delete(DeleteItems(items...)...).Run(ctx, cli, opt...)
+}
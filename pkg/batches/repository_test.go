@@ -0,0 +1,70 @@
+package batches
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+type User struct {
+	ID   string `dynamodbav:"id" dynamodbkey:"hash"`
+	Name string `dynamodbav:"name"`
+}
+
+func setupUsers(t *testing.T, opt ...dynamodbfake.Option) (context.Context, *dynamodbfake.Client, *foundations.Repository[User]) {
+	t.Helper()
+	ctx := context.Background()
+	cli := dynamodbfake.New(opt...)
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("users"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := foundations.NewRepository[User]("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx, cli, repo
+}
+
+func TestRepositoryBatches(t *testing.T) {
+	ctx, cli, repo := setupUsers(t)
+	users := make([]User, 0, 60)
+	for i := 0; i < 60; i++ {
+		users = append(users, User{ID: fmt.Sprintf("u%02d", i), Name: "name"})
+	}
+	if err := PutAll(ctx, cli, repo, users); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]foundations.GetKeyFunc, 0, len(users))
+	for i := range users {
+		keys = append(keys, repo.Key(&users[i]))
+	}
+	got, err := GetAll(ctx, cli, repo, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(users) {
+		t.Fatalf("expected %d users, got %d", len(users), len(got))
+	}
+	if err = DeleteAll(ctx, cli, repo, users[:50]); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := repo.Scan(ctx, cli, expression.ConditionBuilder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 10 {
+		t.Fatalf("expected 10 users, got %d", len(rest))
+	}
+}
@@ -2,8 +2,14 @@ package batches
 
 import (
 	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/migrate"
+	"github.com/pkg/errors"
 )
 
 type TruncateClient interface {
@@ -12,24 +18,170 @@ type TruncateClient interface {
 }
 
 // Truncate Deletes records in the specified table.
-func Truncate[T any](ctx context.Context, db TruncateClient, condition foundations.ScanFilterFunc, keyFunc DeleteKeyFunc[T]) error {
-	b := New()
-	_, err := foundations.ScanAll(ctx, db, condition, func(tableName string, value foundations.Records) error {
+// If keyFunc is nil, the keys are derived from the records with the key schema of KeyRegistry, foundations.DefaultKeyRegistry by default.
+// The table is scanned with parallel segments whose pages are deleted with BatchWriteItem as they arrive, as TruncateTable does.
+// opt is applied to the BatchWriteItem requests.
+func Truncate[T any](ctx context.Context, db TruncateClient, condition foundations.ScanFilterFunc, keyFunc DeleteKeyFunc[T], opt ...Option) error {
+	tableName, _, err := condition()
+	if err != nil {
+		return err
+	}
+	conf := defaultBatchOption()
+	for _, o := range opt {
+		o(&conf)
+	}
+	w := NewBulkWriter(ctx, db, WriterOptions(opt...))
+	_, err = foundations.ParallelScanPages(ctx, db, condition, func(ctx context.Context, segment int32, value foundations.Records) error {
+		if keyFunc == nil {
+			for _, v := range value {
+				key, err := conf.registry.Key(tableName, v)
+				if err != nil {
+					return err
+				}
+				if err = w.Delete(func() (string, map[string]types.AttributeValue, error) {
+					return tableName, key, nil
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
 		rec := make([]T, len(value))
 		if err := value.Unmarshal(ctx, &rec); err != nil {
 			return err
 		}
 		for _, v := range rec {
-			b.Delete(func() (table string, item map[string]types.AttributeValue, err error) {
+			if err := w.Delete(func() (table string, item map[string]types.AttributeValue, err error) {
 				table = tableName
 				item = keyFunc(v)
 				return
-			})
+			}); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		_ = w.Close() // スキャンのエラーを優先する
+		return err
+	}
+	return w.Close()
+}
+
+type TruncateTableClient interface {
+	TruncateClient
+	foundations.DescribeTableClient
+}
+
+// TruncateProgress is the progress of TruncateTable.
+type TruncateProgress struct {
+	Scanned int64
+	Deleted int64
+}
+
+type truncateConfig struct {
+	segments    int32
+	concurrency int
+	options     []Option
+	progress    func(p TruncateProgress)
+}
+
+type TruncateOption func(c *truncateConfig)
+
+// TruncateSegments Scans the table with n parallel segments. The default is foundations.DefaultScanSegments.
+func TruncateSegments(n int32) TruncateOption {
+	return func(c *truncateConfig) {
+		c.segments = n
+	}
+}
+
+// TruncateConcurrency Runs at most n BatchWriteItem requests at once. The default is 4.
+func TruncateConcurrency(n int) TruncateOption {
+	return func(c *truncateConfig) {
+		c.concurrency = n
+	}
+}
+
+// TruncateWriterOptions Applies opt to the BatchWriteItem requests, e.g. MaxRetry and RetryPolicy.
+func TruncateWriterOptions(opt ...Option) TruncateOption {
+	return func(c *truncateConfig) {
+		c.options = append(c.options, opt...)
+	}
+}
+
+// OnTruncateProgress Calls f after every scanned page and every BatchWriteItem request. Calls are serialized.
+func OnTruncateProgress(f func(p TruncateProgress)) TruncateOption {
+	return func(c *truncateConfig) {
+		c.progress = f
+	}
+}
+
+// TruncateTable Deletes all the items of table. The key schema is taken from DescribeTable and only the keys are scanned,
+// with parallel segments whose pages are deleted by concurrent BatchWriteItem requests as they arrive.
+func TruncateTable(ctx context.Context, cli TruncateTableClient, table string, opt ...TruncateOption) (TruncateProgress, error) {
+	conf := &truncateConfig{segments: foundations.DefaultScanSegments, concurrency: 4}
+	for _, o := range opt {
+		o(conf)
+	}
+	var mu sync.Mutex
+	var progress TruncateProgress
+	update := func(f func(p *TruncateProgress)) {
+		mu.Lock()
+		defer mu.Unlock()
+		f(&progress)
+		if conf.progress != nil {
+			conf.progress(progress)
+		}
+	}
+	schema, err := foundations.DescribeKeySchema(ctx, cli, table)
+	if err != nil {
+		return progress, err
+	}
+	names := make([]expression.NameBuilder, 0, 2)
+	for _, name := range schema.Names() {
+		names = append(names, expression.Name(name))
+	}
+	expr, err := expression.NewBuilder().WithProjection(expression.NamesList(names[0], names[1:]...)).Build()
+	if err != nil {
+		return progress, errors.WithStack(err)
+	}
+	w := NewBulkWriter(ctx, cli, Concurrency(conf.concurrency), WriterOptions(conf.options...),
+		BulkMonitor(func(items map[string][]types.WriteRequest, err error) error {
+			update(func(p *TruncateProgress) { p.Deleted += int64(deletedCount(items, err)) })
+			return err
+		}))
+	_, err = foundations.ParallelScanPages(ctx, cli, func() (string, expression.Expression, error) {
+		return table, expr, nil
+	}, func(ctx context.Context, segment int32, items foundations.Records) error {
+		for _, v := range items {
+			if err := w.Delete(func() (string, map[string]types.AttributeValue, error) {
+				return table, v, nil
+			}); err != nil {
+				return err
+			}
+		}
+		update(func(p *TruncateProgress) { p.Scanned += int64(len(items)) })
+		return nil
+	}, foundations.Segments(conf.segments))
+	if err != nil {
+		_ = w.Close() // スキャンのエラーを優先する
+		return progress, err
+	}
+	err = w.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	return progress, err
+}
+
+// TruncateByRecreate Deletes all the items of table by deleting the table and creating it again
+// with the schema of migrate.Describe, which keeps the key schema, the secondary indexes and the time to live.
+// It is faster than TruncateTable for a large table, but the table is unavailable until it is created again.
+// The settings that the schema does not keep, such as the streams and the tags, would be lost,
+// so it returns migrate.ErrDroppedSettings without deleting a table that has them, unless they are given to migrate.DropSettings.
+func TruncateByRecreate(ctx context.Context, api migrate.MigrationApi, table string, maxWait time.Duration, opt ...migrate.RecreateOption) error {
+	schema, err := migrate.Describe(ctx, api, table)
 	if err != nil {
 		return err
 	}
-	return b.Run(ctx, db)
+	return schema.Recreate(ctx, api, maxWait, opt...)
 }
@@ -0,0 +1,180 @@
+package batches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/migrate"
+)
+
+func TestTruncateTable(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var projections []string
+	cli := dynamodbfake.New(dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if in, ok := input.(*dynamodb.ScanInput); ok && in.Segment != nil {
+			projections = append(projections, aws.ToString(in.ProjectionExpression))
+		}
+		return nil
+	}))
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String("events"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("sk"), AttributeType: types.ScalarAttributeTypeN},
+			{AttributeName: aws.String("kind"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("sk"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+			IndexName:  aws.String("kind-index"),
+			KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String("kind"), KeyType: types.KeyTypeHash}},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeKeysOnly},
+		}},
+		BillingMode: types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName:               aws.String("events"),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{AttributeName: aws.String("expires"), Enabled: aws.Bool(true)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	fill := func(n int) {
+		b := New()
+		for i := 0; i < n; i++ {
+			item := map[string]types.AttributeValue{
+				"pk":   &types.AttributeValueMemberS{Value: fmt.Sprintf("p%d", i%7)},
+				"sk":   &types.AttributeValueMemberN{Value: fmt.Sprint(i)},
+				"kind": &types.AttributeValueMemberS{Value: "event"},
+			}
+			b.Put(func() (string, map[string]types.AttributeValue, error) { return "events", item, nil })
+		}
+		if err := b.Run(ctx, cli); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func() int32 {
+		out, err := cli.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("events")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Count
+	}
+	fill(120)
+	var last TruncateProgress
+	res, err := TruncateTable(ctx, cli, "events", TruncateSegments(3), TruncateConcurrency(2), OnTruncateProgress(func(p TruncateProgress) {
+		last = p
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Scanned != 120 || res.Deleted != 120 || last != res {
+		t.Fatalf("unexpected progress: %+v %+v", res, last)
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("expected no items, got %d", n)
+	}
+	if _, ok := foundations.DefaultKeyRegistry.Lookup("events"); ok {
+		t.Fatal("expected the key schema not to be registered")
+	}
+	if len(projections) < 3 {
+		t.Fatalf("expected the segments to be scanned, got %d scans", len(projections))
+	}
+	for _, p := range projections {
+		if p == "" {
+			t.Fatal("expected the keys to be projected")
+		}
+	}
+
+	fill(10)
+	if err = TruncateByRecreate(ctx, cli, "events", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("expected no items, got %d", n)
+	}
+	desc, err := cli.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String("events")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(desc.Table.KeySchema) != 2 || len(desc.Table.GlobalSecondaryIndexes) != 1 {
+		t.Fatalf("expected the schema to be kept, got %+v", desc.Table)
+	}
+	ttl, err := cli.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String("events")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl.TimeToLiveDescription.TimeToLiveStatus != types.TimeToLiveStatusEnabled || aws.ToString(ttl.TimeToLiveDescription.AttributeName) != "expires" {
+		t.Fatalf("expected the time to live to be kept, got %+v", ttl.TimeToLiveDescription)
+	}
+}
+
+type streamsClient struct {
+	*dynamodbfake.Client
+}
+
+func (c streamsClient) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	out, err := c.Client.DescribeTable(ctx, params, optFns...)
+	if err == nil {
+		out.Table.StreamSpecification = &types.StreamSpecification{StreamEnabled: aws.Bool(true), StreamViewType: types.StreamViewTypeNewImage}
+	}
+	return out, err
+}
+
+func TestTruncateByRecreateDroppedSettings(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("events"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("events"),
+		Item:      map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	count := func() int32 {
+		out, err := cli.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("events")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Count
+	}
+	if err := TruncateByRecreate(ctx, streamsClient{cli}, "events", time.Second); !errors.Is(err, migrate.ErrDroppedSettings) {
+		t.Fatalf("expected the table not to be recreated, got %v", err)
+	}
+	// DescribeTableで分からない設定を確認できないクライアント
+	if err := TruncateByRecreate(ctx, struct{ migrate.MigrationApi }{cli}, "events", time.Second,
+		migrate.DropSettings(migrate.SettingPointInTimeRecovery, migrate.SettingTags)); !errors.Is(err, migrate.ErrDroppedSettings) {
+		t.Fatalf("expected the table not to be recreated, got %v", err)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("expected the item to be kept, got %d", n)
+	}
+	if err := TruncateByRecreate(ctx, streamsClient{cli}, "events", time.Second, migrate.DropSettings(migrate.SettingStream)); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("expected no items, got %d", n)
+	}
+}
@@ -0,0 +1,253 @@
+package capacity
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Units is the consumed capacity units.
+type Units struct {
+	CapacityUnits      float64
+	ReadCapacityUnits  float64
+	WriteCapacityUnits float64
+}
+
+func (u *Units) add(total, read, write *float64, isRead bool) {
+	u.CapacityUnits += aws.ToFloat64(total)
+	r, w := Split(total, read, write, isRead)
+	u.ReadCapacityUnits += r
+	u.WriteCapacityUnits += w
+}
+
+// Split Returns the read and write units of a consumed capacity.
+// The total units are counted as the kind of the request when the breakdown is not reported.
+func Split(total, read, write *float64, isRead bool) (readUnits, writeUnits float64) {
+	if read == nil && write == nil {
+		// 読み込みと書き込みの内訳が返らない場合は操作の種類で判断する
+		if isRead {
+			return aws.ToFloat64(total), 0
+		}
+		return 0, aws.ToFloat64(total)
+	}
+	return aws.ToFloat64(read), aws.ToFloat64(write)
+}
+
+func (u *Units) merge(v Units) {
+	u.CapacityUnits += v.CapacityUnits
+	u.ReadCapacityUnits += v.ReadCapacityUnits
+	u.WriteCapacityUnits += v.WriteCapacityUnits
+}
+
+// Usage is the capacity consumed by a table.
+type Usage struct {
+	// Units is the total of the table and the indexes.
+	Units
+	// Table and Indexes are reported only with types.ReturnConsumedCapacityIndexes.
+	Table   Units
+	Indexes map[string]Units
+	// Requests is the number of responses that reported the capacity of the table.
+	Requests int
+}
+
+// Collector sums the capacity consumed by the requests made with its context.
+type Collector struct {
+	level  types.ReturnConsumedCapacity
+	mu     sync.Mutex
+	tables map[string]*Usage
+}
+
+type collectorKey struct{}
+
+type requestedKey struct{}
+
+// With Returns a context that collects the consumed capacity.
+// level is types.ReturnConsumedCapacityIndexes if it is omitted.
+func With(ctx context.Context, level ...types.ReturnConsumedCapacity) (context.Context, *Collector) {
+	c := &Collector{
+		level:  types.ReturnConsumedCapacityIndexes,
+		tables: map[string]*Usage{},
+	}
+	if len(level) > 0 {
+		c.level = level[0]
+	}
+	return context.WithValue(ctx, collectorKey{}, c), c
+}
+
+func From(ctx context.Context) (*Collector, bool) {
+	c, ok := ctx.Value(collectorKey{}).(*Collector)
+	return c, ok
+}
+
+// Add Adds the consumed capacity. isRead tells the kind of the operation when only CapacityUnits are reported.
+func (c *Collector) Add(isRead bool, consumed ...types.ConsumedCapacity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cc := range consumed {
+		name := aws.ToString(cc.TableName)
+		u, ok := c.tables[name]
+		if !ok {
+			u = &Usage{}
+			c.tables[name] = u
+		}
+		u.Requests++
+		u.Units.add(cc.CapacityUnits, cc.ReadCapacityUnits, cc.WriteCapacityUnits, isRead)
+		if cc.Table != nil {
+			u.Table.add(cc.Table.CapacityUnits, cc.Table.ReadCapacityUnits, cc.Table.WriteCapacityUnits, isRead)
+		}
+		for _, indexes := range []map[string]types.Capacity{cc.GlobalSecondaryIndexes, cc.LocalSecondaryIndexes} {
+			for index, v := range indexes {
+				if u.Indexes == nil {
+					u.Indexes = map[string]Units{}
+				}
+				units := u.Indexes[index]
+				units.add(v.CapacityUnits, v.ReadCapacityUnits, v.WriteCapacityUnits, isRead)
+				u.Indexes[index] = units
+			}
+		}
+	}
+}
+
+// Tables Returns the usage per table.
+func (c *Collector) Tables() map[string]Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tables := make(map[string]Usage, len(c.tables))
+	for name, u := range c.tables {
+		v := *u
+		if u.Indexes != nil {
+			v.Indexes = make(map[string]Units, len(u.Indexes))
+			for index, units := range u.Indexes {
+				v.Indexes[index] = units
+			}
+		}
+		tables[name] = v
+	}
+	return tables
+}
+
+// Total Returns the total of all tables.
+func (c *Collector) Total() Units {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total Units
+	for _, u := range c.tables {
+		total.merge(u.Units)
+	}
+	return total
+}
+
+// Request Sets ReturnConsumedCapacity of input if ctx has a Collector and the input does not set it.
+// The returned context must be passed to Response. It is called by the clients of foundations.
+func Request(ctx context.Context, input any) context.Context {
+	c, ok := From(ctx)
+	if !ok || ctx.Value(requestedKey{}) != nil {
+		return ctx
+	}
+	switch in := input.(type) {
+	case *dynamodb.GetItemInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.PutItemInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.UpdateItemInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.DeleteItemInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.QueryInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.ScanInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.BatchWriteItemInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.BatchGetItemInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.TransactWriteItemsInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	case *dynamodb.TransactGetItemsInput:
+		in.ReturnConsumedCapacity = c.levelOf(in.ReturnConsumedCapacity)
+	default:
+		return ctx
+	}
+	// 二重に集計しないように内側のクライアントには渡さない
+	return context.WithValue(ctx, requestedKey{}, c)
+}
+
+func (c *Collector) levelOf(v types.ReturnConsumedCapacity) types.ReturnConsumedCapacity {
+	if v == "" {
+		return c.level
+	}
+	return v
+}
+
+// Response Adds the consumed capacity of the output of a successful request to the Collector of the context returned by Request.
+func Response(ctx context.Context, output any) {
+	c, ok := ctx.Value(requestedKey{}).(*Collector)
+	if !ok {
+		return
+	}
+	consumed, isRead := Consumed(output)
+	c.Add(isRead, consumed...)
+}
+
+// Consumed Returns the consumed capacity of the output of a request and whether the request reads items.
+func Consumed(output any) (consumed []types.ConsumedCapacity, isRead bool) {
+	var single *types.ConsumedCapacity
+	switch out := output.(type) {
+	case *dynamodb.GetItemOutput:
+		single, isRead = out.ConsumedCapacity, true
+	case *dynamodb.PutItemOutput:
+		single = out.ConsumedCapacity
+	case *dynamodb.UpdateItemOutput:
+		single = out.ConsumedCapacity
+	case *dynamodb.DeleteItemOutput:
+		single = out.ConsumedCapacity
+	case *dynamodb.QueryOutput:
+		single, isRead = out.ConsumedCapacity, true
+	case *dynamodb.ScanOutput:
+		single, isRead = out.ConsumedCapacity, true
+	case *dynamodb.BatchWriteItemOutput:
+		return out.ConsumedCapacity, false
+	case *dynamodb.BatchGetItemOutput:
+		return out.ConsumedCapacity, true
+	case *dynamodb.TransactWriteItemsOutput:
+		return out.ConsumedCapacity, false
+	case *dynamodb.TransactGetItemsOutput:
+		return out.ConsumedCapacity, true
+	}
+	if single == nil {
+		return nil, isRead
+	}
+	return []types.ConsumedCapacity{*single}, isRead
+}
+
+// Handler Collects the capacity consumed by each request and calls report after next.
+func Handler(next http.Handler, report func(r *http.Request, c *Collector), level ...types.ReturnConsumedCapacity) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, c := With(r.Context(), level...)
+		r = r.WithContext(ctx)
+		next.ServeHTTP(w, r)
+		report(r, c)
+	})
+}
+
+// AppendMiddlewares Collects the capacity consumed by the clients made from the options.
+// foundations.Setup appends it to the clients it makes.
+func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error) {
+	*apiOptions = append(*apiOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("DynamoDBVerseCapacity", func(
+			ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			ctx = Request(ctx, in.Parameters)
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			if err == nil {
+				Response(ctx, out.Result)
+			}
+			return out, metadata, err
+		}), middleware.After)
+	})
+}
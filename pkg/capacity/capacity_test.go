@@ -0,0 +1,121 @@
+package capacity_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/batches"
+	"github.com/goccha/dynamodb-verse/pkg/capacity"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/goccha/dynamodb-verse/pkg/transactions"
+)
+
+type Order struct {
+	ID     string `dynamodbav:"id" dynamodbkey:"hash"`
+	Status string `dynamodbav:"status" dynamodbindex:"status-index"`
+}
+
+func setup(t *testing.T) (context.Context, *foundations.DB) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String("orders"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("status"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+			IndexName:  aws.String("status-index"),
+			KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String("status"), KeyType: types.KeyTypeHash}},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}},
+		BillingMode: types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ctx, foundations.NewDB(cli)
+}
+
+func TestCollector(t *testing.T) {
+	ctx, db := setup(t)
+	repo, err := foundations.NewRepository[Order]("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, c := capacity.With(ctx)
+	orders := []Order{{ID: "o1", Status: "open"}, {ID: "o2", Status: "open"}, {ID: "o3", Status: "closed"}}
+	if err = batches.PutAll(ctx, db.Client(), repo, orders); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = transactions.New().Delete(repo.DeleteItem(&orders[2])).Run(ctx, db.Client()); err != nil {
+		t.Fatal(err)
+	}
+	key, err := repo.KeyCondition("status-index", "open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1件ずつページングしても全ページが集計される
+	list, err := repo.QueryByIndex(ctx, db.Client(), "status-index", key, options.Limit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("unexpected orders: %v", list)
+	}
+	usage, ok := c.Tables()["orders"]
+	if !ok {
+		t.Fatalf("expected the usage of orders, got %v", c.Tables())
+	}
+	if usage.Requests < 4 {
+		t.Fatalf("expected the capacity of every request, got %d", usage.Requests)
+	}
+	if usage.WriteCapacityUnits <= 0 || usage.ReadCapacityUnits <= 0 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if usage.Indexes["status-index"].CapacityUnits <= 0 {
+		t.Fatalf("expected the capacity of the index, got %+v", usage.Indexes)
+	}
+	if total := c.Total(); total != usage.Units {
+		t.Fatalf("unexpected total: %+v", total)
+	}
+
+	// 明示した設定は上書きしない
+	before := c.Total()
+	if _, err = repo.Get(ctx, db.Client(), repo.KeyOf("o1"), options.ReturnConsumedCapacity(types.ReturnConsumedCapacityNone)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Total() != before {
+		t.Fatal("expected no capacity")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ctx, db := setup(t)
+	repo, err := foundations.NewRepository[Order]("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Put(ctx, db.Client(), &Order{ID: "o1", Status: "open"}); err != nil {
+		t.Fatal(err)
+	}
+	var reported capacity.Units
+	h := capacity.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := repo.Get(r.Context(), db.Client(), repo.KeyOf("o1")); err != nil {
+			t.Error(err)
+		}
+	}), func(r *http.Request, c *capacity.Collector) {
+		reported = c.Total()
+	}, types.ReturnConsumedCapacityTotal)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/o1", nil))
+	if reported.ReadCapacityUnits != 0.5 {
+		t.Fatalf("unexpected capacity: %+v", reported)
+	}
+}
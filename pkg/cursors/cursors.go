@@ -0,0 +1,196 @@
+// Package cursors encodes pagination keys into opaque tokens that can be handed to API clients.
+// Tokens are signed or encrypted with application keys and bound to the query they were issued for.
+package cursors
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCursor is returned for tokens that are malformed, forged, signed with an unknown key
+// or issued for another query.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type Direction string
+
+const (
+	Forward  Direction = "f"
+	Backward Direction = "b"
+)
+
+type Cursor struct {
+	Key       foundations.EvaluatedKey `json:"k"`
+	Direction Direction                `json:"d"`
+}
+
+// Key is an application key. The ID is stored in the token to select the key on decode.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+const (
+	version    = 1
+	modeHMAC   = 'h'
+	modeAESGCM = 'g'
+)
+
+type sealer interface {
+	seal(header, payload, scope []byte) ([]byte, error)
+	open(header, sealed, scope []byte) ([]byte, error)
+}
+
+type hmacSealer struct {
+	secret []byte
+}
+
+func (s *hmacSealer) mac(header, payload, scope []byte) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write(header)
+	m.Write(scope)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+func (s *hmacSealer) seal(header, payload, scope []byte) ([]byte, error) {
+	return append(payload, s.mac(header, payload, scope)...), nil
+}
+
+func (s *hmacSealer) open(header, sealed, scope []byte) ([]byte, error) {
+	if len(sealed) < sha256.Size {
+		return nil, ErrInvalidCursor
+	}
+	payload, sum := sealed[:len(sealed)-sha256.Size], sealed[len(sealed)-sha256.Size:]
+	if !hmac.Equal(sum, s.mac(header, payload, scope)) {
+		return nil, ErrInvalidCursor
+	}
+	return payload, nil
+}
+
+type aeadSealer struct {
+	aead cipher.AEAD
+}
+
+func (s *aeadSealer) seal(header, payload, scope []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(payload)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return s.aead.Seal(nonce, nonce, payload, append(append([]byte{}, header...), scope...)), nil
+}
+
+func (s *aeadSealer) open(header, sealed, scope []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, ErrInvalidCursor
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	payload, err := s.aead.Open(nil, nonce, ciphertext, append(append([]byte{}, header...), scope...))
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return payload, nil
+}
+
+// Codec encodes cursors with the first key and decodes tokens issued with any of its keys,
+// so that keys can be rotated by prepending a new one.
+type Codec struct {
+	mode    byte
+	ids     []string
+	sealers map[string]sealer
+}
+
+// NewHMAC Returns a codec that signs cursors with HMAC-SHA256. The key is readable by clients but can not be modified.
+func NewHMAC(keys ...Key) (*Codec, error) {
+	return newCodec(modeHMAC, keys, func(k Key) (sealer, error) {
+		if len(k.Secret) < 16 {
+			return nil, fmt.Errorf("secret of key %s is too short", k.ID)
+		}
+		return &hmacSealer{secret: k.Secret}, nil
+	})
+}
+
+// NewAESGCM Returns a codec that encrypts cursors with AES-GCM. The secret must be 16, 24 or 32 bytes.
+func NewAESGCM(keys ...Key) (*Codec, error) {
+	return newCodec(modeAESGCM, keys, func(k Key) (sealer, error) {
+		block, err := aes.NewCipher(k.Secret)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return &aeadSealer{aead: aead}, nil
+	})
+}
+
+func newCodec(mode byte, keys []Key, f func(k Key) (sealer, error)) (*Codec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no keys")
+	}
+	c := &Codec{mode: mode, ids: make([]string, 0, len(keys)), sealers: make(map[string]sealer, len(keys))}
+	for _, k := range keys {
+		if k.ID == "" || len(k.ID) > 255 {
+			return nil, fmt.Errorf("invalid key id: %q", k.ID)
+		}
+		if _, ok := c.sealers[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id: %s", k.ID)
+		}
+		s, err := f(k)
+		if err != nil {
+			return nil, err
+		}
+		c.ids = append(c.ids, k.ID)
+		c.sealers[k.ID] = s
+	}
+	return c, nil
+}
+
+// Encode Returns the token of cursor for the query of scope.
+func (c *Codec) Encode(scope Scope, cursor Cursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	id := c.ids[0]
+	header := append([]byte{version, c.mode, byte(len(id))}, id...)
+	sealed, err := c.sealers[id].seal(header, payload, scope.hash())
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(append(header, sealed...)), nil
+}
+
+// Decode Returns the cursor of token. It fails with ErrInvalidCursor unless the token was issued for the query of scope.
+func (c *Codec) Decode(scope Scope, token string) (*Cursor, error) {
+	bin, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(bin) < 3 || bin[0] != version || bin[1] != c.mode || len(bin) < 3+int(bin[2]) {
+		return nil, ErrInvalidCursor
+	}
+	header := bin[:3+int(bin[2])]
+	s, ok := c.sealers[string(header[3:])]
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := s.open(header, bin[len(header):], scope.hash())
+	if err != nil {
+		return nil, err
+	}
+	cursor := &Cursor{}
+	if err = json.Unmarshal(payload, cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Direction != Forward && cursor.Direction != Backward {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
@@ -0,0 +1,207 @@
+package cursors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+type Event struct {
+	ID  string `dynamodbav:"id"`
+	Seq int    `dynamodbav:"seq"`
+}
+
+func scopeOf(t *testing.T, id string) Scope {
+	expr, err := expression.NewBuilder().WithKeyCondition(expression.Key("id").Equal(expression.Value(id))).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Scope{Table: "events", Expression: expr}
+}
+
+func TestCodec(t *testing.T) {
+	key1 := Key{ID: "k1", Secret: []byte("0123456789abcdef")}
+	key2 := Key{ID: "k2", Secret: []byte("fedcba9876543210")}
+	cursor := Cursor{Key: foundations.EvaluatedKey{
+		"id":  &types.AttributeValueMemberS{Value: "e"},
+		"seq": &types.AttributeValueMemberN{Value: "3"},
+		"bin": &types.AttributeValueMemberB{Value: []byte{0, 1, 2}},
+	}, Direction: Backward}
+	for name, f := range map[string]func(keys ...Key) (*Codec, error){"hmac": NewHMAC, "aesgcm": NewAESGCM} {
+		t.Run(name, func(t *testing.T) {
+			old, err := f(key1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := old.Encode(scopeOf(t, "e"), cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := old.Decode(scopeOf(t, "e"), token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Direction != Backward || len(v.Key) != 3 {
+				t.Fatalf("unexpected cursor: %+v", v)
+			}
+			if _, err = old.Decode(scopeOf(t, "other"), token); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("expected ErrInvalidCursor for another scope, got %v", err)
+			}
+			tampered := []byte(token)
+			i := len(tampered) / 2
+			if tampered[i] == 'A' {
+				tampered[i] = 'B'
+			} else {
+				tampered[i] = 'A'
+			}
+			if _, err = old.Decode(scopeOf(t, "e"), string(tampered)); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("expected ErrInvalidCursor for a tampered token, got %v", err)
+			}
+			// rotation
+			rotated, err := f(key2, key1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = rotated.Decode(scopeOf(t, "e"), token); err != nil {
+				t.Fatal(err)
+			}
+			token, err = rotated.Encode(scopeOf(t, "e"), cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = old.Decode(scopeOf(t, "e"), token); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("expected ErrInvalidCursor for an unknown key, got %v", err)
+			}
+		})
+	}
+	if _, err := NewHMAC(Key{ID: "short", Secret: []byte("short")}); err == nil {
+		t.Fatal("expected error for a short secret")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String("events"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("seq"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("seq"), KeyType: types.KeyTypeRange},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if _, err := foundations.Put(ctx, cli, foundations.PutItem(ctx, "events", Event{ID: "e", Seq: i})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	codec, err := NewAESGCM(Key{ID: "k1", Secret: []byte("0123456789abcdef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition := func(id string) foundations.QueryConditionFunc {
+		return func() (string, string, expression.Expression, error) {
+			expr, err := expression.NewBuilder().WithKeyCondition(expression.Key("id").Equal(expression.Value(id))).Build()
+			return "events", "", expr, err
+		}
+	}
+	seqs := func(p *Page[Event]) string {
+		var b strings.Builder
+		for _, v := range p.Items {
+			b.WriteByte(byte('0' + v.Seq))
+		}
+		return b.String()
+	}
+	var pages []string
+	page, err := Query[Event](ctx, cli, codec, condition("e"), "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Prev != "" {
+		t.Fatal("first page must not have a previous page")
+	}
+	pages = append(pages, seqs(page))
+	last := page
+	for page.Next != "" {
+		last = page
+		if page, err = Query[Event](ctx, cli, codec, condition("e"), page.Next, 3); err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Items) > 0 {
+			pages = append(pages, seqs(page))
+		}
+	}
+	if strings.Join(pages, ",") != "012,345,6" {
+		t.Fatalf("unexpected pages: %v", pages)
+	}
+	// back from the second page
+	if last.Prev == "" {
+		t.Fatal("second page must have a previous page")
+	}
+	prev, err := Query[Event](ctx, cli, codec, condition("e"), last.Prev, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqs(prev) != "012" {
+		t.Fatalf("unexpected previous page: %s", seqs(prev))
+	}
+	next, err := Query[Event](ctx, cli, codec, condition("e"), prev.Next, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqs(next) != "345" {
+		t.Fatalf("unexpected next page: %s", seqs(next))
+	}
+	if _, err = Query[Event](ctx, cli, codec, condition("other"), prev.Next, 3); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+	// the order of the index is part of the scope, the limit is not
+	if _, err = Query[Event](ctx, cli, codec, condition("e"), prev.Next, 3, options.ScanIndexForward(false)); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+	if _, err = Query[Event](ctx, cli, codec, condition("e"), prev.Next, 3, options.ScanIndexForward(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Query[Event](ctx, cli, codec, condition("e"), prev.Next, 3, options.Select(types.SelectCount)); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+	if next, err = Query[Event](ctx, cli, codec, condition("e"), prev.Next, 2); err != nil || seqs(next) != "34" {
+		t.Fatalf("unexpected next page: %s, %v", seqs(next), err)
+	}
+
+	// the items before the previous page were deleted
+	for i := 0; i < 3; i++ {
+		if _, err = cli.DeleteItem(ctx, &dynamodb.DeleteItemInput{TableName: aws.String("events"), Key: map[string]types.AttributeValue{
+			"id":  &types.AttributeValueMemberS{Value: "e"},
+			"seq": &types.AttributeValueMemberN{Value: fmt.Sprint(i)},
+		}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, err := Query[Event](ctx, cli, codec, condition("e"), last.Prev, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seqs(first) != "345" || first.Next == "" || first.Prev != "" {
+		t.Fatalf("expected the first page, got %s %+v", seqs(first), first)
+	}
+	if next, err = Query[Event](ctx, cli, codec, condition("e"), first.Next, 3); err != nil || seqs(next) != "6" {
+		t.Fatalf("unexpected next page: %s, %v", seqs(next), err)
+	}
+}
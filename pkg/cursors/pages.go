@@ -0,0 +1,131 @@
+package cursors
+
+import (
+	"context"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+type Page[T any] struct {
+	Items []T
+	// Next is the token of the next page, empty on the last page.
+	Next string
+	// Prev is the token of the previous page, empty on the first page.
+	Prev string
+}
+
+// Query Fetches the page of token, or the first page when token is empty, with at most limit items.
+// Backward tokens read the index in the reverse order from the start key and the items are returned in the query order.
+// If no item precedes the start key of a backward token any more, the first page is returned.
+func Query[T any](ctx context.Context, cli foundations.QueryClient, codec *Codec, condition foundations.QueryConditionFunc, token string, limit int32, opt ...options.Option) (*Page[T], error) {
+	table, index, expr, err := condition()
+	if err != nil {
+		return nil, err
+	}
+	scope := Scope{Table: table, Index: index, Expression: expr, Options: opt}
+	var cursor *Cursor
+	if token != "" {
+		if cursor, err = codec.Decode(scope, token); err != nil {
+			return nil, err
+		}
+	}
+	forward := scope.forward()
+	fetch := func(cursor *Cursor) (foundations.Records, *dynamodb.QueryOutput, error) {
+		opts := make([]options.Option, 0, len(opt)+3)
+		opts = append(opts, opt...)
+		opts = append(opts, options.Limit(limit))
+		if cursor != nil {
+			opts = append(opts, options.ExclusiveStartKey(cursor.Key))
+			if cursor.Direction == Backward {
+				opts = append(opts, options.ScanIndexForward(!forward))
+			}
+		}
+		var records foundations.Records
+		out, err := foundations.Query(ctx, cli, func() (string, string, expression.Expression, error) {
+			return table, index, expr, nil
+		}, func(tableName string, value foundations.Records) error {
+			records = value
+			return nil
+		}, opts...)
+		return records, out, err
+	}
+	records, out, err := fetch(cursor)
+	if err != nil {
+		if cursor == nil || cursor.Direction != Backward || !foundations.IsItemNotFound(err) {
+			return nil, err
+		}
+		records, out = nil, &dynamodb.QueryOutput{}
+	}
+	var names []string
+	if cursor != nil {
+		names = keyNames(cursor.Key)
+	}
+	if cursor != nil && cursor.Direction == Backward && len(records) == 0 {
+		// 前のページがなくなっていれば、最初のページを返す
+		cursor = nil
+		if records, out, err = fetch(nil); err != nil {
+			return nil, err
+		}
+	}
+	direction := Forward
+	if cursor != nil {
+		direction = cursor.Direction
+	}
+	if names == nil {
+		names = keyNames(out.LastEvaluatedKey)
+	}
+	if direction == Backward {
+		slices.Reverse(records)
+	}
+	page := &Page[T]{Items: make([]T, 0, len(records))}
+	if err = records.Unmarshal(ctx, &page.Items); err != nil {
+		return nil, err
+	}
+	encode := func(d Direction, key foundations.EvaluatedKey) (string, error) {
+		return codec.Encode(scope, Cursor{Key: key, Direction: d})
+	}
+	switch {
+	case direction == Forward:
+		if out.LastEvaluatedKey != nil {
+			if page.Next, err = encode(Forward, out.LastEvaluatedKey); err != nil {
+				return nil, err
+			}
+		}
+		if cursor != nil && len(records) > 0 {
+			if page.Prev, err = encode(Backward, keyOf(records[0], names)); err != nil {
+				return nil, err
+			}
+		}
+	case len(records) > 0:
+		if page.Next, err = encode(Forward, keyOf(records[len(records)-1], names)); err != nil {
+			return nil, err
+		}
+		if out.LastEvaluatedKey != nil {
+			if page.Prev, err = encode(Backward, keyOf(records[0], names)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return page, nil
+}
+
+func keyNames(key map[string]types.AttributeValue) []string {
+	names := make([]string, 0, len(key))
+	for k := range key {
+		names = append(names, k)
+	}
+	return names
+}
+
+func keyOf(item map[string]types.AttributeValue, names []string) foundations.EvaluatedKey {
+	key := make(foundations.EvaluatedKey, len(names))
+	for _, name := range names {
+		key[name] = item[name]
+	}
+	return key
+}
@@ -0,0 +1,130 @@
+package cursors
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+// Scope identifies the query a cursor belongs to.
+// Expression values are part of the scope, so a token can not be replayed with other key values.
+// Options are applied to the query before it is identified, so the order of the index and the expressions
+// set by the options are part of the scope. Limit and ExclusiveStartKey are not.
+type Scope struct {
+	Table      string
+	Index      string
+	Expression expression.Expression
+	Options    []options.Option
+}
+
+// input クエリの入力にオプションを適用する
+func (s Scope) input() *dynamodb.QueryInput {
+	var index *string
+	if s.Index != "" {
+		index = aws.String(s.Index)
+	}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.Table),
+		IndexName:                 index,
+		KeyConditionExpression:    s.Expression.KeyCondition(),
+		ExpressionAttributeNames:  s.Expression.Names(),
+		ExpressionAttributeValues: s.Expression.Values(),
+		FilterExpression:          s.Expression.Filter(),
+		ProjectionExpression:      s.Expression.Projection(),
+	}
+	for _, o := range s.Options {
+		input = o(input).(*dynamodb.QueryInput)
+	}
+	return input
+}
+
+// forward Returns the order of the index, ScanIndexForward of the options.
+func (s Scope) forward() bool {
+	v := s.input().ScanIndexForward
+	return v == nil || *v
+}
+
+func (s Scope) hash() []byte {
+	input := s.input()
+	doc := map[string]any{
+		"table":   aws.ToString(input.TableName),
+		"index":   aws.ToString(input.IndexName),
+		"forward": input.ScanIndexForward == nil || *input.ScanIndexForward,
+	}
+	if input.Select != "" {
+		doc["select"] = string(input.Select)
+	}
+	if v := input.KeyConditionExpression; v != nil {
+		doc["key"] = *v
+	}
+	if v := input.FilterExpression; v != nil {
+		doc["filter"] = *v
+	}
+	if v := input.ProjectionExpression; v != nil {
+		doc["projection"] = *v
+	}
+	if names := input.ExpressionAttributeNames; len(names) > 0 {
+		doc["names"] = names
+	}
+	if values := input.ExpressionAttributeValues; len(values) > 0 {
+		m := make(map[string]any, len(values))
+		for k, v := range values {
+			m[k] = canonical(v)
+		}
+		doc["values"] = m
+	}
+	// json.Marshal sorts the keys of maps
+	bin, _ := json.Marshal(doc)
+	sum := sha256.Sum256(bin)
+	return sum[:]
+}
+
+func canonical(av types.AttributeValue) any {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]any{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]any{"N": v.Value}
+	case *types.AttributeValueMemberB:
+		return map[string]any{"B": v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return map[string]any{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]any{"NULL": v.Value}
+	case *types.AttributeValueMemberSS:
+		return map[string]any{"SS": sorted(v.Value)}
+	case *types.AttributeValueMemberNS:
+		return map[string]any{"NS": sorted(v.Value)}
+	case *types.AttributeValueMemberBS:
+		values := make([]string, 0, len(v.Value))
+		for _, b := range v.Value {
+			values = append(values, string(b))
+		}
+		return map[string]any{"BS": sorted(values)}
+	case *types.AttributeValueMemberL:
+		list := make([]any, 0, len(v.Value))
+		for _, e := range v.Value {
+			list = append(list, canonical(e))
+		}
+		return map[string]any{"L": list}
+	case *types.AttributeValueMemberM:
+		m := make(map[string]any, len(v.Value))
+		for k, e := range v.Value {
+			m[k] = canonical(e)
+		}
+		return map[string]any{"M": m}
+	}
+	return nil
+}
+
+func sorted(values []string) []string {
+	s := append([]string(nil), values...)
+	sort.Strings(s)
+	return s
+}
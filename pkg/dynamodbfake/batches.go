@@ -0,0 +1,190 @@
+package dynamodbfake
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func sortedTables[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Client) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := c.before(ctx, "BatchWriteItem", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := 0
+	for _, requests := range params.RequestItems {
+		total += len(requests)
+	}
+	if total == 0 {
+		return nil, validation("1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Member must have length greater than or equal to 1")
+	}
+	if total > MaxBatchWriteItems {
+		return nil, validation("1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Map value must satisfy constraint: [Member must have length less than or equal to 25, Member must have length greater than or equal to 1]")
+	}
+	names := sortedTables(params.RequestItems)
+	// すべてのリクエストを検証してから書き込む
+	type write struct {
+		t   *table
+		put item
+		key item
+	}
+	writes := make([]write, 0, total)
+	for _, name := range names {
+		t, err := c.table(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, r := range params.RequestItems[name] {
+			var w write
+			switch {
+			case r.PutRequest != nil && r.DeleteRequest == nil:
+				if err = t.validateItem(r.PutRequest.Item); err != nil {
+					return nil, err
+				}
+				w = write{t: t, put: r.PutRequest.Item, key: t.primaryKey(r.PutRequest.Item)}
+			case r.DeleteRequest != nil && r.PutRequest == nil:
+				if err = t.validateKey(r.DeleteRequest.Key); err != nil {
+					return nil, err
+				}
+				w = write{t: t, key: r.DeleteRequest.Key}
+			default:
+				return nil, validation("Supplied AttributeValue has more than one datatypes set, must contain exactly one of the supported datatypes")
+			}
+			k := t.keyOf(w.key)
+			if seen[k] {
+				return nil, validation("Provided list of item keys contains duplicates")
+			}
+			seen[k] = true
+			writes = append(writes, w)
+		}
+	}
+	out := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	cc := newCapacity(params.ReturnConsumedCapacity, false)
+	processed := 0
+	i := 0
+	for _, name := range names {
+		for _, r := range params.RequestItems[name] {
+			w := writes[i]
+			i++
+			if c.batchWriteLimit > 0 && processed >= c.batchWriteLimit {
+				out.UnprocessedItems[name] = append(out.UnprocessedItems[name], r)
+				continue
+			}
+			processed++
+			old, exists := w.t.get(w.key)
+			if !exists {
+				old = nil
+			}
+			if w.put != nil {
+				m := cloneItem(w.put)
+				w.t.put(m)
+				cc.write(w.t, old, m, false)
+			} else {
+				if exists {
+					w.t.delete(w.key)
+				}
+				cc.write(w.t, old, nil, false)
+			}
+		}
+	}
+	out.ConsumedCapacity = cc.results()
+	return out, nil
+}
+
+func (c *Client) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if err := c.before(ctx, "BatchGetItem", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	total := 0
+	for _, ka := range params.RequestItems {
+		total += len(ka.Keys)
+	}
+	if total == 0 {
+		return nil, validation("1 validation error detected: Value at 'requestItems' failed to satisfy constraint: Member must have length greater than or equal to 1")
+	}
+	if total > MaxBatchGetItems {
+		return nil, validation("Too many items requested for the BatchGetItem call")
+	}
+	names := sortedTables(params.RequestItems)
+	tables := make(map[string]*table, len(names))
+	paths := make(map[string][]path, len(names))
+	for _, name := range names {
+		t, err := c.table(aws.String(name))
+		if err != nil {
+			return nil, err
+		}
+		tables[name] = t
+		ka := params.RequestItems[name]
+		seen := map[string]bool{}
+		for _, key := range ka.Keys {
+			if err = t.validateKey(key); err != nil {
+				return nil, err
+			}
+			k := t.keyOf(key)
+			if seen[k] {
+				return nil, validation("Provided list of item keys contains duplicates")
+			}
+			seen[k] = true
+		}
+		p := newParser(ka.ExpressionAttributeNames, nil)
+		if paths[name], err = p.projection(ka.ProjectionExpression, ka.AttributesToGet); err != nil {
+			return nil, err
+		}
+		if err = p.checkUnused(); err != nil {
+			return nil, err
+		}
+	}
+	out := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]types.AttributeValue{},
+		UnprocessedKeys: map[string]types.KeysAndAttributes{},
+	}
+	cc := newCapacity(params.ReturnConsumedCapacity, true)
+	processed := 0
+	for _, name := range names {
+		t := tables[name]
+		ka := params.RequestItems[name]
+		out.Responses[name] = []map[string]types.AttributeValue{}
+		for _, key := range ka.Keys {
+			if c.batchGetLimit > 0 && processed >= c.batchGetLimit {
+				unprocessed := out.UnprocessedKeys[name]
+				if unprocessed.Keys == nil {
+					unprocessed = ka
+					unprocessed.Keys = nil
+				}
+				unprocessed.Keys = append(unprocessed.Keys, key)
+				out.UnprocessedKeys[name] = unprocessed
+				continue
+			}
+			processed++
+			m, ok := t.get(key)
+			size := 0
+			if ok {
+				size = itemSize(m)
+				if paths[name] != nil {
+					out.Responses[name] = append(out.Responses[name], project(m, paths[name]))
+				} else {
+					out.Responses[name] = append(out.Responses[name], cloneItem(m))
+				}
+			}
+			cc.addTable(name, readUnits(size, aws.ToBool(ka.ConsistentRead), false))
+		}
+	}
+	out.ConsumedCapacity = cc.results()
+	return out, nil
+}
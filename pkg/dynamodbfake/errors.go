@@ -0,0 +1,48 @@
+package dynamodbfake
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+func validation(msg string) error {
+	return &smithy.GenericAPIError{Code: "ValidationException", Message: msg, Fault: smithy.FaultClient}
+}
+
+func validationf(format string, args ...any) error {
+	return validation(fmt.Sprintf(format, args...))
+}
+
+func resourceNotFound(table string) error {
+	return &types.ResourceNotFoundException{
+		Message: aws.String(fmt.Sprintf("Requested resource not found: Table: %s not found", table)),
+	}
+}
+
+func resourceInUse(table string) error {
+	return &types.ResourceInUseException{
+		Message: aws.String(fmt.Sprintf("Table already exists: %s", table)),
+	}
+}
+
+func conditionalCheckFailed(old item) error {
+	return &types.ConditionalCheckFailedException{
+		Message: aws.String("The conditional request failed"),
+		Item:    old,
+	}
+}
+
+func transactionCanceled(reasons []types.CancellationReason) error {
+	codes := make([]string, 0, len(reasons))
+	for _, r := range reasons {
+		codes = append(codes, aws.ToString(r.Code))
+	}
+	return &types.TransactionCanceledException{
+		Message:             aws.String(fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))),
+		CancellationReasons: reasons,
+	}
+}
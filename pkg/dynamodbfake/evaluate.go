@@ -0,0 +1,561 @@
+package dynamodbfake
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func resolve(m item, p path) (types.AttributeValue, bool) {
+	var current types.AttributeValue = &types.AttributeValueMemberM{Value: m}
+	for _, e := range p {
+		switch v := current.(type) {
+		case *types.AttributeValueMemberM:
+			if e.list {
+				return nil, false
+			}
+			next, ok := v.Value[e.name]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case *types.AttributeValueMemberL:
+			if !e.list || e.index >= len(v.Value) {
+				return nil, false
+			}
+			current = v.Value[e.index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func evaluateOperand(m item, op operand) (types.AttributeValue, bool, error) {
+	switch o := op.(type) {
+	case *valueOperand:
+		return o.value, true, nil
+	case *pathOperand:
+		v, ok := resolve(m, o.path)
+		return v, ok, nil
+	case *sizeOperand:
+		v, ok := resolve(m, o.path)
+		if !ok {
+			return nil, false, nil
+		}
+		var size int
+		switch val := v.(type) {
+		case *types.AttributeValueMemberS:
+			size = len(val.Value)
+		case *types.AttributeValueMemberB:
+			size = len(val.Value)
+		case *types.AttributeValueMemberSS:
+			size = len(val.Value)
+		case *types.AttributeValueMemberNS:
+			size = len(val.Value)
+		case *types.AttributeValueMemberBS:
+			size = len(val.Value)
+		case *types.AttributeValueMemberL:
+			size = len(val.Value)
+		case *types.AttributeValueMemberM:
+			size = len(val.Value)
+		default:
+			return nil, false, nil
+		}
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(size)}, true, nil
+	case *ifNotExistsOperand:
+		if v, ok := resolve(m, o.path); ok {
+			return v, true, nil
+		}
+		return evaluateOperand(m, o.value)
+	case *listAppendOperand:
+		left, ok1, err := evaluateOperand(m, o.left)
+		if err != nil {
+			return nil, false, err
+		}
+		right, ok2, err := evaluateOperand(m, o.right)
+		if err != nil {
+			return nil, false, err
+		}
+		l, lok := left.(*types.AttributeValueMemberL)
+		r, rok := right.(*types.AttributeValueMemberL)
+		if !ok1 || !ok2 {
+			return nil, false, validation("The provided expression refers to an attribute that does not exist in the item")
+		}
+		if !lok || !rok {
+			return nil, false, validation("Invalid UpdateExpression: Incorrect operand type for operator or function; operator or function: list_append, operand type: " + typeOf(left))
+		}
+		list := make([]types.AttributeValue, 0, len(l.Value)+len(r.Value))
+		list = append(list, l.Value...)
+		list = append(list, r.Value...)
+		return &types.AttributeValueMemberL{Value: list}, true, nil
+	case *arithmeticOperand:
+		left, ok1, err := evaluateOperand(m, o.left)
+		if err != nil {
+			return nil, false, err
+		}
+		right, ok2, err := evaluateOperand(m, o.right)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok1 || !ok2 {
+			return nil, false, validation("The provided expression refers to an attribute that does not exist in the item")
+		}
+		l, lok := left.(*types.AttributeValueMemberN)
+		r, rok := right.(*types.AttributeValueMemberN)
+		if !lok || !rok {
+			return nil, false, validationf("Invalid UpdateExpression: Incorrect operand type for operator or function; operator: %s, operand type: %s", o.op, typeOf(left))
+		}
+		a, _ := parseNumber(l.Value)
+		b, _ := parseNumber(r.Value)
+		if o.op == "+" {
+			a = new(big.Rat).Add(a, b)
+		} else {
+			a = new(big.Rat).Sub(a, b)
+		}
+		return &types.AttributeValueMemberN{Value: formatNumber(a)}, true, nil
+	}
+	return nil, false, fmt.Errorf("unsupported operand %T", op)
+}
+
+func evaluate(m item, c condition) (bool, error) {
+	switch cond := c.(type) {
+	case *andCondition:
+		l, err := evaluate(m, cond.left)
+		if err != nil || !l {
+			return false, err
+		}
+		return evaluate(m, cond.right)
+	case *orCondition:
+		l, err := evaluate(m, cond.left)
+		if err != nil || l {
+			return l, err
+		}
+		return evaluate(m, cond.right)
+	case *notCondition:
+		v, err := evaluate(m, cond.cond)
+		return !v, err
+	case *compareCondition:
+		left, ok1, err := evaluateOperand(m, cond.left)
+		if err != nil {
+			return false, err
+		}
+		right, ok2, err := evaluateOperand(m, cond.right)
+		if err != nil {
+			return false, err
+		}
+		if !ok1 || !ok2 {
+			return cond.op == "<>" && ok1 != ok2, nil
+		}
+		switch cond.op {
+		case "=":
+			return equal(left, right), nil
+		case "<>":
+			return !equal(left, right), nil
+		}
+		c, ok := compare(left, right)
+		if !ok {
+			return false, nil
+		}
+		switch cond.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		case ">=":
+			return c >= 0, nil
+		}
+	case *betweenCondition:
+		v, ok1, err := evaluateOperand(m, cond.value)
+		if err != nil {
+			return false, err
+		}
+		low, ok2, err := evaluateOperand(m, cond.low)
+		if err != nil {
+			return false, err
+		}
+		high, ok3, err := evaluateOperand(m, cond.high)
+		if err != nil {
+			return false, err
+		}
+		if !ok1 || !ok2 || !ok3 {
+			return false, nil
+		}
+		if c, ok := compare(low, high); ok && c > 0 {
+			return false, validation("Invalid ConditionExpression: The BETWEEN operator requires upper bound to be greater than or equal to lower bound")
+		}
+		c1, ok1 := compare(v, low)
+		c2, ok2 := compare(v, high)
+		return ok1 && ok2 && c1 >= 0 && c2 <= 0, nil
+	case *inCondition:
+		v, ok, err := evaluateOperand(m, cond.value)
+		if err != nil || !ok {
+			return false, err
+		}
+		for _, e := range cond.list {
+			other, ok, err := evaluateOperand(m, e)
+			if err != nil {
+				return false, err
+			}
+			if ok && equal(v, other) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *functionCondition:
+		return evaluateFunction(m, cond)
+	}
+	return false, fmt.Errorf("unsupported condition %T", c)
+}
+
+func evaluateFunction(m item, f *functionCondition) (bool, error) {
+	target, exists, err := evaluateOperand(m, f.args[0])
+	if err != nil {
+		return false, err
+	}
+	switch f.name {
+	case "attribute_exists":
+		return exists, nil
+	case "attribute_not_exists":
+		return !exists, nil
+	}
+	arg, ok, err := evaluateOperand(m, f.args[1])
+	if err != nil || !ok || !exists {
+		return false, err
+	}
+	switch f.name {
+	case "attribute_type":
+		s, ok := arg.(*types.AttributeValueMemberS)
+		if !ok {
+			return false, validation("Invalid ConditionExpression: Incorrect operand type for operator or function; operator or function: attribute_type")
+		}
+		switch s.Value {
+		case "S", "N", "B", "BOOL", "NULL", "SS", "NS", "BS", "L", "M":
+		default:
+			return false, validationf("Invalid ConditionExpression: Invalid attribute type name found; type: %s, valid types: { B,NULL,SS,BOOL,L,BS,N,NS,S,M }", s.Value)
+		}
+		return typeOf(target) == s.Value, nil
+	case "begins_with":
+		switch t := target.(type) {
+		case *types.AttributeValueMemberS:
+			if prefix, ok := arg.(*types.AttributeValueMemberS); ok {
+				return strings.HasPrefix(t.Value, prefix.Value), nil
+			}
+		case *types.AttributeValueMemberB:
+			if prefix, ok := arg.(*types.AttributeValueMemberB); ok {
+				return bytes.HasPrefix(t.Value, prefix.Value), nil
+			}
+		}
+		return false, nil
+	case "contains":
+		switch t := target.(type) {
+		case *types.AttributeValueMemberS:
+			if s, ok := arg.(*types.AttributeValueMemberS); ok {
+				return strings.Contains(t.Value, s.Value), nil
+			}
+		case *types.AttributeValueMemberB:
+			if s, ok := arg.(*types.AttributeValueMemberB); ok {
+				return bytes.Contains(t.Value, s.Value), nil
+			}
+		case *types.AttributeValueMemberSS:
+			for _, v := range t.Value {
+				if equal(&types.AttributeValueMemberS{Value: v}, arg) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberNS:
+			for _, v := range t.Value {
+				if equal(&types.AttributeValueMemberN{Value: v}, arg) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberBS:
+			for _, v := range t.Value {
+				if equal(&types.AttributeValueMemberB{Value: v}, arg) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberL:
+			for _, v := range t.Value {
+				if equal(v, arg) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported function %s", f.name)
+}
+
+// assign sets v at p. The parent of p must already exist.
+func assign(m item, p path, v types.AttributeValue) error {
+	if len(p) == 1 {
+		if p[0].list {
+			return validation("The document path provided in the update expression is invalid for update")
+		}
+		m[p[0].name] = v
+		return nil
+	}
+	parent, ok := resolve(m, p[:len(p)-1])
+	if !ok {
+		return validation("The document path provided in the update expression is invalid for update")
+	}
+	last := p[len(p)-1]
+	switch container := parent.(type) {
+	case *types.AttributeValueMemberM:
+		if last.list {
+			return validation("The document path provided in the update expression is invalid for update")
+		}
+		container.Value[last.name] = v
+	case *types.AttributeValueMemberL:
+		if !last.list {
+			return validation("The document path provided in the update expression is invalid for update")
+		}
+		if last.index < len(container.Value) {
+			container.Value[last.index] = v
+		} else {
+			container.Value = append(container.Value, v)
+		}
+	default:
+		return validation("The document path provided in the update expression is invalid for update")
+	}
+	return nil
+}
+
+func remove(m item, p path) {
+	if len(p) == 1 {
+		delete(m, p[0].name)
+		return
+	}
+	parent, ok := resolve(m, p[:len(p)-1])
+	if !ok {
+		return
+	}
+	last := p[len(p)-1]
+	switch container := parent.(type) {
+	case *types.AttributeValueMemberM:
+		delete(container.Value, last.name)
+	case *types.AttributeValueMemberL:
+		if last.list && last.index < len(container.Value) {
+			container.Value = append(container.Value[:last.index], container.Value[last.index+1:]...)
+		}
+	}
+}
+
+// applyUpdate applies u to a copy of old and returns the new item.
+func applyUpdate(old item, u *updateExpression) (item, error) {
+	values := make([]types.AttributeValue, 0, len(u.set))
+	for _, s := range u.set {
+		v, ok, err := evaluateOperand(old, s.value)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, validation("The provided expression refers to an attribute that does not exist in the item")
+		}
+		values = append(values, clone(v))
+	}
+	m := cloneItem(old)
+	for i, s := range u.set {
+		if err := assign(m, s.path, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	// リストの要素削除はインデックスがずれないよう後ろから行う
+	for i := len(u.remove) - 1; i >= 0; i-- {
+		remove(m, u.remove[i])
+	}
+	for _, a := range u.add {
+		arg := a.value.(*valueOperand).value
+		current, exists := resolve(m, a.path)
+		if !exists {
+			switch arg.(type) {
+			case *types.AttributeValueMemberN, *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+				if err := assign(m, a.path, clone(arg)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, validationf("Invalid UpdateExpression: Incorrect operand type for operator or function; operator: ADD, operand type: %s", typeOf(arg))
+		}
+		merged, err := addValue(current, arg)
+		if err != nil {
+			return nil, err
+		}
+		if err = assign(m, a.path, merged); err != nil {
+			return nil, err
+		}
+	}
+	for _, d := range u.delete {
+		arg := d.value.(*valueOperand).value
+		current, exists := resolve(m, d.path)
+		if !exists {
+			continue
+		}
+		rest, err := deleteValue(current, arg)
+		if err != nil {
+			return nil, err
+		}
+		if rest == nil {
+			remove(m, d.path)
+		} else if err = assign(m, d.path, rest); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func addValue(current, arg types.AttributeValue) (types.AttributeValue, error) {
+	switch c := current.(type) {
+	case *types.AttributeValueMemberN:
+		if a, ok := arg.(*types.AttributeValueMemberN); ok {
+			x, _ := parseNumber(c.Value)
+			y, _ := parseNumber(a.Value)
+			return &types.AttributeValueMemberN{Value: formatNumber(new(big.Rat).Add(x, y))}, nil
+		}
+	case *types.AttributeValueMemberSS:
+		if a, ok := arg.(*types.AttributeValueMemberSS); ok {
+			return &types.AttributeValueMemberSS{Value: union(c.Value, a.Value, func(s string) string { return s })}, nil
+		}
+	case *types.AttributeValueMemberNS:
+		if a, ok := arg.(*types.AttributeValueMemberNS); ok {
+			return &types.AttributeValueMemberNS{Value: union(c.Value, a.Value, canonicalNumber)}, nil
+		}
+	case *types.AttributeValueMemberBS:
+		if a, ok := arg.(*types.AttributeValueMemberBS); ok {
+			set := map[string]bool{}
+			res := make([][]byte, 0, len(c.Value)+len(a.Value))
+			for _, v := range append(append([][]byte{}, c.Value...), a.Value...) {
+				if !set[string(v)] {
+					set[string(v)] = true
+					res = append(res, v)
+				}
+			}
+			return &types.AttributeValueMemberBS{Value: res}, nil
+		}
+	}
+	return nil, validationf("An operand in the update expression has an incorrect data type")
+}
+
+func deleteValue(current, arg types.AttributeValue) (types.AttributeValue, error) {
+	switch c := current.(type) {
+	case *types.AttributeValueMemberSS:
+		if a, ok := arg.(*types.AttributeValueMemberSS); ok {
+			if rest := difference(c.Value, a.Value, func(s string) string { return s }); len(rest) > 0 {
+				return &types.AttributeValueMemberSS{Value: rest}, nil
+			}
+			return nil, nil
+		}
+	case *types.AttributeValueMemberNS:
+		if a, ok := arg.(*types.AttributeValueMemberNS); ok {
+			if rest := difference(c.Value, a.Value, canonicalNumber); len(rest) > 0 {
+				return &types.AttributeValueMemberNS{Value: rest}, nil
+			}
+			return nil, nil
+		}
+	case *types.AttributeValueMemberBS:
+		if a, ok := arg.(*types.AttributeValueMemberBS); ok {
+			set := map[string]bool{}
+			for _, v := range a.Value {
+				set[string(v)] = true
+			}
+			rest := make([][]byte, 0, len(c.Value))
+			for _, v := range c.Value {
+				if !set[string(v)] {
+					rest = append(rest, v)
+				}
+			}
+			if len(rest) > 0 {
+				return &types.AttributeValueMemberBS{Value: rest}, nil
+			}
+			return nil, nil
+		}
+	}
+	return nil, validationf("An operand in the update expression has an incorrect data type")
+}
+
+func canonicalNumber(s string) string {
+	if r, ok := parseNumber(s); ok {
+		return formatNumber(r)
+	}
+	return s
+}
+
+func union(a, b []string, key func(string) string) []string {
+	set := map[string]bool{}
+	res := make([]string, 0, len(a)+len(b))
+	for _, v := range append(append([]string{}, a...), b...) {
+		if k := key(v); !set[k] {
+			set[k] = true
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func difference(a, b []string, key func(string) string) []string {
+	set := map[string]bool{}
+	for _, v := range b {
+		set[key(v)] = true
+	}
+	res := make([]string, 0, len(a))
+	for _, v := range a {
+		if !set[key(v)] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// project returns a copy of m that only contains the given paths.
+func project(m item, paths []path) item {
+	res := item{}
+	root := &types.AttributeValueMemberM{Value: res}
+	for _, p := range paths {
+		projectInto(root, &types.AttributeValueMemberM{Value: m}, p)
+	}
+	return res
+}
+
+// projectInto copies the value at p of src into dst, creating the intermediate containers.
+func projectInto(dst, src types.AttributeValue, p path) types.AttributeValue {
+	if len(p) == 0 {
+		return clone(src)
+	}
+	e := p[0]
+	switch s := src.(type) {
+	case *types.AttributeValueMemberM:
+		child, ok := s.Value[e.name]
+		if e.list || !ok {
+			return dst
+		}
+		d, ok := dst.(*types.AttributeValueMemberM)
+		if !ok {
+			d = &types.AttributeValueMemberM{Value: item{}}
+		}
+		if v := projectInto(d.Value[e.name], child, p[1:]); v != nil {
+			d.Value[e.name] = v
+		}
+		return d
+	case *types.AttributeValueMemberL:
+		if !e.list || e.index >= len(s.Value) {
+			return dst
+		}
+		d, ok := dst.(*types.AttributeValueMemberL)
+		if !ok {
+			d = &types.AttributeValueMemberL{}
+		}
+		// リストの要素は射影した順に詰めて返す
+		if v := projectInto(nil, s.Value[e.index], p[1:]); v != nil {
+			d.Value = append(d.Value, v)
+		}
+		return d
+	}
+	return dst
+}
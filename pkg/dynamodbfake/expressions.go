@@ -0,0 +1,698 @@
+package dynamodbfake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokName
+	tokValue
+	tokNumber
+	tokLParen
+	tokRParen
+	tokComma
+	tokDot
+	tokLBracket
+	tokRBracket
+	tokCompare
+	tokPlus
+	tokMinus
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	tokens := make([]token, 0, 16)
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ","})
+			i++
+		case c == '.':
+			tokens = append(tokens, token{tokDot, "."})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokLBracket, "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokRBracket, "]"})
+			i++
+		case c == '+':
+			tokens = append(tokens, token{tokPlus, "+"})
+			i++
+		case c == '-':
+			tokens = append(tokens, token{tokMinus, "-"})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{tokCompare, "="})
+			i++
+		case c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(expr) && (expr[i+1] == '=' || (c == '<' && expr[i+1] == '>')) {
+				op += string(expr[i+1])
+			}
+			tokens = append(tokens, token{tokCompare, op})
+			i += len(op)
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(expr) && isWordChar(expr[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("syntax error; token: \"%c\", near: \"%s\"", c, near(expr, i))
+			}
+			kind := tokName
+			if c == ':' {
+				kind = tokValue
+			}
+			tokens = append(tokens, token{kind, expr[i:j]})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, expr[i:j]})
+			i = j
+		case isWordChar(c):
+			j := i
+			for j < len(expr) && isWordChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, expr[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("invalid character: \"%c\", near: \"%s\"", c, near(expr, i))
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func near(expr string, i int) string {
+	end := i + 10
+	if end > len(expr) {
+		end = len(expr)
+	}
+	return expr[i:end]
+}
+
+type pathElement struct {
+	name  string
+	index int
+	list  bool
+}
+
+type path []pathElement
+
+func (p path) String() string {
+	var b strings.Builder
+	for i, e := range p {
+		if e.list {
+			b.WriteString("[" + strconv.Itoa(e.index) + "]")
+		} else {
+			if i > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(e.name)
+		}
+	}
+	return b.String()
+}
+
+type operand interface{}
+
+type pathOperand struct{ path path }
+type valueOperand struct{ value types.AttributeValue }
+type sizeOperand struct{ path path }
+type ifNotExistsOperand struct {
+	path  path
+	value operand
+}
+type listAppendOperand struct{ left, right operand }
+type arithmeticOperand struct {
+	op          string
+	left, right operand
+}
+
+type condition interface{}
+
+type andCondition struct{ left, right condition }
+type orCondition struct{ left, right condition }
+type notCondition struct{ cond condition }
+type compareCondition struct {
+	op          string
+	left, right operand
+}
+type betweenCondition struct{ value, low, high operand }
+type inCondition struct {
+	value operand
+	list  []operand
+}
+type functionCondition struct {
+	name string
+	args []operand
+}
+
+type setAction struct {
+	path  path
+	value operand
+}
+
+type valueAction struct {
+	path  path
+	value operand
+}
+
+type updateExpression struct {
+	set    []setAction
+	remove []path
+	add    []valueAction
+	delete []valueAction
+}
+
+// parser resolves the expression attribute names and values of one request.
+type parser struct {
+	names      map[string]string
+	values     map[string]types.AttributeValue
+	usedNames  map[string]bool
+	usedValues map[string]bool
+	tokens     []token
+	pos        int
+	kind       string
+}
+
+func newParser(names map[string]string, values map[string]types.AttributeValue) *parser {
+	return &parser{
+		names:      names,
+		values:     values,
+		usedNames:  map[string]bool{},
+		usedValues: map[string]bool{},
+	}
+}
+
+// checkUnused reports names and values that were supplied but not referenced by any expression.
+func (p *parser) checkUnused() error {
+	var unused []string
+	for k := range p.names {
+		if !p.usedNames[k] {
+			unused = append(unused, k)
+		}
+	}
+	if len(unused) > 0 {
+		return validationf("Value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", strings.Join(unused, ", "))
+	}
+	for k := range p.values {
+		if !p.usedValues[k] {
+			unused = append(unused, k)
+		}
+	}
+	if len(unused) > 0 {
+		return validationf("Value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", strings.Join(unused, ", "))
+	}
+	return nil
+}
+
+func (p *parser) reset(kind, expr string) error {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return p.invalid(err.Error())
+	}
+	p.kind = kind
+	p.tokens = tokens
+	p.pos = 0
+	return nil
+}
+
+func (p *parser) invalid(msg string) error {
+	return validationf("Invalid %s: %s", p.kind, msg)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	t := p.next()
+	if t.kind != kind {
+		if t.kind == tokEOF {
+			return p.invalid(fmt.Sprintf("Syntax error; token: \"<EOF>\", expected: \"%s\"", text))
+		}
+		return p.invalid(fmt.Sprintf("Syntax error; token: \"%s\", expected: \"%s\"", t.text, text))
+	}
+	return nil
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokIdent && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) end() error {
+	if t := p.peek(); t.kind != tokEOF {
+		return p.invalid(fmt.Sprintf("Syntax error; token: \"%s\", near: \"%s\"", t.text, t.text))
+	}
+	return nil
+}
+
+func (p *parser) parseCondition(kind, expr string) (condition, error) {
+	if err := p.reset(kind, expr); err != nil {
+		return nil, err
+	}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.end()
+}
+
+func (p *parser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &orCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (condition, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &andCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (condition, error) {
+	if p.keyword("NOT") {
+		c, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &notCondition{cond: c}, nil
+	}
+	return p.primary()
+}
+
+var conditionFunctions = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+func (p *parser) primary() (condition, error) {
+	t := p.peek()
+	if t.kind == tokLParen {
+		p.next()
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	if t.kind == tokIdent && p.tokens[p.pos+1].kind == tokLParen {
+		if n, ok := conditionFunctions[strings.ToLower(t.text)]; ok {
+			p.next()
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			if len(args) != n {
+				return nil, p.invalid(fmt.Sprintf("Incorrect number of operands for operator or function; operator or function: %s, number of operands: %d", t.text, len(args)))
+			}
+			if _, ok := args[0].(*pathOperand); !ok {
+				return nil, p.invalid(fmt.Sprintf("Operator or function requires a document path; operator or function: %s", t.text))
+			}
+			return &functionCondition{name: strings.ToLower(t.text), args: args}, nil
+		}
+	}
+	left, err := p.operand(false)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.peek().kind == tokCompare:
+		op := p.next().text
+		right, err := p.operand(false)
+		if err != nil {
+			return nil, err
+		}
+		return &compareCondition{op: op, left: left, right: right}, nil
+	case p.keyword("BETWEEN"):
+		low, err := p.operand(false)
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.invalid("Syntax error; BETWEEN requires AND")
+		}
+		high, err := p.operand(false)
+		if err != nil {
+			return nil, err
+		}
+		return &betweenCondition{value: left, low: low, high: high}, nil
+	case p.keyword("IN"):
+		list, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		return &inCondition{value: left, list: list}, nil
+	}
+	t = p.peek()
+	if t.kind == tokEOF {
+		return nil, p.invalid("Syntax error; token: \"<EOF>\"")
+	}
+	return nil, p.invalid(fmt.Sprintf("Syntax error; token: \"%s\", near: \"%s\"", t.text, t.text))
+}
+
+func (p *parser) arguments() ([]operand, error) {
+	if err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	args := make([]operand, 0, 2)
+	for {
+		arg, err := p.operand(false)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().kind == tokComma {
+			p.next()
+			continue
+		}
+		break
+	}
+	return args, p.expect(tokRParen, ")")
+}
+
+// operand parses a path, value or function. update enables the functions of SET actions.
+func (p *parser) operand(update bool) (operand, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokValue:
+		p.next()
+		v, ok := p.values[t.text]
+		if !ok {
+			return nil, p.invalid(fmt.Sprintf("An expression attribute value used in expression is not defined; attribute value: %s", t.text))
+		}
+		p.usedValues[t.text] = true
+		return &valueOperand{value: v}, nil
+	case tokIdent, tokName:
+		if t.kind == tokIdent && p.tokens[p.pos+1].kind == tokLParen {
+			switch name := strings.ToLower(t.text); {
+			case name == "size":
+				p.next()
+				args, err := p.arguments()
+				if err != nil {
+					return nil, err
+				}
+				if len(args) != 1 {
+					return nil, p.invalid("Incorrect number of operands for operator or function; operator or function: size")
+				}
+				pp, ok := args[0].(*pathOperand)
+				if !ok {
+					return nil, p.invalid("Operator or function requires a document path; operator or function: size")
+				}
+				return &sizeOperand{path: pp.path}, nil
+			case update && name == "if_not_exists":
+				p.next()
+				if err := p.expect(tokLParen, "("); err != nil {
+					return nil, err
+				}
+				pp, err := p.path()
+				if err != nil {
+					return nil, err
+				}
+				if err = p.expect(tokComma, ","); err != nil {
+					return nil, err
+				}
+				v, err := p.operand(true)
+				if err != nil {
+					return nil, err
+				}
+				return &ifNotExistsOperand{path: pp, value: v}, p.expect(tokRParen, ")")
+			case update && name == "list_append":
+				p.next()
+				if err := p.expect(tokLParen, "("); err != nil {
+					return nil, err
+				}
+				left, err := p.operand(true)
+				if err != nil {
+					return nil, err
+				}
+				if err = p.expect(tokComma, ","); err != nil {
+					return nil, err
+				}
+				right, err := p.operand(true)
+				if err != nil {
+					return nil, err
+				}
+				return &listAppendOperand{left: left, right: right}, p.expect(tokRParen, ")")
+			default:
+				return nil, p.invalid(fmt.Sprintf("Invalid function name; function: %s", t.text))
+			}
+		}
+		pp, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		return &pathOperand{path: pp}, nil
+	case tokEOF:
+		return nil, p.invalid("Syntax error; token: \"<EOF>\"")
+	}
+	return nil, p.invalid(fmt.Sprintf("Syntax error; token: \"%s\", near: \"%s\"", t.text, t.text))
+}
+
+func (p *parser) path() (path, error) {
+	name, err := p.pathName()
+	if err != nil {
+		return nil, err
+	}
+	res := path{{name: name}}
+	for {
+		switch p.peek().kind {
+		case tokDot:
+			p.next()
+			if name, err = p.pathName(); err != nil {
+				return nil, err
+			}
+			res = append(res, pathElement{name: name})
+		case tokLBracket:
+			p.next()
+			t := p.next()
+			if t.kind != tokNumber {
+				return nil, p.invalid(fmt.Sprintf("Syntax error; token: \"%s\", expected: list index", t.text))
+			}
+			index, _ := strconv.Atoi(t.text)
+			if err = p.expect(tokRBracket, "]"); err != nil {
+				return nil, err
+			}
+			res = append(res, pathElement{index: index, list: true})
+		default:
+			return res, nil
+		}
+	}
+}
+
+func (p *parser) pathName() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokName:
+		name, ok := p.names[t.text]
+		if !ok {
+			return "", p.invalid(fmt.Sprintf("An expression attribute name used in the document path is not defined; attribute name: %s", t.text))
+		}
+		p.usedNames[t.text] = true
+		return name, nil
+	case tokIdent:
+		return t.text, nil
+	}
+	return "", p.invalid(fmt.Sprintf("Syntax error; token: \"%s\", expected: attribute name", t.text))
+}
+
+func (p *parser) parseProjection(expr string) ([]path, error) {
+	if err := p.reset("ProjectionExpression", expr); err != nil {
+		return nil, err
+	}
+	paths := make([]path, 0, 4)
+	for {
+		pp, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, pp)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return paths, p.overlaps(paths)
+}
+
+func (p *parser) parseUpdate(expr string) (*updateExpression, error) {
+	if err := p.reset("UpdateExpression", expr); err != nil {
+		return nil, err
+	}
+	u := &updateExpression{}
+	seen := map[string]bool{}
+	for p.peek().kind != tokEOF {
+		t := p.next()
+		clause := strings.ToUpper(t.text)
+		if t.kind != tokIdent || (clause != "SET" && clause != "REMOVE" && clause != "ADD" && clause != "DELETE") {
+			return nil, p.invalid(fmt.Sprintf("Syntax error; token: \"%s\", near: \"%s\"", t.text, t.text))
+		}
+		if seen[clause] {
+			return nil, p.invalid(fmt.Sprintf("The \"%s\" section can only be used once in an update expression;", clause))
+		}
+		seen[clause] = true
+		for {
+			pp, err := p.path()
+			if err != nil {
+				return nil, err
+			}
+			switch clause {
+			case "SET":
+				if err = p.expect(tokCompare, "="); err != nil {
+					return nil, err
+				}
+				v, err := p.setValue()
+				if err != nil {
+					return nil, err
+				}
+				u.set = append(u.set, setAction{path: pp, value: v})
+			case "REMOVE":
+				u.remove = append(u.remove, pp)
+			case "ADD", "DELETE":
+				v, err := p.operand(false)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := v.(*valueOperand); !ok {
+					return nil, p.invalid(fmt.Sprintf("Syntax error; %s requires a value", clause))
+				}
+				if clause == "ADD" {
+					u.add = append(u.add, valueAction{path: pp, value: v})
+				} else {
+					u.delete = append(u.delete, valueAction{path: pp, value: v})
+				}
+			}
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if len(seen) == 0 {
+		return nil, p.invalid("The expression can not be empty;")
+	}
+	paths := make([]path, 0, len(u.set)+len(u.remove)+len(u.add)+len(u.delete))
+	for _, s := range u.set {
+		paths = append(paths, s.path)
+	}
+	paths = append(paths, u.remove...)
+	for _, a := range u.add {
+		paths = append(paths, a.path)
+	}
+	for _, d := range u.delete {
+		paths = append(paths, d.path)
+	}
+	if err := p.overlaps(paths); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// overlaps rejects paths where one is a prefix of another.
+func (p *parser) overlaps(paths []path) error {
+	for i := range paths {
+		for j := i + 1; j < len(paths); j++ {
+			a, b := paths[i], paths[j]
+			if len(b) < len(a) {
+				a, b = b, a
+			}
+			prefix := true
+			for k := range a {
+				if a[k] != b[k] {
+					prefix = false
+					break
+				}
+			}
+			if prefix {
+				return p.invalid(fmt.Sprintf("Two document paths overlap with each other; must remove or rewrite one of these paths; path one: %s, path two: %s", paths[i], paths[j]))
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) setValue() (operand, error) {
+	left, err := p.operand(true)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokPlus || t.kind == tokMinus {
+		p.next()
+		right, err := p.operand(true)
+		if err != nil {
+			return nil, err
+		}
+		return &arithmeticOperand{op: t.text, left: left, right: right}, nil
+	}
+	return left, nil
+}
@@ -0,0 +1,254 @@
+// Package dynamodbfake provides an in-memory implementation of the DynamoDB client
+// that evaluates expressions the way DynamoDB does, for use in unit tests.
+package dynamodbfake
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	MaxItemSize        = 400 * 1024
+	MaxPageSize        = 1024 * 1024
+	MaxBatchWriteItems = 25
+	MaxBatchGetItems   = 100
+	MaxTransactItems   = 100
+)
+
+// RequestHook is called before every operation. Returning an error fails the operation with it.
+type RequestHook func(ctx context.Context, operation string, input any) error
+
+type Option func(c *Client)
+
+// WithRequestHook registers a hook called before every operation, e.g. to inject throttling errors.
+func WithRequestHook(hook RequestHook) Option {
+	return func(c *Client) {
+		c.hooks = append(c.hooks, hook)
+	}
+}
+
+// WithBatchWriteLimit processes at most n requests per BatchWriteItem call and
+// returns the rest as UnprocessedItems.
+func WithBatchWriteLimit(n int) Option {
+	return func(c *Client) {
+		c.batchWriteLimit = n
+	}
+}
+
+// WithBatchGetLimit processes at most n keys per BatchGetItem call and
+// returns the rest as UnprocessedKeys.
+func WithBatchGetLimit(n int) Option {
+	return func(c *Client) {
+		c.batchGetLimit = n
+	}
+}
+
+func New(opt ...Option) *Client {
+	c := &Client{
+		tables: map[string]*table{},
+	}
+	for _, o := range opt {
+		o(c)
+	}
+	return c
+}
+
+// Client is an in-memory DynamoDB. It is safe for concurrent use.
+type Client struct {
+	mu              sync.RWMutex
+	cache           sync.Mutex
+	tables          map[string]*table
+	hooks           []RequestHook
+	batchWriteLimit int
+	batchGetLimit   int
+}
+
+func (c *Client) before(ctx context.Context, operation string, input any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, h := range c.hooks {
+		if err := h(ctx, operation, input); err != nil {
+			return err
+		}
+	}
+	if input == nil {
+		return validation("1 validation error detected: input must not be null")
+	}
+	return nil
+}
+
+// Reset drops every table.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tables = map[string]*table{}
+}
+
+// capacity accumulates the capacity units consumed by one operation.
+type capacity struct {
+	mode    types.ReturnConsumedCapacity
+	read    bool
+	total   map[string]float64
+	tables  map[string]float64
+	indexes map[string]map[string]float64
+	local   map[string]map[string]bool
+	order   []string
+}
+
+func newCapacity(mode types.ReturnConsumedCapacity, read bool) *capacity {
+	return &capacity{
+		mode:    mode,
+		read:    read,
+		total:   map[string]float64{},
+		tables:  map[string]float64{},
+		indexes: map[string]map[string]float64{},
+		local:   map[string]map[string]bool{},
+	}
+}
+
+func (c *capacity) touch(table string) {
+	if _, ok := c.total[table]; !ok {
+		c.total[table] = 0
+		c.order = append(c.order, table)
+	}
+}
+
+func (c *capacity) addTable(table string, units float64) {
+	c.touch(table)
+	c.total[table] += units
+	c.tables[table] += units
+}
+
+func (c *capacity) addIndex(t *table, idx *index, units float64) {
+	c.touch(t.name)
+	c.total[t.name] += units
+	if c.indexes[t.name] == nil {
+		c.indexes[t.name] = map[string]float64{}
+		c.local[t.name] = map[string]bool{}
+	}
+	c.indexes[t.name][idx.name] += units
+	c.local[t.name][idx.name] = !idx.global
+}
+
+// readUnits returns the read capacity units for size bytes.
+func readUnits(size int, consistent bool, transactional bool) float64 {
+	units := math.Ceil(float64(size) / 4096)
+	if units == 0 {
+		units = 1
+	}
+	switch {
+	case transactional:
+		return units * 2
+	case consistent:
+		return units
+	}
+	return units / 2
+}
+
+// writeUnits returns the write capacity units for size bytes.
+func writeUnits(size int, transactional bool) float64 {
+	units := math.Ceil(float64(size) / 1024)
+	if units == 0 {
+		units = 1
+	}
+	if transactional {
+		return units * 2
+	}
+	return units
+}
+
+// write records the units of a write to t, including the affected indexes.
+func (c *capacity) write(t *table, old, new item, transactional bool) {
+	size := 0
+	if old != nil {
+		size = itemSize(old)
+	}
+	if new != nil && itemSize(new) > size {
+		size = itemSize(new)
+	}
+	c.addTable(t.name, writeUnits(size, transactional))
+	for _, name := range t.indexNames() {
+		idx := t.indexes[name]
+		oldIn := old != nil && idx.contains(old)
+		newIn := new != nil && idx.contains(new)
+		switch {
+		case oldIn && newIn:
+			// キーが変わった場合は削除と追加の2回分の書き込みになる
+			units := writeUnits(itemSize(new), false)
+			if !equal(old[idx.hashKey], new[idx.hashKey]) || (idx.rangeKey != "" && !equal(old[idx.rangeKey], new[idx.rangeKey])) {
+				units += writeUnits(itemSize(old), false)
+			}
+			c.addIndex(t, idx, units)
+		case oldIn:
+			c.addIndex(t, idx, writeUnits(itemSize(old), false))
+		case newIn:
+			c.addIndex(t, idx, writeUnits(itemSize(new), false))
+		}
+	}
+}
+
+func (c *capacity) result(table string) *types.ConsumedCapacity {
+	switch c.mode {
+	case types.ReturnConsumedCapacityTotal, types.ReturnConsumedCapacityIndexes:
+	default:
+		return nil
+	}
+	total, ok := c.total[table]
+	if !ok {
+		return nil
+	}
+	cc := &types.ConsumedCapacity{
+		TableName:     aws.String(table),
+		CapacityUnits: aws.Float64(total),
+	}
+	if c.read {
+		cc.ReadCapacityUnits = aws.Float64(total)
+	} else {
+		cc.WriteCapacityUnits = aws.Float64(total)
+	}
+	if c.mode == types.ReturnConsumedCapacityIndexes {
+		cc.Table = c.units(c.tables[table])
+		for name, units := range c.indexes[table] {
+			if c.local[table][name] {
+				if cc.LocalSecondaryIndexes == nil {
+					cc.LocalSecondaryIndexes = map[string]types.Capacity{}
+				}
+				cc.LocalSecondaryIndexes[name] = *c.units(units)
+			} else {
+				if cc.GlobalSecondaryIndexes == nil {
+					cc.GlobalSecondaryIndexes = map[string]types.Capacity{}
+				}
+				cc.GlobalSecondaryIndexes[name] = *c.units(units)
+			}
+		}
+	}
+	return cc
+}
+
+func (c *capacity) units(units float64) *types.Capacity {
+	cp := &types.Capacity{CapacityUnits: aws.Float64(units)}
+	if c.read {
+		cp.ReadCapacityUnits = aws.Float64(units)
+	} else {
+		cp.WriteCapacityUnits = aws.Float64(units)
+	}
+	return cp
+}
+
+func (c *capacity) results() []types.ConsumedCapacity {
+	res := make([]types.ConsumedCapacity, 0, len(c.order))
+	for _, table := range c.order {
+		if cc := c.result(table); cc != nil {
+			res = append(res, *cc)
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
@@ -0,0 +1,226 @@
+package dynamodbfake_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/batches"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/migrate"
+	"github.com/goccha/dynamodb-verse/pkg/transactions"
+)
+
+var (
+	_ foundations.Client     = (*dynamodbfake.Client)(nil)
+	_ batches.WriteClient    = (*dynamodbfake.Client)(nil)
+	_ batches.GetClient      = (*dynamodbfake.Client)(nil)
+	_ transactions.Client    = (*dynamodbfake.Client)(nil)
+	_ migrate.MigrationApi   = (*dynamodbfake.Client)(nil)
+	_ batches.TruncateClient = (*dynamodbfake.Client)(nil)
+)
+
+type Order struct {
+	UserID  string `dynamodbav:"user_id"`
+	OrderID string `dynamodbav:"order_id"`
+	Status  string `dynamodbav:"status"`
+	Amount  int    `dynamodbav:"amount"`
+}
+
+func setup(t *testing.T) (context.Context, *dynamodbfake.Client) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	_, err := migrate.NewSchema("orders").
+		Attributes(migrate.NewStringAttribute("user_id"), migrate.NewStringAttribute("order_id"), migrate.NewStringAttribute("status")).
+		Keys(migrate.NewHashKey("user_id"), migrate.NewRangeKey("order_id")).
+		GlobalSecondaryIndex(migrate.NewSecondaryIndex("status-index", migrate.NewKeys(migrate.NewHashKey("status"), migrate.NewRangeKey("order_id")))).
+		Build(ctx, cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := batches.New()
+	for _, o := range []Order{
+		{UserID: "u1", OrderID: "o1", Status: "open", Amount: 10},
+		{UserID: "u1", OrderID: "o2", Status: "closed", Amount: 20},
+		{UserID: "u1", OrderID: "o3", Status: "open", Amount: 30},
+		{UserID: "u2", OrderID: "o4", Status: "open", Amount: 40},
+	} {
+		b.Put(batches.PutItems(foundations.PutItem(ctx, "orders", o))...)
+	}
+	if err = b.Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	return ctx, cli
+}
+
+func orderKey(userID, orderID string) foundations.GetKeyFunc {
+	return func() (string, map[string]types.AttributeValue, []string, error) {
+		return "orders", map[string]types.AttributeValue{
+			"user_id":  &types.AttributeValueMemberS{Value: userID},
+			"order_id": &types.AttributeValueMemberS{Value: orderID},
+		}, nil, nil
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx, cli := setup(t)
+	var orders []Order
+	_, err := foundations.Query(ctx, cli, func() (string, string, expression.Expression, error) {
+		expr, err := expression.NewBuilder().
+			WithKeyCondition(expression.Key("user_id").Equal(expression.Value("u1"))).
+			WithFilter(expression.Name("amount").GreaterThan(expression.Value(10))).
+			Build()
+		return "orders", "", expr, err
+	}, foundations.FetchItems(ctx, &orders))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 || orders[0].OrderID != "o2" || orders[1].OrderID != "o3" {
+		t.Fatalf("unexpected orders: %v", orders)
+	}
+
+	orders = nil
+	_, err = foundations.Query(ctx, cli, func() (string, string, expression.Expression, error) {
+		expr, err := expression.NewBuilder().
+			WithKeyCondition(expression.Key("status").Equal(expression.Value("open"))).
+			Build()
+		return "orders", "status-index", expr, err
+	}, foundations.FetchItems(ctx, &orders))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 3 {
+		t.Fatalf("unexpected orders: %v", orders)
+	}
+}
+
+func TestQueryPagination(t *testing.T) {
+	ctx, cli := setup(t)
+	var keys []string
+	var start map[string]types.AttributeValue
+	for {
+		out, err := cli.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String("orders"),
+			KeyConditionExpression:    aws.String("user_id = :u"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":u": &types.AttributeValueMemberS{Value: "u1"}},
+			ScanIndexForward:          aws.Bool(false),
+			ExclusiveStartKey:         start,
+			Limit:                     aws.Int32(2),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range out.Items {
+			keys = append(keys, item["order_id"].(*types.AttributeValueMemberS).Value)
+		}
+		if start = out.LastEvaluatedKey; start == nil {
+			break
+		}
+	}
+	if len(keys) != 3 || keys[0] != "o3" || keys[2] != "o1" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestConditionalUpdate(t *testing.T) {
+	ctx, cli := setup(t)
+	update := foundations.WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		_, key, _, _ := orderKey("u1", "o1")()
+		expr, err := expression.NewBuilder().
+			WithUpdate(expression.Set(expression.Name("status"), expression.Value("closed")).
+				Add(expression.Name("amount"), expression.Value(5))).
+			WithCondition(expression.Name("status").Equal(expression.Value("open"))).
+			Build()
+		return "orders", key, expr, err
+	})
+	if _, err := foundations.Update(ctx, cli, update); err != nil {
+		t.Fatal(err)
+	}
+	var order Order
+	if _, err := foundations.Get(ctx, cli, orderKey("u1", "o1"), foundations.FetchItem(ctx, &order)); err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != "closed" || order.Amount != 15 {
+		t.Fatalf("unexpected order: %v", order)
+	}
+	_, err := foundations.Update(ctx, cli, update)
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		t.Fatalf("expected ConditionalCheckFailedException, got %v", err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	ctx, cli := setup(t)
+	_, err := transactions.New().
+		Put(foundations.PutItem(ctx, "orders", Order{UserID: "u3", OrderID: "o5", Status: "open"})).
+		Delete(foundations.WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+			_, key, _, _ := orderKey("u1", "o2")()
+			expr, err := expression.NewBuilder().
+				WithCondition(expression.Name("status").Equal(expression.Value("open"))).
+				Build()
+			return "orders", key, expr, err
+		})).Run(ctx, cli)
+	var tce *types.TransactionCanceledException
+	if !errors.As(err, &tce) {
+		t.Fatalf("expected TransactionCanceledException, got %v", err)
+	}
+	if len(tce.CancellationReasons) != 2 || aws.ToString(tce.CancellationReasons[1].Code) != "ConditionalCheckFailed" {
+		t.Fatalf("unexpected reasons: %v", tce.CancellationReasons)
+	}
+	out, err := cli.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("orders"),
+		Key: map[string]types.AttributeValue{
+			"user_id":  &types.AttributeValueMemberS{Value: "u3"},
+			"order_id": &types.AttributeValueMemberS{Value: "o5"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Item != nil {
+		t.Fatal("canceled transaction was applied")
+	}
+}
+
+func TestBatchGetUnprocessed(t *testing.T) {
+	ctx, src := setup(t)
+	cli := dynamodbfake.New(dynamodbfake.WithBatchGetLimit(1))
+	out, err := src.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("orders")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrate.NewSchema("orders").
+		Attributes(migrate.NewStringAttribute("user_id"), migrate.NewStringAttribute("order_id")).
+		Keys(migrate.NewHashKey("user_id"), migrate.NewRangeKey("order_id")).
+		Build(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range out.Items {
+		if _, err = cli.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("orders"), Item: item}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var orders []Order
+	_, err = batches.Get(orderKey("u1", "o1"), orderKey("u1", "o2"), orderKey("u2", "o4")).
+		Run(ctx, cli, func(tableName string, value foundations.Records) error {
+			var list []Order
+			if err := attributevalue.UnmarshalListOfMaps(value, &list); err != nil {
+				return err
+			}
+			orders = append(orders, list...)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 3 {
+		t.Fatalf("unexpected orders: %v", orders)
+	}
+}
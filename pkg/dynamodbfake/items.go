@@ -0,0 +1,321 @@
+package dynamodbfake
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func (p *parser) condition(expr *string) (condition, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	return p.parseCondition("ConditionExpression", *expr)
+}
+
+func (p *parser) projection(expr *string, attrs []string) ([]path, error) {
+	if expr != nil {
+		if len(attrs) > 0 {
+			return nil, validation("Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {AttributesToGet} Expression parameters: {ProjectionExpression}")
+		}
+		return p.parseProjection(*expr)
+	}
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+	paths := make([]path, 0, len(attrs))
+	for _, a := range attrs {
+		paths = append(paths, path{{name: a}})
+	}
+	return paths, nil
+}
+
+// check evaluates the condition of a write against the current item.
+func check(cond condition, current item, exists bool, onFailure types.ReturnValuesOnConditionCheckFailure) error {
+	if cond == nil {
+		return nil
+	}
+	target := current
+	if !exists {
+		target = item{}
+	}
+	ok, err := evaluate(target, cond)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		var old item
+		if exists && onFailure == types.ReturnValuesOnConditionCheckFailureAllOld {
+			old = cloneItem(current)
+		}
+		return conditionalCheckFailed(old)
+	}
+	return nil
+}
+
+func (c *Client) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if err := c.before(ctx, "GetItem", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.validateKey(params.Key); err != nil {
+		return nil, err
+	}
+	p := newParser(params.ExpressionAttributeNames, nil)
+	paths, err := p.projection(params.ProjectionExpression, params.AttributesToGet)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkUnused(); err != nil {
+		return nil, err
+	}
+	out := &dynamodb.GetItemOutput{}
+	cc := newCapacity(params.ReturnConsumedCapacity, true)
+	m, ok := t.get(params.Key)
+	size := 0
+	if ok {
+		size = itemSize(m)
+		if paths != nil {
+			out.Item = project(m, paths)
+		} else {
+			out.Item = cloneItem(m)
+		}
+	}
+	cc.addTable(t.name, readUnits(size, aws.ToBool(params.ConsistentRead), false))
+	out.ConsumedCapacity = cc.result(t.name)
+	return out, nil
+}
+
+func (c *Client) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if err := c.before(ctx, "PutItem", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Expected) > 0 {
+		return nil, validation("Expected is not supported; use ConditionExpression")
+	}
+	switch params.ReturnValues {
+	case "", types.ReturnValueNone, types.ReturnValueAllOld:
+	default:
+		return nil, validation("ReturnValues can only be ALL_OLD or NONE")
+	}
+	if err = t.validateItem(params.Item); err != nil {
+		return nil, err
+	}
+	p := newParser(params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	cond, err := p.condition(params.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkUnused(); err != nil {
+		return nil, err
+	}
+	old, exists := t.get(params.Item)
+	if err = check(cond, old, exists, params.ReturnValuesOnConditionCheckFailure); err != nil {
+		return nil, err
+	}
+	m := cloneItem(params.Item)
+	t.put(m)
+	out := &dynamodb.PutItemOutput{}
+	if exists && params.ReturnValues == types.ReturnValueAllOld {
+		out.Attributes = cloneItem(old)
+	}
+	cc := newCapacity(params.ReturnConsumedCapacity, false)
+	cc.write(t, old, m, false)
+	out.ConsumedCapacity = cc.result(t.name)
+	return out, nil
+}
+
+func (c *Client) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if err := c.before(ctx, "UpdateItem", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Expected) > 0 {
+		return nil, validation("Expected is not supported; use ConditionExpression")
+	}
+	if err = t.validateKey(params.Key); err != nil {
+		return nil, err
+	}
+	p := newParser(params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	u, err := p.update(params.UpdateExpression, params.AttributeUpdates)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := p.condition(params.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkUnused(); err != nil {
+		return nil, err
+	}
+	old, exists := t.get(params.Key)
+	if err = check(cond, old, exists, params.ReturnValuesOnConditionCheckFailure); err != nil {
+		return nil, err
+	}
+	m, err := t.update(old, exists, params.Key, u)
+	if err != nil {
+		return nil, err
+	}
+	t.put(m)
+	out := &dynamodb.UpdateItemOutput{}
+	out.Attributes, err = updateReturnValues(params.ReturnValues, old, m, u)
+	if err != nil {
+		return nil, err
+	}
+	cc := newCapacity(params.ReturnConsumedCapacity, false)
+	if exists {
+		cc.write(t, old, m, false)
+	} else {
+		cc.write(t, nil, m, false)
+	}
+	out.ConsumedCapacity = cc.result(t.name)
+	return out, nil
+}
+
+func (p *parser) update(expr *string, updates map[string]types.AttributeValueUpdate) (*updateExpression, error) {
+	if expr != nil {
+		if len(updates) > 0 {
+			return nil, validation("Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {AttributeUpdates} Expression parameters: {UpdateExpression}")
+		}
+		return p.parseUpdate(*expr)
+	}
+	u := &updateExpression{}
+	for name, v := range updates {
+		pp := path{{name: name}}
+		switch v.Action {
+		case "", types.AttributeActionPut:
+			u.set = append(u.set, setAction{path: pp, value: &valueOperand{value: v.Value}})
+		case types.AttributeActionAdd:
+			u.add = append(u.add, valueAction{path: pp, value: &valueOperand{value: v.Value}})
+		case types.AttributeActionDelete:
+			if v.Value == nil {
+				u.remove = append(u.remove, pp)
+			} else {
+				u.delete = append(u.delete, valueAction{path: pp, value: &valueOperand{value: v.Value}})
+			}
+		}
+	}
+	return u, nil
+}
+
+// update applies u to the current item, or to a new item made of key.
+func (t *table) update(old item, exists bool, key item, u *updateExpression) (item, error) {
+	base := old
+	if !exists {
+		base = cloneItem(key)
+	}
+	m, err := applyUpdate(base, u)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range t.keys() {
+		if !equal(m[k], base[k]) {
+			return nil, validationf("One or more parameter values were invalid: Cannot update attribute %s. This attribute is part of the key", k)
+		}
+	}
+	if err = t.validateItem(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func updateReturnValues(rv types.ReturnValue, old, m item, u *updateExpression) (item, error) {
+	switch rv {
+	case "", types.ReturnValueNone:
+		return nil, nil
+	case types.ReturnValueAllOld:
+		return cloneItem(old), nil
+	case types.ReturnValueAllNew:
+		return cloneItem(m), nil
+	case types.ReturnValueUpdatedOld, types.ReturnValueUpdatedNew:
+		paths := make([]path, 0, len(u.set)+len(u.remove)+len(u.add)+len(u.delete))
+		for _, s := range u.set {
+			paths = append(paths, s.path)
+		}
+		paths = append(paths, u.remove...)
+		for _, a := range u.add {
+			paths = append(paths, a.path)
+		}
+		for _, d := range u.delete {
+			paths = append(paths, d.path)
+		}
+		src := m
+		if rv == types.ReturnValueUpdatedOld {
+			src = old
+		}
+		if src == nil {
+			return nil, nil
+		}
+		if res := project(src, paths); len(res) > 0 {
+			return res, nil
+		}
+		return nil, nil
+	}
+	return nil, validationf("Invalid ReturnValues: %s", rv)
+}
+
+func (c *Client) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if err := c.before(ctx, "DeleteItem", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Expected) > 0 {
+		return nil, validation("Expected is not supported; use ConditionExpression")
+	}
+	switch params.ReturnValues {
+	case "", types.ReturnValueNone, types.ReturnValueAllOld:
+	default:
+		return nil, validation("ReturnValues can only be ALL_OLD or NONE")
+	}
+	if err = t.validateKey(params.Key); err != nil {
+		return nil, err
+	}
+	p := newParser(params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	cond, err := p.condition(params.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkUnused(); err != nil {
+		return nil, err
+	}
+	old, exists := t.get(params.Key)
+	if err = check(cond, old, exists, params.ReturnValuesOnConditionCheckFailure); err != nil {
+		return nil, err
+	}
+	out := &dynamodb.DeleteItemOutput{}
+	cc := newCapacity(params.ReturnConsumedCapacity, false)
+	if exists {
+		t.delete(params.Key)
+		if params.ReturnValues == types.ReturnValueAllOld {
+			out.Attributes = cloneItem(old)
+		}
+		cc.write(t, old, nil, false)
+	} else {
+		cc.addTable(t.name, writeUnits(0, false))
+	}
+	out.ConsumedCapacity = cc.result(t.name)
+	return out, nil
+}
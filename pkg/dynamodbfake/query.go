@@ -0,0 +1,511 @@
+package dynamodbfake
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// entry is the position of an item in a table or an index.
+type entry struct {
+	hash      string
+	rng       types.AttributeValue
+	tableHash string
+	tableRng  types.AttributeValue
+	key       string
+}
+
+func compareRange(a, b types.AttributeValue) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	c, _ := compare(a, b)
+	return c
+}
+
+func compareEntries(a, b entry) int {
+	if c := strings.Compare(a.hash, b.hash); c != 0 {
+		return c
+	}
+	if c := compareRange(a.rng, b.rng); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.tableHash, b.tableHash); c != 0 {
+		return c
+	}
+	return compareRange(a.tableRng, b.tableRng)
+}
+
+// source is a table or one of its indexes.
+type source struct {
+	t   *table
+	idx *index
+}
+
+func (s source) hashKey() string {
+	if s.idx != nil {
+		return s.idx.hashKey
+	}
+	return s.t.hashKey
+}
+
+func (s source) rangeKey() string {
+	if s.idx != nil {
+		return s.idx.rangeKey
+	}
+	return s.t.rangeKey
+}
+
+func (s source) entryOf(m item) entry {
+	e := entry{
+		hash: encodeKey(m[s.hashKey()]),
+		key:  s.t.keyOf(m),
+	}
+	if s.rangeKey() != "" {
+		e.rng = m[s.rangeKey()]
+	}
+	if s.idx != nil {
+		e.tableHash = encodeKey(m[s.t.hashKey])
+		if s.t.rangeKey != "" {
+			e.tableRng = m[s.t.rangeKey]
+		}
+	}
+	return e
+}
+
+// entries returns the items of the source in key order.
+// The caller must hold Client.cache as the cache is built under the read lock.
+func (s source) entries() []entry {
+	if s.idx == nil && s.t.entries != nil {
+		return s.t.entries
+	}
+	if s.idx != nil && s.idx.entries != nil {
+		return s.idx.entries
+	}
+	entries := make([]entry, 0, len(s.t.items))
+	for _, m := range s.t.items {
+		if s.idx == nil || s.idx.contains(m) {
+			entries = append(entries, s.entryOf(m))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return compareEntries(entries[i], entries[j]) < 0
+	})
+	if s.idx == nil {
+		s.t.entries = entries
+	} else {
+		s.idx.entries = entries
+	}
+	return entries
+}
+
+// lastEvaluatedKey returns the key attributes DynamoDB uses to resume after m.
+func (s source) lastEvaluatedKey(m item) map[string]types.AttributeValue {
+	key := s.t.primaryKey(m)
+	if s.idx != nil {
+		for _, k := range s.idx.keys() {
+			key[k] = clone(m[k])
+		}
+	}
+	return key
+}
+
+func (s source) startEntry(key map[string]types.AttributeValue) (*entry, error) {
+	if key == nil {
+		return nil, nil
+	}
+	names := s.t.keys()
+	if s.idx != nil {
+		names = append(names, s.idx.keys()...)
+	}
+	for _, k := range names {
+		if _, ok := key[k]; !ok {
+			return nil, validation("The provided starting key is invalid: The provided key element does not match the schema")
+		}
+	}
+	e := s.entryOf(key)
+	return &e, nil
+}
+
+// project applies the projection of the index and the requested projection to m.
+func (s source) project(m item, paths []path, selection types.Select) item {
+	if selection == types.SelectCount {
+		return nil
+	}
+	if s.idx != nil && s.idx.global {
+		switch s.idx.projection.ProjectionType {
+		case types.ProjectionTypeKeysOnly:
+			m = s.lastEvaluatedKey(m)
+		case types.ProjectionTypeInclude:
+			projected := s.lastEvaluatedKey(m)
+			for _, a := range s.idx.projection.NonKeyAttributes {
+				if v, ok := m[a]; ok {
+					projected[a] = v
+				}
+			}
+			m = projected
+		}
+	}
+	if paths != nil {
+		return project(m, paths)
+	}
+	return cloneItem(m)
+}
+
+func (c *Client) source(t *table, indexName *string, consistent *bool) (source, error) {
+	if indexName == nil {
+		return source{t: t}, nil
+	}
+	idx, ok := t.indexes[*indexName]
+	if !ok {
+		return source{}, validationf("The table does not have the specified index: %s", *indexName)
+	}
+	if idx.global && aws.ToBool(consistent) {
+		return source{}, validation("Consistent reads are not supported on global secondary indexes")
+	}
+	return source{t: t, idx: idx}, nil
+}
+
+func selection(sel types.Select, projection *string, attrs []string) (types.Select, error) {
+	switch sel {
+	case "":
+		if projection != nil || len(attrs) > 0 {
+			return types.SelectSpecificAttributes, nil
+		}
+		return types.SelectAllAttributes, nil
+	case types.SelectSpecificAttributes:
+		return sel, nil
+	case types.SelectAllAttributes, types.SelectAllProjectedAttributes, types.SelectCount:
+		if projection != nil || len(attrs) > 0 {
+			return "", validationf("Cannot specify the AttributesToGet or ProjectionExpression when choosing to get %s", sel)
+		}
+		return sel, nil
+	}
+	return "", validationf("Invalid Select: %s", sel)
+}
+
+// keyCondition validates a KeyConditionExpression and returns the partition key value.
+func keyCondition(cond condition, s source) (types.AttributeValue, error) {
+	var leaves []condition
+	var walk func(c condition) bool
+	walk = func(c condition) bool {
+		if and, ok := c.(*andCondition); ok {
+			return walk(and.left) && walk(and.right)
+		}
+		switch c.(type) {
+		case *compareCondition, *betweenCondition, *functionCondition:
+			leaves = append(leaves, c)
+			return true
+		}
+		return false
+	}
+	if !walk(cond) || len(leaves) == 0 || len(leaves) > 2 {
+		return nil, validation("Invalid operator used in KeyConditionExpression")
+	}
+	var hash types.AttributeValue
+	ranged := false
+	for _, leaf := range leaves {
+		name, value, err := keyConditionOperand(leaf)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case name == s.hashKey() && hash == nil:
+			cmp, ok := leaf.(*compareCondition)
+			if !ok || cmp.op != "=" {
+				return nil, validation("Query key condition not supported")
+			}
+			hash = value
+		case name == s.rangeKey() && s.rangeKey() != "" && !ranged:
+			if cmp, ok := leaf.(*compareCondition); ok && cmp.op == "<>" {
+				return nil, validation("Unsupported operator on KeyConditionExpression: operator: <>")
+			}
+			if f, ok := leaf.(*functionCondition); ok && f.name != "begins_with" {
+				return nil, validationf("Invalid KeyConditionExpression: Invalid function name; function: %s", f.name)
+			}
+			ranged = true
+		default:
+			return nil, validationf("Query condition missed key schema element: %s", s.hashKey())
+		}
+	}
+	if hash == nil {
+		return nil, validationf("Query condition missed key schema element: %s", s.hashKey())
+	}
+	if typeOf(hash) != string(s.t.attributes[s.hashKey()]) {
+		return nil, validation("One or more parameter values were invalid: Condition parameter type does not match schema type")
+	}
+	return hash, nil
+}
+
+func keyConditionOperand(c condition) (string, types.AttributeValue, error) {
+	var target, value operand
+	switch cond := c.(type) {
+	case *compareCondition:
+		target, value = cond.left, cond.right
+		if _, ok := target.(*valueOperand); ok {
+			target, value = value, target
+		}
+	case *betweenCondition:
+		target, value = cond.value, cond.low
+	case *functionCondition:
+		target, value = cond.args[0], cond.args[len(cond.args)-1]
+	}
+	p, ok := target.(*pathOperand)
+	if !ok || len(p.path) != 1 {
+		return "", nil, validation("Invalid condition in KeyConditionExpression: Multiple attribute names used in one condition")
+	}
+	v, ok := value.(*valueOperand)
+	if !ok {
+		return "", nil, validation("Invalid condition in KeyConditionExpression: Condition parameter must be a value")
+	}
+	return p.path[0].name, v.value, nil
+}
+
+// page collects the items of one Query or Scan response.
+type page struct {
+	items     []map[string]types.AttributeValue
+	count     int32
+	scanned   int32
+	size      int
+	last      map[string]types.AttributeValue
+	limit     int
+	limited   bool
+	selection types.Select
+}
+
+// add evaluates m and reports whether the page can take more items.
+func (pg *page) add(s source, m item, filter condition, paths []path) (bool, error) {
+	pg.scanned++
+	pg.size += itemSize(m)
+	if filter != nil {
+		ok, err := evaluate(m, filter)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			pg.count++
+			if pg.selection != types.SelectCount {
+				pg.items = append(pg.items, s.project(m, paths, pg.selection))
+			}
+		}
+	} else {
+		pg.count++
+		if pg.selection != types.SelectCount {
+			pg.items = append(pg.items, s.project(m, paths, pg.selection))
+		}
+	}
+	if (pg.limit > 0 && int(pg.scanned) >= pg.limit) || pg.size >= MaxPageSize {
+		pg.last = s.lastEvaluatedKey(m)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c *Client) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if err := c.before(ctx, "Query", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.KeyConditions) > 0 || len(params.QueryFilter) > 0 {
+		return nil, validation("KeyConditions and QueryFilter are not supported; use KeyConditionExpression and FilterExpression")
+	}
+	if params.KeyConditionExpression == nil {
+		return nil, validation("Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.")
+	}
+	if params.Limit != nil && *params.Limit <= 0 {
+		return nil, validation("1 validation error detected: Value at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1")
+	}
+	s, err := c.source(t, params.IndexName, params.ConsistentRead)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := selection(params.Select, params.ProjectionExpression, params.AttributesToGet)
+	if err != nil {
+		return nil, err
+	}
+	p := newParser(params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	keyCond, err := p.parseCondition("KeyConditionExpression", *params.KeyConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := keyCondition(keyCond, s)
+	if err != nil {
+		return nil, err
+	}
+	var filter condition
+	if params.FilterExpression != nil {
+		if filter, err = p.parseCondition("FilterExpression", *params.FilterExpression); err != nil {
+			return nil, err
+		}
+	}
+	paths, err := p.projection(params.ProjectionExpression, params.AttributesToGet)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkUnused(); err != nil {
+		return nil, err
+	}
+	start, err := s.startEntry(params.ExclusiveStartKey)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Lock()
+	entries := s.entries()
+	c.cache.Unlock()
+	hashKey := encodeKey(hash)
+	lo := sort.Search(len(entries), func(i int) bool { return entries[i].hash >= hashKey })
+	hi := sort.Search(len(entries), func(i int) bool { return entries[i].hash > hashKey })
+	forward := params.ScanIndexForward == nil || *params.ScanIndexForward
+	pg := &page{limit: int(aws.ToInt32(params.Limit)), selection: sel}
+	for n := 0; n < hi-lo; n++ {
+		i := lo + n
+		if !forward {
+			i = hi - 1 - n
+		}
+		e := entries[i]
+		if start != nil {
+			c := compareEntries(e, *start)
+			if (forward && c <= 0) || (!forward && c >= 0) {
+				continue
+			}
+		}
+		m := t.items[e.key]
+		ok, err := evaluate(m, keyCond)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		more, err := pg.add(s, m, filter, paths)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	cc := newCapacity(params.ReturnConsumedCapacity, true)
+	units := readUnits(pg.size, aws.ToBool(params.ConsistentRead), false)
+	if s.idx != nil {
+		cc.addIndex(t, s.idx, units)
+	} else {
+		cc.addTable(t.name, units)
+	}
+	return &dynamodb.QueryOutput{
+		ConsumedCapacity: cc.result(t.name),
+		Count:            pg.count,
+		Items:            pg.items,
+		LastEvaluatedKey: pg.last,
+		ScannedCount:     pg.scanned,
+	}, nil
+}
+
+func segmentOf(hash string, total int32) int32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(hash))
+	return int32(h.Sum32() % uint32(total))
+}
+
+func (c *Client) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if err := c.before(ctx, "Scan", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.ScanFilter) > 0 {
+		return nil, validation("ScanFilter is not supported; use FilterExpression")
+	}
+	if params.Limit != nil && *params.Limit <= 0 {
+		return nil, validation("1 validation error detected: Value at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1")
+	}
+	if (params.Segment == nil) != (params.TotalSegments == nil) {
+		return nil, validation("The TotalSegments parameter is required but was not present in the request when Segment parameter is present")
+	}
+	if params.TotalSegments != nil {
+		if *params.TotalSegments < 1 || *params.TotalSegments > 1000000 {
+			return nil, validation("1 validation error detected: Value at 'totalSegments' failed to satisfy constraint: Member must have value between 1 and 1000000")
+		}
+		if *params.Segment < 0 || *params.Segment >= *params.TotalSegments {
+			return nil, validationf("The Segment parameter is zero-based and must be less than parameter TotalSegments: Segment: %d is not less than TotalSegments: %d", *params.Segment, *params.TotalSegments)
+		}
+	}
+	s, err := c.source(t, params.IndexName, params.ConsistentRead)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := selection(params.Select, params.ProjectionExpression, params.AttributesToGet)
+	if err != nil {
+		return nil, err
+	}
+	p := newParser(params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	var filter condition
+	if params.FilterExpression != nil {
+		if filter, err = p.parseCondition("FilterExpression", *params.FilterExpression); err != nil {
+			return nil, err
+		}
+	}
+	paths, err := p.projection(params.ProjectionExpression, params.AttributesToGet)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkUnused(); err != nil {
+		return nil, err
+	}
+	start, err := s.startEntry(params.ExclusiveStartKey)
+	if err != nil {
+		return nil, err
+	}
+	pg := &page{limit: int(aws.ToInt32(params.Limit)), selection: sel}
+	c.cache.Lock()
+	entries := s.entries()
+	c.cache.Unlock()
+	for _, e := range entries {
+		if start != nil && compareEntries(e, *start) <= 0 {
+			continue
+		}
+		if params.TotalSegments != nil && segmentOf(e.hash, *params.TotalSegments) != *params.Segment {
+			continue
+		}
+		more, err := pg.add(s, t.items[e.key], filter, paths)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	cc := newCapacity(params.ReturnConsumedCapacity, true)
+	units := readUnits(pg.size, aws.ToBool(params.ConsistentRead), false)
+	if s.idx != nil {
+		cc.addIndex(t, s.idx, units)
+	} else {
+		cc.addTable(t.name, units)
+	}
+	return &dynamodb.ScanOutput{
+		ConsumedCapacity: cc.result(t.name),
+		Count:            pg.count,
+		Items:            pg.items,
+		LastEvaluatedKey: pg.last,
+		ScannedCount:     pg.scanned,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package dynamodbfake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The settings below are not supported, so every table reports them as disabled or empty.
+
+// tableOfArn returns the table of a resource ARN.
+func (c *Client) tableOfArn(arn *string) (*table, error) {
+	if arn == nil || *arn == "" {
+		return nil, validation("1 validation error detected: Value null at 'resourceArn' failed to satisfy constraint: Member must not be null")
+	}
+	_, name, ok := strings.Cut(*arn, ":table/")
+	if !ok {
+		return nil, validationf("Invalid TableArn: %s", *arn)
+	}
+	return c.table(aws.String(name))
+}
+
+func (c *Client) DescribeContinuousBackups(ctx context.Context, params *dynamodb.DescribeContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeContinuousBackupsOutput, error) {
+	if err := c.before(ctx, "DescribeContinuousBackups", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, err := c.table(params.TableName); err != nil {
+		return nil, err
+	}
+	return &dynamodb.DescribeContinuousBackupsOutput{ContinuousBackupsDescription: &types.ContinuousBackupsDescription{
+		ContinuousBackupsStatus: types.ContinuousBackupsStatusEnabled,
+		PointInTimeRecoveryDescription: &types.PointInTimeRecoveryDescription{
+			PointInTimeRecoveryStatus: types.PointInTimeRecoveryStatusDisabled,
+		},
+	}}, nil
+}
+
+func (c *Client) DescribeKinesisStreamingDestination(ctx context.Context, params *dynamodb.DescribeKinesisStreamingDestinationInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeKinesisStreamingDestinationOutput, error) {
+	if err := c.before(ctx, "DescribeKinesisStreamingDestination", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, err := c.table(params.TableName); err != nil {
+		return nil, err
+	}
+	return &dynamodb.DescribeKinesisStreamingDestinationOutput{TableName: params.TableName}, nil
+}
+
+func (c *Client) DescribeContributorInsights(ctx context.Context, params *dynamodb.DescribeContributorInsightsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeContributorInsightsOutput, error) {
+	if err := c.before(ctx, "DescribeContributorInsights", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if params.IndexName != nil {
+		if idx, ok := t.indexes[*params.IndexName]; !ok || !idx.global {
+			return nil, resourceNotFound(fmt.Sprintf("%s/index/%s", t.name, *params.IndexName))
+		}
+	}
+	return &dynamodb.DescribeContributorInsightsOutput{
+		TableName:                 params.TableName,
+		IndexName:                 params.IndexName,
+		ContributorInsightsStatus: types.ContributorInsightsStatusDisabled,
+	}, nil
+}
+
+func (c *Client) GetResourcePolicy(ctx context.Context, params *dynamodb.GetResourcePolicyInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetResourcePolicyOutput, error) {
+	if err := c.before(ctx, "GetResourcePolicy", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, err := c.tableOfArn(params.ResourceArn); err != nil {
+		return nil, err
+	}
+	return nil, &types.PolicyNotFoundException{Message: aws.String(fmt.Sprintf("Resource-based policy not found for the provided ResourceArn: %s", *params.ResourceArn))}
+}
+
+func (c *Client) ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error) {
+	if err := c.before(ctx, "ListTagsOfResource", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, err := c.tableOfArn(params.ResourceArn); err != nil {
+		return nil, err
+	}
+	return &dynamodb.ListTagsOfResourceOutput{}, nil
+}
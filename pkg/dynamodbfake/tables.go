@@ -0,0 +1,650 @@
+package dynamodbfake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type index struct {
+	name       string
+	hashKey    string
+	rangeKey   string
+	global     bool
+	projection types.Projection
+	throughput types.ProvisionedThroughputDescription
+	entries    []entry
+}
+
+func (idx *index) keys() []string {
+	if idx.rangeKey != "" {
+		return []string{idx.hashKey, idx.rangeKey}
+	}
+	return []string{idx.hashKey}
+}
+
+// contains reports whether the item is written to the index.
+func (idx *index) contains(m item) bool {
+	if _, ok := m[idx.hashKey]; !ok {
+		return false
+	}
+	if idx.rangeKey != "" {
+		if _, ok := m[idx.rangeKey]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type table struct {
+	name        string
+	attributes  map[string]types.ScalarAttributeType
+	hashKey     string
+	rangeKey    string
+	billingMode types.BillingMode
+	throughput  types.ProvisionedThroughputDescription
+	tableClass  types.TableClass
+	ttl         *types.TimeToLiveDescription
+	created     time.Time
+	indexes     map[string]*index
+	items       map[string]item
+	entries     []entry
+}
+
+func (t *table) keys() []string {
+	if t.rangeKey != "" {
+		return []string{t.hashKey, t.rangeKey}
+	}
+	return []string{t.hashKey}
+}
+
+func (t *table) arn() string {
+	return fmt.Sprintf("arn:aws:dynamodb:ddblocal:000000000000:table/%s", t.name)
+}
+
+// keyOf returns the storage key of an item or a primary key.
+func (t *table) keyOf(m item) string {
+	h := encodeKey(m[t.hashKey])
+	if t.rangeKey == "" {
+		return fmt.Sprintf("%d:%s", len(h), h)
+	}
+	r := encodeKey(m[t.rangeKey])
+	return fmt.Sprintf("%d:%s%d:%s", len(h), h, len(r), r)
+}
+
+func (t *table) primaryKey(m item) item {
+	key := item{t.hashKey: clone(m[t.hashKey])}
+	if t.rangeKey != "" {
+		key[t.rangeKey] = clone(m[t.rangeKey])
+	}
+	return key
+}
+
+// invalidate drops the cached orderings after a write.
+func (t *table) invalidate() {
+	t.entries = nil
+	for _, idx := range t.indexes {
+		idx.entries = nil
+	}
+}
+
+func (t *table) put(m item) {
+	t.items[t.keyOf(m)] = m
+	t.invalidate()
+}
+
+func (t *table) delete(key item) {
+	delete(t.items, t.keyOf(key))
+	t.invalidate()
+}
+
+func (t *table) get(key item) (item, bool) {
+	m, ok := t.items[t.keyOf(key)]
+	return m, ok
+}
+
+// validateKey checks that key contains exactly the key attributes of the table.
+func (t *table) validateKey(key item) error {
+	if len(key) != len(t.keys()) {
+		return validation("The provided key element does not match the schema")
+	}
+	for _, name := range t.keys() {
+		v, ok := key[name]
+		if !ok {
+			return validation("The provided key element does not match the schema")
+		}
+		if err := t.validateKeyValue(name, v, "The provided key element does not match the schema"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *table) validateKeyValue(name string, v types.AttributeValue, mismatch string) error {
+	if typeOf(v) != string(t.attributes[name]) {
+		return validation(mismatch)
+	}
+	switch val := v.(type) {
+	case *types.AttributeValueMemberS:
+		if val.Value == "" {
+			return validationf("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: %s", name)
+		}
+	case *types.AttributeValueMemberB:
+		if len(val.Value) == 0 {
+			return validationf("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty binary value. Key: %s", name)
+		}
+	case *types.AttributeValueMemberN:
+		if _, ok := parseNumber(val.Value); !ok {
+			return validationf("The parameter cannot be converted to a numeric value: %s", val.Value)
+		}
+	}
+	return nil
+}
+
+// validateItem checks an item before it is written.
+func (t *table) validateItem(m item) error {
+	for _, name := range t.keys() {
+		v, ok := m[name]
+		if !ok {
+			return validationf("One or more parameter values were invalid: Missing the key %s in the item", name)
+		}
+		if err := t.validateKeyValue(name, v, fmt.Sprintf("One or more parameter values were invalid: Type mismatch for key %s expected: %s actual: %s", name, t.attributes[name], typeOf(v))); err != nil {
+			return err
+		}
+	}
+	for _, idx := range t.indexes {
+		for _, name := range idx.keys() {
+			if v, ok := m[name]; ok {
+				if err := t.validateKeyValue(name, v, fmt.Sprintf("One or more parameter values were invalid: Type mismatch for Index Key %s Expected: %s Actual: %s IndexName: %s", name, t.attributes[name], typeOf(v), idx.name)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for k, v := range m {
+		if err := validateValue(k, v); err != nil {
+			return err
+		}
+	}
+	if itemSize(m) > MaxItemSize {
+		return validation("Item size has exceeded the maximum allowed size")
+	}
+	return nil
+}
+
+func (t *table) size() int64 {
+	var size int64
+	for _, m := range t.items {
+		size += int64(itemSize(m))
+	}
+	return size
+}
+
+func (t *table) describe() *types.TableDescription {
+	attrs := make([]types.AttributeDefinition, 0, len(t.attributes))
+	for name, typ := range t.attributes {
+		attrs = append(attrs, types.AttributeDefinition{AttributeName: aws.String(name), AttributeType: typ})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return *attrs[i].AttributeName < *attrs[j].AttributeName
+	})
+	throughput := t.throughput
+	desc := &types.TableDescription{
+		AttributeDefinitions: attrs,
+		BillingModeSummary: &types.BillingModeSummary{
+			BillingMode:                       t.billingMode,
+			LastUpdateToPayPerRequestDateTime: aws.Time(t.created),
+		},
+		CreationDateTime:          aws.Time(t.created),
+		DeletionProtectionEnabled: aws.Bool(false),
+		ItemCount:                 aws.Int64(int64(len(t.items))),
+		KeySchema:                 keySchema(t.hashKey, t.rangeKey),
+		ProvisionedThroughput:     &throughput,
+		TableArn:                  aws.String(t.arn()),
+		TableClassSummary:         &types.TableClassSummary{TableClass: t.tableClass},
+		TableId:                   aws.String(fmt.Sprintf("%x", t.created.UnixNano())),
+		TableName:                 aws.String(t.name),
+		TableSizeBytes:            aws.Int64(t.size()),
+		TableStatus:               types.TableStatusActive,
+	}
+	for _, name := range t.indexNames() {
+		idx := t.indexes[name]
+		count, size := int64(0), int64(0)
+		for _, m := range t.items {
+			if idx.contains(m) {
+				count++
+				size += int64(itemSize(m))
+			}
+		}
+		projection := idx.projection
+		if idx.global {
+			throughput := idx.throughput
+			desc.GlobalSecondaryIndexes = append(desc.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+				Backfilling:           aws.Bool(false),
+				IndexArn:              aws.String(t.arn() + "/index/" + idx.name),
+				IndexName:             aws.String(idx.name),
+				IndexSizeBytes:        aws.Int64(size),
+				IndexStatus:           types.IndexStatusActive,
+				ItemCount:             aws.Int64(count),
+				KeySchema:             keySchema(idx.hashKey, idx.rangeKey),
+				Projection:            &projection,
+				ProvisionedThroughput: &throughput,
+			})
+		} else {
+			desc.LocalSecondaryIndexes = append(desc.LocalSecondaryIndexes, types.LocalSecondaryIndexDescription{
+				IndexArn:       aws.String(t.arn() + "/index/" + idx.name),
+				IndexName:      aws.String(idx.name),
+				IndexSizeBytes: aws.Int64(size),
+				ItemCount:      aws.Int64(count),
+				KeySchema:      keySchema(idx.hashKey, idx.rangeKey),
+				Projection:     &projection,
+			})
+		}
+	}
+	return desc
+}
+
+func (t *table) indexNames() []string {
+	names := make([]string, 0, len(t.indexes))
+	for name := range t.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func keySchema(hashKey, rangeKey string) []types.KeySchemaElement {
+	keys := []types.KeySchemaElement{{AttributeName: aws.String(hashKey), KeyType: types.KeyTypeHash}}
+	if rangeKey != "" {
+		keys = append(keys, types.KeySchemaElement{AttributeName: aws.String(rangeKey), KeyType: types.KeyTypeRange})
+	}
+	return keys
+}
+
+func parseKeySchema(elements []types.KeySchemaElement) (hashKey, rangeKey string, err error) {
+	if len(elements) == 0 || len(elements) > 2 {
+		return "", "", validation("1 validation error detected: Value at 'keySchema' failed to satisfy constraint: Member must have length less than or equal to 2")
+	}
+	for _, e := range elements {
+		switch e.KeyType {
+		case types.KeyTypeHash:
+			if hashKey != "" {
+				return "", "", validation("Invalid KeySchema: Some index key attribute have no definition")
+			}
+			hashKey = aws.ToString(e.AttributeName)
+		case types.KeyTypeRange:
+			rangeKey = aws.ToString(e.AttributeName)
+		default:
+			return "", "", validationf("Invalid KeyType: %s", e.KeyType)
+		}
+	}
+	if hashKey == "" {
+		return "", "", validation("Invalid KeySchema: The first KeySchemaElement is not a HASH key type")
+	}
+	return hashKey, rangeKey, nil
+}
+
+func provisioned(tp *types.ProvisionedThroughput) types.ProvisionedThroughputDescription {
+	desc := types.ProvisionedThroughputDescription{
+		NumberOfDecreasesToday: aws.Int64(0),
+		ReadCapacityUnits:      aws.Int64(0),
+		WriteCapacityUnits:     aws.Int64(0),
+	}
+	if tp != nil {
+		desc.ReadCapacityUnits = aws.Int64(aws.ToInt64(tp.ReadCapacityUnits))
+		desc.WriteCapacityUnits = aws.Int64(aws.ToInt64(tp.WriteCapacityUnits))
+	}
+	return desc
+}
+
+func (c *Client) table(name *string) (*table, error) {
+	if name == nil || *name == "" {
+		return nil, validation("1 validation error detected: Value null at 'tableName' failed to satisfy constraint: Member must not be null")
+	}
+	t, ok := c.tables[*name]
+	if !ok {
+		return nil, resourceNotFound(*name)
+	}
+	return t, nil
+}
+
+func (c *Client) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	if err := c.before(ctx, "CreateTable", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name := aws.ToString(params.TableName)
+	if name == "" {
+		return nil, validation("1 validation error detected: Value null at 'tableName' failed to satisfy constraint: Member must not be null")
+	}
+	if _, ok := c.tables[name]; ok {
+		return nil, resourceInUse(name)
+	}
+	hashKey, rangeKey, err := parseKeySchema(params.KeySchema)
+	if err != nil {
+		return nil, err
+	}
+	t := &table{
+		name:        name,
+		attributes:  map[string]types.ScalarAttributeType{},
+		hashKey:     hashKey,
+		rangeKey:    rangeKey,
+		billingMode: params.BillingMode,
+		throughput:  provisioned(params.ProvisionedThroughput),
+		tableClass:  params.TableClass,
+		created:     time.Now(),
+		indexes:     map[string]*index{},
+		items:       map[string]item{},
+	}
+	if t.billingMode == "" {
+		t.billingMode = types.BillingModeProvisioned
+	}
+	if t.tableClass == "" {
+		t.tableClass = types.TableClassStandard
+	}
+	if t.billingMode == types.BillingModeProvisioned && params.ProvisionedThroughput == nil {
+		return nil, validation("One or more parameter values were invalid: ReadCapacityUnits and WriteCapacityUnits must both be specified when BillingMode is PROVISIONED")
+	}
+	for _, a := range params.AttributeDefinitions {
+		t.attributes[aws.ToString(a.AttributeName)] = a.AttributeType
+	}
+	for _, g := range params.GlobalSecondaryIndexes {
+		if err = t.addIndex(aws.ToString(g.IndexName), g.KeySchema, g.Projection, g.ProvisionedThroughput, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range params.LocalSecondaryIndexes {
+		if err = t.addIndex(aws.ToString(l.IndexName), l.KeySchema, l.Projection, nil, false); err != nil {
+			return nil, err
+		}
+	}
+	if err = t.validateDefinitions(); err != nil {
+		return nil, err
+	}
+	c.tables[name] = t
+	return &dynamodb.CreateTableOutput{TableDescription: t.describe()}, nil
+}
+
+func (t *table) addIndex(name string, elements []types.KeySchemaElement, projection *types.Projection, tp *types.ProvisionedThroughput, global bool) error {
+	if name == "" {
+		return validation("1 validation error detected: Value null at 'indexName' failed to satisfy constraint: Member must not be null")
+	}
+	if _, ok := t.indexes[name]; ok {
+		return validationf("One or more parameter values were invalid: Duplicate index name: %s", name)
+	}
+	hashKey, rangeKey, err := parseKeySchema(elements)
+	if err != nil {
+		return err
+	}
+	if !global && (hashKey != t.hashKey || rangeKey == "") {
+		return validationf("One or more parameter values were invalid: Index KeySchema does not have the same leading hash key as table KeySchema for index: %s", name)
+	}
+	if global && t.billingMode == types.BillingModeProvisioned && tp == nil {
+		return validationf("One or more parameter values were invalid: ProvisionedThroughput must be specified for index: %s", name)
+	}
+	idx := &index{
+		name:     name,
+		hashKey:  hashKey,
+		rangeKey: rangeKey,
+		global:   global,
+		projection: types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+		throughput: provisioned(tp),
+	}
+	if projection != nil {
+		idx.projection = types.Projection{
+			ProjectionType:   projection.ProjectionType,
+			NonKeyAttributes: append([]string(nil), projection.NonKeyAttributes...),
+		}
+	}
+	t.indexes[name] = idx
+	return nil
+}
+
+// validateDefinitions checks that every key attribute is defined and that no extra definitions exist.
+func (t *table) validateDefinitions() error {
+	used := map[string]bool{}
+	for _, k := range t.keys() {
+		used[k] = true
+	}
+	for _, idx := range t.indexes {
+		for _, k := range idx.keys() {
+			used[k] = true
+		}
+	}
+	for k := range used {
+		typ, ok := t.attributes[k]
+		if !ok {
+			return validation("One or more parameter values were invalid: Some index key attributes are not defined in AttributeDefinitions. Keys: [" + strings.Join(keysOf(used), ", ") + "], AttributeDefinitions: [" + strings.Join(definedNames(t.attributes), ", ") + "]")
+		}
+		switch typ {
+		case types.ScalarAttributeTypeS, types.ScalarAttributeTypeN, types.ScalarAttributeTypeB:
+		default:
+			return validationf("Member must satisfy enum value set: [B, N, S]; attribute: %s", k)
+		}
+	}
+	for k := range t.attributes {
+		if !used[k] {
+			return validation("One or more parameter values were invalid: Number of attributes in KeySchema does not exactly match number of attributes defined in AttributeDefinitions")
+		}
+	}
+	return nil
+}
+
+func keysOf(m map[string]bool) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func definedNames(m map[string]types.ScalarAttributeType) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (c *Client) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	if err := c.before(ctx, "DescribeTable", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.DescribeTableOutput{Table: t.describe()}, nil
+}
+
+func (c *Client) ListTables(ctx context.Context, params *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
+	if err := c.before(ctx, "ListTables", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.tables))
+	for name := range c.tables {
+		if params.ExclusiveStartTableName == nil || name > *params.ExclusiveStartTableName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	out := &dynamodb.ListTablesOutput{}
+	limit := int(aws.ToInt32(params.Limit))
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	if len(names) > limit {
+		names = names[:limit]
+		out.LastEvaluatedTableName = aws.String(names[limit-1])
+	}
+	out.TableNames = names
+	return out, nil
+}
+
+func (c *Client) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	if err := c.before(ctx, "UpdateTable", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	// 失敗した場合に元に戻せるよう定義のみ複製してから変更する
+	updated := *t
+	updated.attributes = map[string]types.ScalarAttributeType{}
+	for k, v := range t.attributes {
+		updated.attributes[k] = v
+	}
+	updated.indexes = map[string]*index{}
+	for k, v := range t.indexes {
+		updated.indexes[k] = v
+	}
+	for _, a := range params.AttributeDefinitions {
+		updated.attributes[aws.ToString(a.AttributeName)] = a.AttributeType
+	}
+	if params.BillingMode != "" {
+		updated.billingMode = params.BillingMode
+	}
+	if params.ProvisionedThroughput != nil {
+		updated.throughput = provisioned(params.ProvisionedThroughput)
+	}
+	if params.TableClass != "" {
+		updated.tableClass = params.TableClass
+	}
+	for _, u := range params.GlobalSecondaryIndexUpdates {
+		switch {
+		case u.Create != nil:
+			if err = updated.addIndex(aws.ToString(u.Create.IndexName), u.Create.KeySchema, u.Create.Projection, u.Create.ProvisionedThroughput, true); err != nil {
+				return nil, err
+			}
+		case u.Update != nil:
+			idx, ok := updated.indexes[aws.ToString(u.Update.IndexName)]
+			if !ok || !idx.global {
+				return nil, &types.ResourceNotFoundException{Message: aws.String(fmt.Sprintf("Requested resource not found: Index: %s not found", aws.ToString(u.Update.IndexName)))}
+			}
+			changed := *idx
+			changed.throughput = provisioned(u.Update.ProvisionedThroughput)
+			updated.indexes[changed.name] = &changed
+		case u.Delete != nil:
+			name := aws.ToString(u.Delete.IndexName)
+			if idx, ok := updated.indexes[name]; !ok || !idx.global {
+				return nil, &types.ResourceNotFoundException{Message: aws.String(fmt.Sprintf("Requested resource not found: Index: %s not found", name))}
+			}
+			delete(updated.indexes, name)
+		}
+	}
+	// 使われなくなった属性定義は削除する
+	used := map[string]bool{}
+	for _, k := range updated.keys() {
+		used[k] = true
+	}
+	for _, idx := range updated.indexes {
+		for _, k := range idx.keys() {
+			used[k] = true
+		}
+	}
+	for k := range updated.attributes {
+		if !used[k] {
+			delete(updated.attributes, k)
+		}
+	}
+	if err = updated.validateDefinitions(); err != nil {
+		return nil, err
+	}
+	for _, m := range updated.items {
+		for _, idx := range updated.indexes {
+			if _, ok := t.indexes[idx.name]; ok || !idx.contains(m) {
+				continue
+			}
+			for _, k := range idx.keys() {
+				if typeOf(m[k]) != string(updated.attributes[k]) {
+					return nil, validationf("One or more parameter values were invalid: Type mismatch for Index Key %s IndexName: %s", k, idx.name)
+				}
+			}
+		}
+	}
+	*t = updated
+	t.invalidate()
+	return &dynamodb.UpdateTableOutput{TableDescription: t.describe()}, nil
+}
+
+func (c *Client) DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error) {
+	if err := c.before(ctx, "DeleteTable", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.tables, t.name)
+	desc := t.describe()
+	desc.TableStatus = types.TableStatusDeleting
+	return &dynamodb.DeleteTableOutput{TableDescription: desc}, nil
+}
+
+func (c *Client) UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	if err := c.before(ctx, "UpdateTimeToLive", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	spec := params.TimeToLiveSpecification
+	if spec == nil || aws.ToString(spec.AttributeName) == "" || spec.Enabled == nil {
+		return nil, validation("1 validation error detected: Value null at 'timeToLiveSpecification' failed to satisfy constraint: Member must not be null")
+	}
+	enabled := t.ttl != nil && t.ttl.TimeToLiveStatus == types.TimeToLiveStatusEnabled
+	if enabled == *spec.Enabled {
+		if enabled {
+			return nil, validation("TimeToLive is already enabled")
+		}
+		return nil, validation("TimeToLive is already disabled")
+	}
+	if *spec.Enabled {
+		t.ttl = &types.TimeToLiveDescription{AttributeName: aws.String(*spec.AttributeName), TimeToLiveStatus: types.TimeToLiveStatusEnabled}
+	} else {
+		t.ttl = &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	}
+	return &dynamodb.UpdateTimeToLiveOutput{
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{AttributeName: aws.String(*spec.AttributeName), Enabled: aws.Bool(*spec.Enabled)},
+	}, nil
+}
+
+func (c *Client) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	if err := c.before(ctx, "DescribeTimeToLive", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, err := c.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	desc := &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	if t.ttl != nil {
+		desc = &types.TimeToLiveDescription{AttributeName: t.ttl.AttributeName, TimeToLiveStatus: t.ttl.TimeToLiveStatus}
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: desc}, nil
+}
@@ -0,0 +1,230 @@
+package dynamodbfake
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// transactWrite is one validated action of a TransactWriteItems request.
+type transactWrite struct {
+	t         *table
+	key       item
+	cond      condition
+	onFailure types.ReturnValuesOnConditionCheckFailure
+	put       item
+	update    *updateExpression
+	delete    bool
+}
+
+func (c *Client) transactWrite(twi types.TransactWriteItem) (*transactWrite, error) {
+	n := 0
+	var (
+		tableName *string
+		names     map[string]string
+		values    map[string]types.AttributeValue
+		cond      *string
+		w         = &transactWrite{}
+	)
+	if v := twi.ConditionCheck; v != nil {
+		n++
+		tableName, names, values, cond = v.TableName, v.ExpressionAttributeNames, v.ExpressionAttributeValues, v.ConditionExpression
+		w.key, w.onFailure = v.Key, v.ReturnValuesOnConditionCheckFailure
+		if cond == nil {
+			return nil, validation("ConditionCheck requires a ConditionExpression")
+		}
+	}
+	if v := twi.Put; v != nil {
+		n++
+		tableName, names, values, cond = v.TableName, v.ExpressionAttributeNames, v.ExpressionAttributeValues, v.ConditionExpression
+		w.put, w.onFailure = v.Item, v.ReturnValuesOnConditionCheckFailure
+	}
+	if v := twi.Update; v != nil {
+		n++
+		tableName, names, values, cond = v.TableName, v.ExpressionAttributeNames, v.ExpressionAttributeValues, v.ConditionExpression
+		w.key, w.onFailure = v.Key, v.ReturnValuesOnConditionCheckFailure
+		if v.UpdateExpression == nil {
+			return nil, validation("Update requires an UpdateExpression")
+		}
+	}
+	if v := twi.Delete; v != nil {
+		n++
+		tableName, names, values, cond = v.TableName, v.ExpressionAttributeNames, v.ExpressionAttributeValues, v.ConditionExpression
+		w.key, w.onFailure, w.delete = v.Key, v.ReturnValuesOnConditionCheckFailure, true
+	}
+	if n != 1 {
+		return nil, validation("TransactItems can only contain one of Check, Put, Update or Delete")
+	}
+	t, err := c.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	w.t = t
+	if w.put != nil {
+		if err = t.validateItem(w.put); err != nil {
+			return nil, err
+		}
+		w.key = t.primaryKey(w.put)
+	} else if err = t.validateKey(w.key); err != nil {
+		return nil, err
+	}
+	p := newParser(names, values)
+	if twi.Update != nil {
+		if w.update, err = p.parseUpdate(*twi.Update.UpdateExpression); err != nil {
+			return nil, err
+		}
+	}
+	if w.cond, err = p.condition(cond); err != nil {
+		return nil, err
+	}
+	if err = p.checkUnused(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (c *Client) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := c.before(ctx, "TransactWriteItems", params); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > MaxTransactItems {
+		return nil, validation("1 validation error detected: Value at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to 100, Member must have length greater than or equal to 1")
+	}
+	writes := make([]*transactWrite, 0, len(params.TransactItems))
+	seen := map[string]bool{}
+	for _, twi := range params.TransactItems {
+		w, err := c.transactWrite(twi)
+		if err != nil {
+			return nil, err
+		}
+		k := w.t.name + "/" + w.t.keyOf(w.key)
+		if seen[k] {
+			return nil, validation("Transaction request cannot include multiple operations on one item")
+		}
+		seen[k] = true
+		writes = append(writes, w)
+	}
+	// 条件をすべて評価してから書き込む
+	reasons := make([]types.CancellationReason, len(writes))
+	results := make([]item, len(writes))
+	olds := make([]item, len(writes))
+	canceled := false
+	for i, w := range writes {
+		old, exists := w.t.get(w.key)
+		if exists {
+			olds[i] = old
+		}
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+		if err := check(w.cond, old, exists, w.onFailure); err != nil {
+			ccf, ok := err.(*types.ConditionalCheckFailedException)
+			if !ok {
+				return nil, err
+			}
+			reasons[i] = types.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Message: ccf.Message,
+				Item:    ccf.Item,
+			}
+			canceled = true
+			continue
+		}
+		switch {
+		case w.put != nil:
+			results[i] = cloneItem(w.put)
+		case w.update != nil:
+			m, err := w.t.update(old, exists, w.key, w.update)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = m
+		}
+	}
+	if canceled {
+		return nil, transactionCanceled(reasons)
+	}
+	cc := newCapacity(params.ReturnConsumedCapacity, false)
+	for i, w := range writes {
+		switch {
+		case results[i] != nil:
+			w.t.put(results[i])
+			cc.write(w.t, olds[i], results[i], true)
+		case w.delete:
+			if olds[i] != nil {
+				w.t.delete(w.key)
+			}
+			cc.write(w.t, olds[i], nil, true)
+		default:
+			cc.addTable(w.t.name, readUnits(itemSize(olds[i]), true, true))
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{
+		ConsumedCapacity: cc.results(),
+	}, nil
+}
+
+func (c *Client) TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	if err := c.before(ctx, "TransactGetItems", params); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > MaxTransactItems {
+		return nil, validation("1 validation error detected: Value at 'transactItems' failed to satisfy constraint: Member must have length less than or equal to 100, Member must have length greater than or equal to 1")
+	}
+	type get struct {
+		t     *table
+		key   item
+		paths []path
+	}
+	gets := make([]get, 0, len(params.TransactItems))
+	seen := map[string]bool{}
+	for _, tgi := range params.TransactItems {
+		if tgi.Get == nil {
+			return nil, validation("TransactItems must contain a Get")
+		}
+		t, err := c.table(tgi.Get.TableName)
+		if err != nil {
+			return nil, err
+		}
+		if err = t.validateKey(tgi.Get.Key); err != nil {
+			return nil, err
+		}
+		k := t.name + "/" + t.keyOf(tgi.Get.Key)
+		if seen[k] {
+			return nil, validation("Transaction request cannot include multiple operations on one item")
+		}
+		seen[k] = true
+		p := newParser(tgi.Get.ExpressionAttributeNames, nil)
+		paths, err := p.projection(tgi.Get.ProjectionExpression, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err = p.checkUnused(); err != nil {
+			return nil, err
+		}
+		gets = append(gets, get{t: t, key: tgi.Get.Key, paths: paths})
+	}
+	out := &dynamodb.TransactGetItemsOutput{Responses: make([]types.ItemResponse, 0, len(gets))}
+	cc := newCapacity(params.ReturnConsumedCapacity, true)
+	for _, g := range gets {
+		res := types.ItemResponse{}
+		m, ok := g.t.get(g.key)
+		size := 0
+		if ok {
+			size = itemSize(m)
+			if g.paths != nil {
+				res.Item = project(m, g.paths)
+			} else {
+				res.Item = cloneItem(m)
+			}
+		}
+		cc.addTable(g.t.name, readUnits(size, true, true))
+		out.Responses = append(out.Responses, res)
+	}
+	out.ConsumedCapacity = cc.results()
+	return out, nil
+}
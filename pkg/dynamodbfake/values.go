@@ -0,0 +1,365 @@
+package dynamodbfake
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type item = map[string]types.AttributeValue
+
+func parseNumber(s string) (*big.Rat, bool) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	return r, ok
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// 分母の素因数2と5の数から必要な小数桁数を求める
+	d := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	for d.Bit(0) == 0 {
+		d.Rsh(d, 1)
+		twos++
+	}
+	five := big.NewInt(5)
+	for new(big.Int).Mod(d, five).Sign() == 0 {
+		d.Div(d, five)
+		fives++
+	}
+	digits := max(twos, fives)
+	if d.Cmp(big.NewInt(1)) != 0 {
+		digits = 38
+	}
+	return strings.TrimRight(strings.TrimRight(r.FloatString(digits), "0"), ".")
+}
+
+func clone(v types.AttributeValue) types.AttributeValue {
+	switch val := v.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: val.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: val.Value}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: bytes.Clone(val.Value)}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: val.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: val.Value}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string(nil), val.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string(nil), val.Value...)}
+	case *types.AttributeValueMemberBS:
+		bs := make([][]byte, 0, len(val.Value))
+		for _, b := range val.Value {
+			bs = append(bs, bytes.Clone(b))
+		}
+		return &types.AttributeValueMemberBS{Value: bs}
+	case *types.AttributeValueMemberL:
+		l := make([]types.AttributeValue, 0, len(val.Value))
+		for _, e := range val.Value {
+			l = append(l, clone(e))
+		}
+		return &types.AttributeValueMemberL{Value: l}
+	case *types.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: cloneItem(val.Value)}
+	}
+	return v
+}
+
+func cloneItem(m item) item {
+	if m == nil {
+		return nil
+	}
+	res := make(item, len(m))
+	for k, v := range m {
+		res[k] = clone(v)
+	}
+	return res
+}
+
+func typeOf(v types.AttributeValue) string {
+	switch v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	}
+	return ""
+}
+
+// compare compares scalar values of the same type. ok is false if the values are not comparable.
+func compare(a, b types.AttributeValue) (c int, ok bool) {
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS:
+		if y, ok := b.(*types.AttributeValueMemberS); ok {
+			return strings.Compare(x.Value, y.Value), true
+		}
+	case *types.AttributeValueMemberN:
+		if y, ok := b.(*types.AttributeValueMemberN); ok {
+			l, ok1 := parseNumber(x.Value)
+			r, ok2 := parseNumber(y.Value)
+			if ok1 && ok2 {
+				return l.Cmp(r), true
+			}
+		}
+	case *types.AttributeValueMemberB:
+		if y, ok := b.(*types.AttributeValueMemberB); ok {
+			return bytes.Compare(x.Value, y.Value), true
+		}
+	}
+	return 0, false
+}
+
+func equal(a, b types.AttributeValue) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		c, ok := compare(a, b)
+		return ok && c == 0
+	case *types.AttributeValueMemberBOOL:
+		y, ok := b.(*types.AttributeValueMemberBOOL)
+		return ok && x.Value == y.Value
+	case *types.AttributeValueMemberNULL:
+		_, ok := b.(*types.AttributeValueMemberNULL)
+		return ok
+	case *types.AttributeValueMemberSS:
+		y, ok := b.(*types.AttributeValueMemberSS)
+		return ok && sameStrings(x.Value, y.Value)
+	case *types.AttributeValueMemberNS:
+		y, ok := b.(*types.AttributeValueMemberNS)
+		return ok && sameStrings(normalizeNumbers(x.Value), normalizeNumbers(y.Value))
+	case *types.AttributeValueMemberBS:
+		y, ok := b.(*types.AttributeValueMemberBS)
+		if !ok {
+			return false
+		}
+		return sameStrings(binaryStrings(x.Value), binaryStrings(y.Value))
+	case *types.AttributeValueMemberL:
+		y, ok := b.(*types.AttributeValueMemberL)
+		if !ok || len(x.Value) != len(y.Value) {
+			return false
+		}
+		for i := range x.Value {
+			if !equal(x.Value[i], y.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		y, ok := b.(*types.AttributeValueMemberM)
+		if !ok || len(x.Value) != len(y.Value) {
+			return false
+		}
+		for k, v := range x.Value {
+			if !equal(v, y.Value[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]int, len(a))
+	for _, v := range a {
+		set[v]++
+	}
+	for _, v := range b {
+		if set[v] == 0 {
+			return false
+		}
+		set[v]--
+	}
+	return true
+}
+
+func normalizeNumbers(values []string) []string {
+	res := make([]string, 0, len(values))
+	for _, v := range values {
+		if r, ok := parseNumber(v); ok {
+			res = append(res, formatNumber(r))
+		} else {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func binaryStrings(values [][]byte) []string {
+	res := make([]string, 0, len(values))
+	for _, v := range values {
+		res = append(res, string(v))
+	}
+	return res
+}
+
+// encodeKey returns a canonical string of a key attribute value.
+func encodeKey(v types.AttributeValue) string {
+	switch val := v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S" + val.Value
+	case *types.AttributeValueMemberN:
+		if r, ok := parseNumber(val.Value); ok {
+			return "N" + formatNumber(r)
+		}
+		return "N" + val.Value
+	case *types.AttributeValueMemberB:
+		return "B" + string(val.Value)
+	}
+	return ""
+}
+
+// itemSize approximates the size of an item as DynamoDB calculates it.
+func itemSize(m item) int {
+	size := 0
+	for k, v := range m {
+		size += len(k) + valueSize(v)
+	}
+	return size
+}
+
+func valueSize(v types.AttributeValue) int {
+	switch val := v.(type) {
+	case *types.AttributeValueMemberS:
+		return len(val.Value)
+	case *types.AttributeValueMemberN:
+		return numberSize(val.Value)
+	case *types.AttributeValueMemberB:
+		return len(val.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range val.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, s := range val.Value {
+			size += numberSize(s)
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, b := range val.Value {
+			size += len(b)
+		}
+		return size
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, e := range val.Value {
+			size += valueSize(e) + 1
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		size := 3
+		for k, e := range val.Value {
+			size += len(k) + valueSize(e) + 1
+		}
+		return size
+	}
+	return 0
+}
+
+func numberSize(s string) int {
+	digits := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return (digits+1)/2 + 1
+}
+
+// validateValue checks the rules DynamoDB applies to every attribute value of an item.
+func validateValue(name string, v types.AttributeValue) error {
+	switch val := v.(type) {
+	case nil:
+		return validation("Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+	case *types.AttributeValueMemberN:
+		if _, ok := parseNumber(val.Value); !ok {
+			return validation(fmt.Sprintf("The parameter cannot be converted to a numeric value: %s", val.Value))
+		}
+	case *types.AttributeValueMemberSS:
+		if len(val.Value) == 0 {
+			return validation("One or more parameter values were invalid: An string set  may not be empty")
+		}
+		if hasDuplicates(val.Value) {
+			return validation(fmt.Sprintf("One or more parameter values were invalid: Input collection %v contains duplicates.", val.Value))
+		}
+	case *types.AttributeValueMemberNS:
+		if len(val.Value) == 0 {
+			return validation("One or more parameter values were invalid: An number set  may not be empty")
+		}
+		for _, n := range val.Value {
+			if _, ok := parseNumber(n); !ok {
+				return validation(fmt.Sprintf("The parameter cannot be converted to a numeric value: %s", n))
+			}
+		}
+		if hasDuplicates(normalizeNumbers(val.Value)) {
+			return validation(fmt.Sprintf("One or more parameter values were invalid: Input collection %v contains duplicates.", val.Value))
+		}
+	case *types.AttributeValueMemberBS:
+		if len(val.Value) == 0 {
+			return validation("One or more parameter values were invalid: An binary set  may not be empty")
+		}
+		if hasDuplicates(binaryStrings(val.Value)) {
+			return validation("One or more parameter values were invalid: Input collection contains duplicates.")
+		}
+	case *types.AttributeValueMemberL:
+		for _, e := range val.Value {
+			if err := validateValue(name, e); err != nil {
+				return err
+			}
+		}
+	case *types.AttributeValueMemberM:
+		for k, e := range val.Value {
+			if err := validateValue(k, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasDuplicates(values []string) bool {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return true
+		}
+	}
+	return false
+}
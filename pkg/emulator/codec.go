@@ -0,0 +1,394 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// The DynamoDB JSON protocol uses the member names of the API shapes as keys,
+// which are the field names of the SDK structs.
+
+var (
+	attributeValueType = reflect.TypeOf((*types.AttributeValue)(nil)).Elem()
+	timeType           = reflect.TypeOf(time.Time{})
+	bytesType          = reflect.TypeOf([]byte(nil))
+)
+
+// marshal encodes an SDK input/output struct in the wire format.
+func marshal(v any) ([]byte, error) {
+	doc, ok, err := encode(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		doc = map[string]any{}
+	}
+	return json.Marshal(doc)
+}
+
+// unmarshal decodes a request body in the wire format into an SDK struct.
+func unmarshal(body []byte, v any) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	return decode(doc, reflect.ValueOf(v).Elem())
+}
+
+func encode(rv reflect.Value) (any, bool, error) {
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil, false, nil
+		}
+		return encode(rv.Elem())
+	case reflect.Interface:
+		if rv.IsNil() {
+			return nil, false, nil
+		}
+		if rv.Type() == attributeValueType {
+			v, err := encodeAttributeValue(rv.Interface().(types.AttributeValue))
+			return v, err == nil, err
+		}
+		return encode(rv.Elem())
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			t := rv.Interface().(time.Time)
+			return float64(t.UnixNano()) / float64(time.Second), true, nil
+		}
+		doc := map[string]any{}
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			if !f.IsExported() || f.Name == "ResultMetadata" || f.Name == "ErrorCodeOverride" {
+				continue
+			}
+			v, ok, err := encode(rv.Field(i))
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				doc[f.Name] = v
+			}
+		}
+		return doc, true, nil
+	case reflect.Slice:
+		if rv.IsNil() {
+			return nil, false, nil
+		}
+		if rv.Type() == bytesType {
+			return rv.Bytes(), true, nil
+		}
+		list := make([]any, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			v, _, err := encode(rv.Index(i))
+			if err != nil {
+				return nil, false, err
+			}
+			list = append(list, v)
+		}
+		return list, true, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil, false, nil
+		}
+		doc := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			v, _, err := encode(iter.Value())
+			if err != nil {
+				return nil, false, err
+			}
+			doc[iter.Key().String()] = v
+		}
+		return doc, true, nil
+	case reflect.String:
+		if rv.Len() == 0 {
+			return nil, false, nil
+		}
+		return rv.String(), true, nil
+	case reflect.Bool:
+		return rv.Bool(), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true, nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false, fmt.Errorf("unsupported float value: %v", f)
+		}
+		return f, true, nil
+	}
+	return nil, false, fmt.Errorf("unsupported type: %s", rv.Type())
+}
+
+func encodeAttributeValue(av types.AttributeValue) (any, error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]any{"S": v.Value}, nil
+	case *types.AttributeValueMemberN:
+		return map[string]any{"N": v.Value}, nil
+	case *types.AttributeValueMemberB:
+		return map[string]any{"B": v.Value}, nil
+	case *types.AttributeValueMemberSS:
+		return map[string]any{"SS": v.Value}, nil
+	case *types.AttributeValueMemberNS:
+		return map[string]any{"NS": v.Value}, nil
+	case *types.AttributeValueMemberBS:
+		return map[string]any{"BS": v.Value}, nil
+	case *types.AttributeValueMemberBOOL:
+		return map[string]any{"BOOL": v.Value}, nil
+	case *types.AttributeValueMemberNULL:
+		return map[string]any{"NULL": v.Value}, nil
+	case *types.AttributeValueMemberL:
+		list := make([]any, 0, len(v.Value))
+		for _, e := range v.Value {
+			ev, err := encodeAttributeValue(e)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, ev)
+		}
+		return map[string]any{"L": list}, nil
+	case *types.AttributeValueMemberM:
+		m := make(map[string]any, len(v.Value))
+		for k, e := range v.Value {
+			ev, err := encodeAttributeValue(e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = ev
+		}
+		return map[string]any{"M": m}, nil
+	}
+	return nil, fmt.Errorf("unsupported attribute value: %T", av)
+}
+
+func decode(doc any, rv reflect.Value) error {
+	if doc == nil {
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Pointer:
+		v := reflect.New(rv.Type().Elem())
+		if err := decode(doc, v.Elem()); err != nil {
+			return err
+		}
+		rv.Set(v)
+		return nil
+	case reflect.Interface:
+		if rv.Type() != attributeValueType {
+			return fmt.Errorf("unsupported type: %s", rv.Type())
+		}
+		av, err := decodeAttributeValue(doc)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(av))
+		return nil
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			n, ok := doc.(json.Number)
+			if !ok {
+				return fmt.Errorf("expected timestamp, got %T", doc)
+			}
+			f, err := n.Float64()
+			if err != nil {
+				return err
+			}
+			sec, frac := math.Modf(f)
+			rv.Set(reflect.ValueOf(time.Unix(int64(sec), int64(frac*float64(time.Second)))))
+			return nil
+		}
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected object for %s, got %T", rv.Type(), doc)
+		}
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if v, ok := m[f.Name]; ok {
+				if err := decode(v, rv.Field(i)); err != nil {
+					return fmt.Errorf("%s: %w", f.Name, err)
+				}
+			}
+		}
+		return nil
+	case reflect.Slice:
+		if rv.Type() == bytesType {
+			s, ok := doc.(string)
+			if !ok {
+				return fmt.Errorf("expected blob, got %T", doc)
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			rv.SetBytes(b)
+			return nil
+		}
+		list, ok := doc.([]any)
+		if !ok {
+			return fmt.Errorf("expected list, got %T", doc)
+		}
+		s := reflect.MakeSlice(rv.Type(), len(list), len(list))
+		for i, e := range list {
+			if err := decode(e, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		rv.Set(s)
+		return nil
+	case reflect.Map:
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected map, got %T", doc)
+		}
+		res := reflect.MakeMapWithSize(rv.Type(), len(m))
+		for k, e := range m {
+			v := reflect.New(rv.Type().Elem()).Elem()
+			if err := decode(e, v); err != nil {
+				return err
+			}
+			res.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), v)
+		}
+		rv.Set(res)
+		return nil
+	case reflect.String:
+		s, ok := doc.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", doc)
+		}
+		rv.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, ok := doc.(bool)
+		if !ok {
+			return fmt.Errorf("expected boolean, got %T", doc)
+		}
+		rv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := doc.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", doc)
+		}
+		i, err := strconv.ParseInt(n.String(), 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(i)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		n, ok := doc.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", doc)
+		}
+		f, err := strconv.ParseFloat(n.String(), rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("unsupported type: %s", rv.Type())
+}
+
+func decodeAttributeValue(doc any) (types.AttributeValue, error) {
+	m, ok := doc.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+	}
+	for k, v := range m {
+		switch k {
+		case "S":
+			s, ok := v.(string)
+			if !ok {
+				break
+			}
+			return &types.AttributeValueMemberS{Value: s}, nil
+		case "N":
+			s, ok := v.(string)
+			if !ok {
+				break
+			}
+			return &types.AttributeValueMemberN{Value: s}, nil
+		case "B":
+			var b []byte
+			if err := decode(v, reflect.ValueOf(&b).Elem()); err != nil {
+				return nil, err
+			}
+			return &types.AttributeValueMemberB{Value: b}, nil
+		case "SS", "NS":
+			var ss []string
+			if err := decode(v, reflect.ValueOf(&ss).Elem()); err != nil {
+				return nil, err
+			}
+			if k == "SS" {
+				return &types.AttributeValueMemberSS{Value: ss}, nil
+			}
+			return &types.AttributeValueMemberNS{Value: ss}, nil
+		case "BS":
+			var bs [][]byte
+			if err := decode(v, reflect.ValueOf(&bs).Elem()); err != nil {
+				return nil, err
+			}
+			return &types.AttributeValueMemberBS{Value: bs}, nil
+		case "BOOL":
+			b, ok := v.(bool)
+			if !ok {
+				break
+			}
+			return &types.AttributeValueMemberBOOL{Value: b}, nil
+		case "NULL":
+			b, ok := v.(bool)
+			if !ok {
+				break
+			}
+			return &types.AttributeValueMemberNULL{Value: b}, nil
+		case "L":
+			list, ok := v.([]any)
+			if !ok {
+				break
+			}
+			values := make([]types.AttributeValue, 0, len(list))
+			for _, e := range list {
+				av, err := decodeAttributeValue(e)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, av)
+			}
+			return &types.AttributeValueMemberL{Value: values}, nil
+		case "M":
+			mm, ok := v.(map[string]any)
+			if !ok {
+				break
+			}
+			values := make(map[string]types.AttributeValue, len(mm))
+			for name, e := range mm {
+				av, err := decodeAttributeValue(e)
+				if err != nil {
+					return nil, err
+				}
+				values[name] = av
+			}
+			return &types.AttributeValueMemberM{Value: values}, nil
+		}
+		return nil, fmt.Errorf("Supplied AttributeValue has an invalid %s value", k)
+	}
+	return nil, nil
+}
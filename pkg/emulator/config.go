@@ -0,0 +1,21 @@
+package emulator
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+// ConfigOptions returns the options for foundations.Setup to connect to the emulator at endpoint.
+// The emulator does not verify signatures, so static dummy credentials are used.
+func ConfigOptions(ctx context.Context, endpoint string) ([]foundations.ConfigOption, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("ap-northeast-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("dummy", "dummy", "")),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []foundations.ConfigOption{foundations.AwsConfig(&cfg), foundations.Endpoint(endpoint)}, nil
+}
@@ -0,0 +1,174 @@
+package emulator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+)
+
+type snapshot struct {
+	Tables []tableSnapshot
+}
+
+type tableSnapshot struct {
+	Table      *types.TableDescription
+	TimeToLive *types.TimeToLiveDescription
+	Items      []map[string]types.AttributeValue
+}
+
+func save(ctx context.Context, cli *dynamodbfake.Client, path string) error {
+	snap := snapshot{Tables: []tableSnapshot{}}
+	var start *string
+	for {
+		out, err := cli.ListTables(ctx, &dynamodb.ListTablesInput{ExclusiveStartTableName: start})
+		if err != nil {
+			return err
+		}
+		for _, name := range out.TableNames {
+			ts, err := dump(ctx, cli, name)
+			if err != nil {
+				return err
+			}
+			snap.Tables = append(snap.Tables, *ts)
+		}
+		if start = out.LastEvaluatedTableName; start == nil {
+			break
+		}
+	}
+	body, err := marshal(snap)
+	if err != nil {
+		return err
+	}
+	// 書き込み途中のファイルを読まないように一時ファイルから置き換える
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(body); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func dump(ctx context.Context, cli *dynamodbfake.Client, name string) (*tableSnapshot, error) {
+	desc, err := cli.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := cli.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(name)})
+	if err != nil {
+		return nil, err
+	}
+	ts := &tableSnapshot{
+		Table:      desc.Table,
+		TimeToLive: ttl.TimeToLiveDescription,
+		Items:      []map[string]types.AttributeValue{},
+	}
+	var start map[string]types.AttributeValue
+	for {
+		out, err := cli.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(name), ExclusiveStartKey: start})
+		if err != nil {
+			return nil, err
+		}
+		ts.Items = append(ts.Items, out.Items...)
+		if start = out.LastEvaluatedKey; start == nil {
+			break
+		}
+	}
+	return ts, nil
+}
+
+func load(ctx context.Context, cli *dynamodbfake.Client, path string) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var snap snapshot
+	if err = unmarshal(body, &snap); err != nil {
+		return err
+	}
+	for _, ts := range snap.Tables {
+		if _, err = cli.CreateTable(ctx, createTableInput(ts.Table)); err != nil {
+			return err
+		}
+		if ts.TimeToLive != nil && ts.TimeToLive.TimeToLiveStatus == types.TimeToLiveStatusEnabled {
+			if _, err = cli.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+				TableName: ts.Table.TableName,
+				TimeToLiveSpecification: &types.TimeToLiveSpecification{
+					AttributeName: ts.TimeToLive.AttributeName,
+					Enabled:       aws.Bool(true),
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		for _, item := range ts.Items {
+			if _, err = cli.PutItem(ctx, &dynamodb.PutItemInput{TableName: ts.Table.TableName, Item: item}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func createTableInput(desc *types.TableDescription) *dynamodb.CreateTableInput {
+	in := &dynamodb.CreateTableInput{
+		TableName:            desc.TableName,
+		AttributeDefinitions: desc.AttributeDefinitions,
+		KeySchema:            desc.KeySchema,
+		BillingMode:          types.BillingModeProvisioned,
+	}
+	if desc.BillingModeSummary != nil {
+		in.BillingMode = desc.BillingModeSummary.BillingMode
+	}
+	if desc.TableClassSummary != nil {
+		in.TableClass = desc.TableClassSummary.TableClass
+	}
+	provisioned := in.BillingMode == types.BillingModeProvisioned
+	if provisioned {
+		in.ProvisionedThroughput = throughput(desc.ProvisionedThroughput)
+	}
+	for _, g := range desc.GlobalSecondaryIndexes {
+		gsi := types.GlobalSecondaryIndex{
+			IndexName:  g.IndexName,
+			KeySchema:  g.KeySchema,
+			Projection: g.Projection,
+		}
+		if provisioned {
+			gsi.ProvisionedThroughput = throughput(g.ProvisionedThroughput)
+		}
+		in.GlobalSecondaryIndexes = append(in.GlobalSecondaryIndexes, gsi)
+	}
+	for _, l := range desc.LocalSecondaryIndexes {
+		in.LocalSecondaryIndexes = append(in.LocalSecondaryIndexes, types.LocalSecondaryIndex{
+			IndexName:  l.IndexName,
+			KeySchema:  l.KeySchema,
+			Projection: l.Projection,
+		})
+	}
+	return in
+}
+
+func throughput(desc *types.ProvisionedThroughputDescription) *types.ProvisionedThroughput {
+	if desc == nil {
+		return &types.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(1), WriteCapacityUnits: aws.Int64(1)}
+	}
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  desc.ReadCapacityUnits,
+		WriteCapacityUnits: desc.WriteCapacityUnits,
+	}
+}
@@ -0,0 +1,224 @@
+// Package emulator serves the in-memory DynamoDB of dynamodbfake over the
+// DynamoDB JSON protocol, so the aws-sdk-go-v2 client can be pointed at it.
+package emulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+)
+
+const targetPrefix = "DynamoDB_20120810."
+
+type operation func(ctx context.Context, body []byte) (any, error)
+
+func handle[I, O any](f func(context.Context, *I, ...func(*dynamodb.Options)) (*O, error)) operation {
+	return func(ctx context.Context, body []byte) (any, error) {
+		in := new(I)
+		if err := unmarshal(body, in); err != nil {
+			return nil, &smithy.GenericAPIError{Code: "SerializationException", Message: err.Error(), Fault: smithy.FaultClient}
+		}
+		return f(ctx, in)
+	}
+}
+
+type Option func(s *Server)
+
+// WithClient serves an existing fake instead of a new one.
+func WithClient(cli *dynamodbfake.Client) Option {
+	return func(s *Server) {
+		s.cli = cli
+	}
+}
+
+// WithFile loads the tables from path when it exists and saves them there on Save and on stop.
+func WithFile(path string) Option {
+	return func(s *Server) {
+		s.file = path
+	}
+}
+
+// Server is an http.Handler speaking the DynamoDB JSON protocol.
+type Server struct {
+	cli        *dynamodbfake.Client
+	file       string
+	operations map[string]operation
+	requestID  atomic.Uint64
+}
+
+func NewServer(ctx context.Context, opt ...Option) (*Server, error) {
+	s := &Server{}
+	for _, o := range opt {
+		o(s)
+	}
+	if s.cli == nil {
+		s.cli = dynamodbfake.New()
+	}
+	s.operations = map[string]operation{
+		"GetItem":            handle(s.cli.GetItem),
+		"PutItem":            handle(s.cli.PutItem),
+		"UpdateItem":         handle(s.cli.UpdateItem),
+		"DeleteItem":         handle(s.cli.DeleteItem),
+		"Query":              handle(s.cli.Query),
+		"Scan":               handle(s.cli.Scan),
+		"BatchWriteItem":     handle(s.cli.BatchWriteItem),
+		"BatchGetItem":       handle(s.cli.BatchGetItem),
+		"TransactWriteItems": handle(s.cli.TransactWriteItems),
+		"TransactGetItems":   handle(s.cli.TransactGetItems),
+		"CreateTable":        handle(s.cli.CreateTable),
+		"UpdateTable":        handle(s.cli.UpdateTable),
+		"DescribeTable":      handle(s.cli.DescribeTable),
+		"DeleteTable":        handle(s.cli.DeleteTable),
+		"ListTables":         handle(s.cli.ListTables),
+		"UpdateTimeToLive":   handle(s.cli.UpdateTimeToLive),
+		"DescribeTimeToLive": handle(s.cli.DescribeTimeToLive),
+	}
+	if s.file != "" {
+		if err := load(ctx, s.cli, s.file); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Client returns the fake backing the server.
+func (s *Server) Client() *dynamodbfake.Client {
+	return s.cli
+}
+
+// Save writes every table to the file given by WithFile.
+func (s *Server) Save(ctx context.Context) error {
+	if s.file == "" {
+		return nil
+	}
+	return save(ctx, s.cli, s.file)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	op, ok := s.operations[strings.TrimPrefix(target, targetPrefix)]
+	if r.Method != http.MethodPost || !strings.HasPrefix(target, targetPrefix) || !ok {
+		s.writeError(w, &smithy.GenericAPIError{Code: "UnknownOperationException", Message: fmt.Sprintf("Unknown operation: %s", target), Fault: smithy.FaultClient})
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, &smithy.GenericAPIError{Code: "SerializationException", Message: err.Error(), Fault: smithy.FaultClient})
+		return
+	}
+	out, err := op(r.Context(), body)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	res, err := marshal(out)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.write(w, http.StatusOK, res)
+}
+
+func (s *Server) write(w http.ResponseWriter, status int, body []byte) {
+	h := w.Header()
+	h.Set("Content-Type", "application/x-amz-json-1.0")
+	h.Set("X-Amz-Crc32", fmt.Sprint(crc32.ChecksumIEEE(body)))
+	h.Set("X-Amzn-Requestid", fmt.Sprintf("%016x", s.requestID.Add(1)))
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	code, message, status := "InternalServerError", err.Error(), http.StatusInternalServerError
+	var doc map[string]any
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		code, message = ae.ErrorCode(), ae.ErrorMessage()
+		if ae.ErrorFault() != smithy.FaultServer {
+			status = http.StatusBadRequest
+		}
+		// モデル化された例外は CancellationReasons などのメンバーも返す
+		if _, generic := ae.(*smithy.GenericAPIError); !generic {
+			if v, ok, _ := encode(reflect.ValueOf(ae)); ok {
+				doc, _ = v.(map[string]any)
+			}
+		}
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	delete(doc, "Message")
+	doc["__type"] = "com.amazonaws.dynamodb.v20120810#" + code
+	doc["message"] = message
+	body, _ := json.Marshal(doc)
+	s.write(w, status, body)
+}
+
+// Listen serves on addr until stop is called or ctx is done.
+// stop saves the tables when the server was created with WithFile.
+func (s *Server) Listen(ctx context.Context, addr string) (endpoint string, stop func() error, err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	var once sync.Once
+	var stopErr error
+	done := make(chan struct{})
+	stop = func() error {
+		once.Do(func() {
+			close(done)
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdown); err != nil {
+				stopErr = err
+				return
+			}
+			stopErr = s.Save(shutdown)
+		})
+		return stopErr
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = stop()
+		case <-done:
+		}
+	}()
+	return "http://" + l.Addr().String(), stop, nil
+}
+
+// Start runs an emulator on a random local port and returns its endpoint.
+// It panics when the server can not be started or the tables can not be saved, like httptest.NewServer.
+func Start(ctx context.Context, opt ...Option) (endpoint string, stop func()) {
+	s, err := NewServer(ctx, opt...)
+	if err != nil {
+		panic(fmt.Sprintf("emulator: failed to create server: %v", err))
+	}
+	endpoint, shutdown, err := s.Listen(ctx, "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("emulator: failed to listen: %v", err))
+	}
+	return endpoint, func() {
+		if err := shutdown(); err != nil {
+			panic(fmt.Sprintf("emulator: failed to stop server: %v", err))
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package emulator_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/emulator"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/migrate"
+	"github.com/goccha/dynamodb-verse/pkg/transactions"
+)
+
+type User struct {
+	ID   string   `dynamodbav:"id"`
+	Name string   `dynamodbav:"name"`
+	Tags []string `dynamodbav:"tags,stringset"`
+	Data []byte   `dynamodbav:"data"`
+}
+
+func setup(t *testing.T, ctx context.Context, endpoint string) *dynamodb.Client {
+	opts, err := emulator.ConfigOptions(ctx, endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := foundations.Setup(ctx, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli
+}
+
+func userKey(id string) foundations.GetKeyFunc {
+	return func() (string, map[string]types.AttributeValue, []string, error) {
+		return "users", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}}, nil, nil
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "dynamodb.json")
+	endpoint, stop := emulator.Start(ctx, emulator.WithFile(file))
+	cli := setup(t, ctx, endpoint)
+	if _, err := migrate.NewSchema("users").
+		Attributes(migrate.NewStringAttribute("id")).
+		Keys(migrate.NewHashKey("id")).
+		Build(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	user := User{ID: "u1", Name: "alice", Tags: []string{"a", "b"}, Data: []byte{0, 1, 2}}
+	if _, err := foundations.Put(ctx, cli, foundations.PutItem(ctx, "users", user)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := foundations.Put(ctx, cli, foundations.PutItem(ctx, "users", user, func() (expression.Expression, error) {
+		return expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("id"))).Build()
+	}))
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		t.Fatalf("expected ConditionalCheckFailedException, got %v", err)
+	}
+	_, err = transactions.New().Delete(foundations.WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		_, key, _, _ := userKey("u1")()
+		expr, err := expression.NewBuilder().WithCondition(expression.Name("name").Equal(expression.Value("bob"))).Build()
+		return "users", key, expr, err
+	})).Run(ctx, cli)
+	var tce *types.TransactionCanceledException
+	if !errors.As(err, &tce) || len(tce.CancellationReasons) != 1 {
+		t.Fatalf("expected TransactionCanceledException, got %v", err)
+	}
+	stop()
+
+	endpoint, stop = emulator.Start(ctx, emulator.WithFile(file))
+	defer stop()
+	cli = setup(t, ctx, endpoint)
+	var got User
+	if _, err = foundations.Get(ctx, cli, userKey("u1"), foundations.FetchItem(ctx, &got)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "alice" || len(got.Tags) != 2 || len(got.Data) != 3 {
+		t.Fatalf("unexpected user: %v", got)
+	}
+	_, err = cli.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String("unknown")})
+	if !foundations.IsNotFound(err) {
+		t.Fatalf("expected ResourceNotFoundException, got %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/smithy-go/logging"
+	"github.com/goccha/dynamodb-verse/pkg/capacity"
 	"github.com/goccha/envar"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
@@ -21,6 +22,7 @@ type Config struct {
 	Profile        string
 	Debug          bool
 	EnabledTracing bool
+	EnabledMetrics bool
 	Cfg            *aws.Config
 }
 
@@ -69,6 +71,13 @@ func EnabledTracing() ConfigOption {
 	}
 }
 
+// EnabledMetrics Records the OpenTelemetry metrics of the requests with the global MeterProvider.
+func EnabledMetrics() ConfigOption {
+	return func(c *Config) {
+		c.EnabledMetrics = true
+	}
+}
+
 func AwsConfig(cfg *aws.Config) ConfigOption {
 	return func(c *Config) {
 		c.Cfg = cfg
@@ -104,6 +113,12 @@ func Setup(ctx context.Context, option ...ConfigOption) (cli *dynamodb.Client, e
 		// instrument all aws clients
 		otelaws.AppendMiddlewares(&cfg.APIOptions)
 	}
+	capacity.AppendMiddlewares(&cfg.APIOptions)
+	if conf.EnabledMetrics {
+		if err = AppendMetricsMiddlewares(&cfg.APIOptions, nil); err != nil {
+			return nil, err
+		}
+	}
 	if conf.Local { // local mode
 		conf.Endpoint = "http://localhost:8000"
 	}
@@ -147,7 +162,7 @@ type ConfigBuilder interface {
 type EnvBuilder struct{}
 
 func (b *EnvBuilder) Build(ctx context.Context) (options []ConfigOption) {
-	options = make([]ConfigOption, 0, 7)
+	options = make([]ConfigOption, 0, 8)
 	if envar.Bool("AWS_DEBUG_LOG") {
 		options = append(options, Debug())
 	}
@@ -161,6 +176,9 @@ func (b *EnvBuilder) Build(ctx context.Context) (options []ConfigOption) {
 	if envar.Bool("AWS_ENABLE_TRACING") {
 		options = append(options, EnabledTracing())
 	}
+	if envar.Bool("AWS_ENABLE_METRICS") {
+		options = append(options, EnabledMetrics())
+	}
 	return options
 }
 
@@ -171,11 +189,12 @@ type OptionBuilder struct {
 	Profile        string
 	Debug          bool
 	EnabledTracing bool
+	EnabledMetrics bool
 	Cfg            *aws.Config
 }
 
 func (b *OptionBuilder) Build(ctx context.Context) (options []ConfigOption) {
-	options = make([]ConfigOption, 0, 7)
+	options = make([]ConfigOption, 0, 8)
 	if b.Local {
 		options = append(options, Local())
 	}
@@ -194,6 +213,9 @@ func (b *OptionBuilder) Build(ctx context.Context) (options []ConfigOption) {
 	if b.EnabledTracing {
 		options = append(options, EnabledTracing())
 	}
+	if b.EnabledMetrics {
+		options = append(options, EnabledMetrics())
+	}
 	if b.Cfg != nil {
 		options = append(options, AwsConfig(b.Cfg))
 	}
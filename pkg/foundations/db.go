@@ -0,0 +1,431 @@
+package foundations
+
+import (
+	"context"
+	"os"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/google/uuid"
+)
+
+// API is the part of *dynamodb.Client used by foundations, batches and transactions.
+type API interface {
+	Client
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error)
+}
+
+// TableNameResolver Returns the physical name of the table.
+type TableNameResolver func(name string) string
+
+// Hook is called with the input of every request before it is sent. An error cancels the request.
+type Hook func(ctx context.Context, operation string, input any) error
+
+// Middleware wraps the API of a DB.
+type Middleware func(next API) API
+
+// DB holds the settings of a client in place of the package-level settings.
+// DB.Client can be passed to the functions of foundations, batches and transactions in place of the SDK client.
+type DB struct {
+	api                API
+	errorWithEmptyList bool
+	resolver           TableNameResolver
+	defaults           []options.Option
+	hooks              []Hook
+	interceptors       []Interceptor
+	retry              *RetryPolicy
+	keys               *KeyRegistry
+	client             *dbClient
+}
+
+type DBOption func(db *DB)
+
+// ErrorWithEmptyList Makes Query and Scan return ErrItemNotFound if the result is empty.
+// The default is the value of EnableErrorWithEmptyList when the DB is created.
+func ErrorWithEmptyList(v bool) DBOption {
+	return func(db *DB) {
+		db.errorWithEmptyList = v
+	}
+}
+
+// TableNames Resolves table names with resolver. It is applied after the resolvers of the preceding options.
+func TableNames(resolver TableNameResolver) DBOption {
+	return func(db *DB) {
+		if prev := db.resolver; prev != nil {
+			db.resolver = func(name string) string {
+				return resolver(prev(name))
+			}
+		} else {
+			db.resolver = resolver
+		}
+	}
+}
+
+func TablePrefix(prefix string) DBOption {
+	return TableNames(func(name string) string {
+		return prefix + name
+	})
+}
+
+func TableSuffix(suffix string) DBOption {
+	return TableNames(func(name string) string {
+		return name + suffix
+	})
+}
+
+// TablePrefixEnv Prefixes table names with the value of the environment variable.
+func TablePrefixEnv(key string) DBOption {
+	return TablePrefix(os.Getenv(key))
+}
+
+// DefaultOptions Applies opt to every request. Values set by the caller take precedence.
+func DefaultOptions(opt ...options.Option) DBOption {
+	return func(db *DB) {
+		db.defaults = append(db.defaults, opt...)
+	}
+}
+
+func Hooks(hooks ...Hook) DBOption {
+	return func(db *DB) {
+		db.hooks = append(db.hooks, hooks...)
+	}
+}
+
+// Middlewares Wraps the API. The first middleware is the outermost.
+func Middlewares(middlewares ...Middleware) DBOption {
+	return func(db *DB) {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			db.api = middlewares[i](db.api)
+		}
+	}
+}
+
+func NewDB(api API, opt ...DBOption) *DB {
+	db := &DB{
+		api:                api,
+		errorWithEmptyList: errorWithEmptyList,
+		keys:               DefaultKeyRegistry,
+	}
+	for _, o := range opt {
+		o(db)
+	}
+	db.client = &dbClient{db: db}
+	return db
+}
+
+// Client Returns the API that applies the settings of db to every request.
+func (db *DB) Client() API {
+	return db.client
+}
+
+// TableName Returns the physical name of the table.
+func (db *DB) TableName(name string) string {
+	if db.resolver == nil {
+		return name
+	}
+	return db.resolver(name)
+}
+
+func (c *dbClient) emptyListError() bool {
+	return c.db.errorWithEmptyList
+}
+
+type emptyListPolicy interface {
+	emptyListError() bool
+}
+
+func emptyListError(cli any) bool {
+	if p, ok := cli.(emptyListPolicy); ok {
+		return p.emptyListError()
+	}
+	return errorWithEmptyList
+}
+
+func (db *DB) Get(ctx context.Context, getKeys GetKeyFunc, fetch FetchItemFunc, opt ...options.Option) (*dynamodb.GetItemOutput, error) {
+	return Get(ctx, db.client, getKeys, fetch, opt...)
+}
+
+func (db *DB) Put(ctx context.Context, items WriteItem, opt ...options.Option) (*dynamodb.PutItemOutput, error) {
+	return Put(ctx, db.client, items, opt...)
+}
+
+func (db *DB) Update(ctx context.Context, items WriteItem, opt ...options.Option) (*dynamodb.UpdateItemOutput, error) {
+	return Update(ctx, db.client, items, opt...)
+}
+
+func (db *DB) Delete(ctx context.Context, items WriteItem, opt ...options.Option) (*dynamodb.DeleteItemOutput, error) {
+	return Delete(ctx, db.client, items, opt...)
+}
+
+func (db *DB) Query(ctx context.Context, condition QueryConditionFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.QueryOutput, error) {
+	return Query(ctx, db.client, condition, fetch, opt...)
+}
+
+func (db *DB) QueryAll(ctx context.Context, condition QueryConditionFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.QueryOutput, error) {
+	return QueryAll(ctx, db.client, condition, fetch, opt...)
+}
+
+func (db *DB) Scan(ctx context.Context, condition ScanFilterFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.ScanOutput, error) {
+	return Scan(ctx, db.client, condition, fetch, opt...)
+}
+
+func (db *DB) ScanAll(ctx context.Context, condition ScanFilterFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.ScanOutput, error) {
+	return ScanAll(ctx, db.client, condition, fetch, opt...)
+}
+
+// dbClient applies the settings of db to the requests.
+type dbClient struct {
+	db *DB
+}
+
+// prepare 呼び出し元の入力を書き換えないようにコピーしてから設定を適用する
+func prepare[T any](ctx context.Context, db *DB, operation string, params *T, tables func(in *T)) (*T, error) {
+	in := new(T)
+	if params != nil {
+		*in = *params
+	}
+	if tables != nil && db.resolver != nil {
+		tables(in)
+	}
+	applyDefaults(in, db.defaults)
+	for _, h := range db.hooks {
+		if err := h(ctx, operation, in); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// applyDefaults Sets the fields of in that are zero to the values set by defaults.
+func applyDefaults[T any](in *T, defaults []options.Option) {
+	if len(defaults) == 0 {
+		return
+	}
+	probe := new(T)
+	for _, f := range defaults {
+		probe = f(probe).(*T)
+	}
+	dst, src := reflect.ValueOf(in).Elem(), reflect.ValueOf(probe).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if v := src.Field(i); !v.IsZero() && dst.Field(i).CanSet() && dst.Field(i).IsZero() {
+			dst.Field(i).Set(v)
+		}
+	}
+}
+
+func (db *DB) resolve(name *string) *string {
+	if name == nil {
+		return nil
+	}
+	return aws.String(db.TableName(*name))
+}
+
+// tableNames 物理名から論理名への対応
+type tableNames map[string]string
+
+func (names tableNames) resolve(db *DB, name string) string {
+	physical := db.TableName(name)
+	names[physical] = name
+	return physical
+}
+
+func logicalKeys[V any](names tableNames, m map[string]V) map[string]V {
+	if len(m) == 0 {
+		return m
+	}
+	values := make(map[string]V, len(m))
+	for k, v := range m {
+		if name, ok := names[k]; ok {
+			k = name
+		}
+		values[k] = v
+	}
+	return values
+}
+
+func (c *dbClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	in, err := prepare(ctx, c.db, OperationGetItem, params, func(in *dynamodb.GetItemInput) {
+		in.TableName = c.db.resolve(in.TableName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoke(ctx, c.db, OperationGetItem, in, func(ctx context.Context, in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		return c.db.api.GetItem(ctx, in, optFns...)
+	})
+}
+
+func (c *dbClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	in, err := prepare(ctx, c.db, OperationPutItem, params, func(in *dynamodb.PutItemInput) {
+		in.TableName = c.db.resolve(in.TableName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoke(ctx, c.db, OperationPutItem, in, func(ctx context.Context, in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+		return c.db.api.PutItem(ctx, in, optFns...)
+	})
+}
+
+func (c *dbClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	in, err := prepare(ctx, c.db, OperationUpdateItem, params, func(in *dynamodb.UpdateItemInput) {
+		in.TableName = c.db.resolve(in.TableName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoke(ctx, c.db, OperationUpdateItem, in, func(ctx context.Context, in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+		return c.db.api.UpdateItem(ctx, in, optFns...)
+	})
+}
+
+func (c *dbClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	in, err := prepare(ctx, c.db, OperationDeleteItem, params, func(in *dynamodb.DeleteItemInput) {
+		in.TableName = c.db.resolve(in.TableName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoke(ctx, c.db, OperationDeleteItem, in, func(ctx context.Context, in *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+		return c.db.api.DeleteItem(ctx, in, optFns...)
+	})
+}
+
+func (c *dbClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	in, err := prepare(ctx, c.db, OperationQuery, params, func(in *dynamodb.QueryInput) {
+		in.TableName = c.db.resolve(in.TableName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoke(ctx, c.db, OperationQuery, in, func(ctx context.Context, in *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		return c.db.api.Query(ctx, in, optFns...)
+	})
+}
+
+func (c *dbClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	in, err := prepare(ctx, c.db, OperationScan, params, func(in *dynamodb.ScanInput) {
+		in.TableName = c.db.resolve(in.TableName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoke(ctx, c.db, OperationScan, in, func(ctx context.Context, in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		return c.db.api.Scan(ctx, in, optFns...)
+	})
+}
+
+// BatchWriteItem UnprocessedItems and ItemCollectionMetrics of the output are keyed by the names of the input.
+func (c *dbClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	names := tableNames{}
+	in, err := prepare(ctx, c.db, OperationBatchWriteItem, params, func(in *dynamodb.BatchWriteItemInput) {
+		items := make(map[string][]types.WriteRequest, len(in.RequestItems))
+		for name, requests := range in.RequestItems {
+			items[names.resolve(c.db, name)] = requests
+		}
+		in.RequestItems = items
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := invoke(ctx, c.db, OperationBatchWriteItem, in, func(ctx context.Context, in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+		return c.db.api.BatchWriteItem(ctx, in, optFns...)
+	})
+	if err != nil || len(names) == 0 {
+		return out, err
+	}
+	out.UnprocessedItems = logicalKeys(names, out.UnprocessedItems)
+	out.ItemCollectionMetrics = logicalKeys(names, out.ItemCollectionMetrics)
+	return out, nil
+}
+
+// BatchGetItem Responses and UnprocessedKeys of the output are keyed by the names of the input.
+func (c *dbClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	names := tableNames{}
+	in, err := prepare(ctx, c.db, OperationBatchGetItem, params, func(in *dynamodb.BatchGetItemInput) {
+		items := make(map[string]types.KeysAndAttributes, len(in.RequestItems))
+		for name, keys := range in.RequestItems {
+			items[names.resolve(c.db, name)] = keys
+		}
+		in.RequestItems = items
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := invoke(ctx, c.db, OperationBatchGetItem, in, func(ctx context.Context, in *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		return c.db.api.BatchGetItem(ctx, in, optFns...)
+	})
+	if err != nil || len(names) == 0 {
+		return out, err
+	}
+	out.Responses = logicalKeys(names, out.Responses)
+	out.UnprocessedKeys = logicalKeys(names, out.UnprocessedKeys)
+	return out, nil
+}
+
+func (c *dbClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	in, err := prepare(ctx, c.db, OperationTransactWriteItems, params, func(in *dynamodb.TransactWriteItemsInput) {
+		items := make([]types.TransactWriteItem, len(in.TransactItems))
+		for i, item := range in.TransactItems {
+			if v := item.ConditionCheck; v != nil {
+				check := *v
+				check.TableName = c.db.resolve(check.TableName)
+				item.ConditionCheck = &check
+			}
+			if v := item.Put; v != nil {
+				put := *v
+				put.TableName = c.db.resolve(put.TableName)
+				item.Put = &put
+			}
+			if v := item.Update; v != nil {
+				update := *v
+				update.TableName = c.db.resolve(update.TableName)
+				item.Update = &update
+			}
+			if v := item.Delete; v != nil {
+				del := *v
+				del.TableName = c.db.resolve(del.TableName)
+				item.Delete = &del
+			}
+			items[i] = item
+		}
+		in.TransactItems = items
+	})
+	if err != nil {
+		return nil, err
+	}
+	if in.ClientRequestToken == nil {
+		// 再試行しても二重に適用されないようにする
+		in.ClientRequestToken = aws.String(uuid.NewString())
+	}
+	return invoke(ctx, c.db, OperationTransactWriteItems, in, func(ctx context.Context, in *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+		return c.db.api.TransactWriteItems(ctx, in, optFns...)
+	})
+}
+
+func (c *dbClient) TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	in, err := prepare(ctx, c.db, OperationTransactGetItems, params, func(in *dynamodb.TransactGetItemsInput) {
+		items := make([]types.TransactGetItem, len(in.TransactItems))
+		for i, item := range in.TransactItems {
+			if v := item.Get; v != nil {
+				get := *v
+				get.TableName = c.db.resolve(get.TableName)
+				item.Get = &get
+			}
+			items[i] = item
+		}
+		in.TransactItems = items
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoke(ctx, c.db, OperationTransactGetItems, in, func(ctx context.Context, in *dynamodb.TransactGetItemsInput) (*dynamodb.TransactGetItemsOutput, error) {
+		return c.db.api.TransactGetItems(ctx, in, optFns...)
+	})
+}
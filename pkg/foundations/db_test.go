@@ -0,0 +1,115 @@
+package foundations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+func TestDB(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	for _, name := range []string{"dev_accounts", "prd_accounts"} {
+		if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName:            aws.String(name),
+			AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+			KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+			BillingMode:          types.BillingModePayPerRequest,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var operations []string
+	dev := NewDB(cli, TablePrefix("dev_"), ErrorWithEmptyList(true), Hooks(func(ctx context.Context, operation string, input any) error {
+		operations = append(operations, operation)
+		return nil
+	}))
+	prd := NewDB(cli, TableNames(func(name string) string { return "_" + name }), TablePrefix("prd"),
+		DefaultOptions(options.ReturnConsumedCapacity(types.ReturnConsumedCapacityTotal)))
+	if name := prd.TableName("accounts"); name != "prd_accounts" {
+		t.Fatalf("unexpected table name: %s", name)
+	}
+
+	repo, err := NewRepository[Account]("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Put(ctx, dev.Client(), &Account{ID: "a1", Balance: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = prd.Put(ctx, PutItem(ctx, "accounts", &Account{ID: "a1", Balance: 20})); err != nil {
+		t.Fatal(err)
+	}
+	var a Account
+	if _, err = dev.Get(ctx, repo.KeyOf("a1"), FetchItem(ctx, &a)); err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance != 10 {
+		t.Fatalf("unexpected account: %+v", a)
+	}
+
+	// 空の結果はDBごとの設定に従う
+	condition := func() (string, expression.Expression, error) {
+		expr, err := expression.NewBuilder().WithFilter(expression.Name("balance").GreaterThan(expression.Value(100))).Build()
+		return "accounts", expr, err
+	}
+	if _, err = dev.Scan(ctx, condition, FetchAll(ctx, []Account{})); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+	out, err := prd.Scan(ctx, condition, FetchAll(ctx, []Account{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ConsumedCapacity == nil {
+		t.Fatal("expected the consumed capacity of the default options")
+	}
+	// 明示したオプションが優先される
+	out, err = prd.Scan(ctx, condition, FetchAll(ctx, []Account{}), options.ReturnConsumedCapacity(types.ReturnConsumedCapacityNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ConsumedCapacity != nil {
+		t.Fatal("expected no consumed capacity")
+	}
+
+	// batch outputs are keyed by the logical names
+	key := map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}}
+	got, err := prd.Client().BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{"accounts": {Keys: []map[string]types.AttributeValue{key}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Responses["accounts"]) != 1 {
+		t.Fatalf("unexpected responses: %v", got.Responses)
+	}
+	if _, err = dev.Client().TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{{Delete: &types.Delete{TableName: aws.String("accounts"), Key: key}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dev.Get(ctx, repo.KeyOf("a1"), FetchItem(ctx, &a)); !IsItemNotFound(err) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+	if _, err = prd.Get(ctx, repo.KeyOf("a1"), FetchItem(ctx, &a)); err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 5 || operations[3] != "TransactWriteItems" {
+		t.Fatalf("unexpected operations: %v", operations)
+	}
+
+	stop := errors.New("stop")
+	blocked := NewDB(cli, Hooks(func(ctx context.Context, operation string, input any) error {
+		return stop
+	}))
+	if _, err = blocked.Get(ctx, repo.KeyOf("a1"), FetchItem(ctx, &a)); !errors.Is(err, stop) {
+		t.Fatalf("expected the error of the hook, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package foundations
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrItemNotFound is returned when the requested item does not exist.
+	ErrItemNotFound = errors.New("item not found")
+	// ErrTableNotFound is returned when the table or the index does not exist.
+	ErrTableNotFound = errors.New("table not found")
+	// ErrConditionFailed is returned when a condition expression is not satisfied. Error.Item is the current item if it was returned.
+	ErrConditionFailed = errors.New("condition check failed")
+	// ErrThrottled is returned when the request exceeds the throughput or the request limit.
+	ErrThrottled = errors.New("throttled")
+	// ErrValidation is returned when the request is invalid.
+	ErrValidation = errors.New("validation error")
+)
+
+// Error is an error of the DynamoDB API classified by Kind.
+// It matches Kind and the original error with errors.Is and errors.As.
+type Error struct {
+	Kind  error
+	Table string
+	// Item is the current item of ErrConditionFailed.
+	Item Record
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	if e.Table != "" {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Table)
+	}
+	return e.Kind.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+func itemNotFound(table string) error {
+	return errors.WithStack(&Error{Kind: ErrItemNotFound, Table: table})
+}
+
+// Classify Returns err wrapped in an Error of its kind. Errors of other kinds are returned as they are.
+func Classify(table string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	kind, item := classify(err)
+	if kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, Table: table, Item: item, Err: err}
+}
+
+func classify(err error) (kind error, item Record) {
+	var (
+		resourceNotFound *types.ResourceNotFoundException
+		tableNotFound    *types.TableNotFoundException
+		indexNotFound    *types.IndexNotFoundException
+		conditionFailed  *types.ConditionalCheckFailedException
+		throughput       *types.ProvisionedThroughputExceededException
+		requestLimit     *types.RequestLimitExceeded
+		canceled         *types.TransactionCanceledException
+		api              smithy.APIError
+	)
+	switch {
+	case errors.As(err, &resourceNotFound), errors.As(err, &tableNotFound), errors.As(err, &indexNotFound):
+		return ErrTableNotFound, nil
+	case errors.As(err, &conditionFailed):
+		return ErrConditionFailed, conditionFailed.Item
+	case errors.As(err, &throughput), errors.As(err, &requestLimit):
+		return ErrThrottled, nil
+	case errors.As(err, &canceled):
+		for _, reason := range canceled.CancellationReasons {
+			switch aws.ToString(reason.Code) {
+			case "ConditionalCheckFailed":
+				return ErrConditionFailed, reason.Item
+			case "ThrottlingError", "ProvisionedThroughputExceeded":
+				kind = ErrThrottled
+			case "ValidationError":
+				if kind == nil {
+					kind = ErrValidation
+				}
+			}
+		}
+		return kind, nil
+	case errors.As(err, &api):
+		switch api.ErrorCode() {
+		case "ThrottlingException":
+			return ErrThrottled, nil
+		case "ValidationException", "SerializationException":
+			return ErrValidation, nil
+		}
+	}
+	return nil, nil
+}
+
+// IsItemNotFound Reports whether the item does not exist.
+func IsItemNotFound(err error) bool {
+	return errors.Is(err, ErrItemNotFound)
+}
+
+// IsTableNotFound Reports whether the table or the index does not exist.
+func IsTableNotFound(err error) bool {
+	if errors.Is(err, ErrTableNotFound) {
+		return true
+	}
+	kind, _ := classify(err)
+	return kind == ErrTableNotFound
+}
+
+// IsRetryable Reports whether the request can succeed if it is retried later.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrThrottled) {
+		return true
+	}
+	if kind, _ := classify(err); kind == ErrThrottled {
+		return true
+	}
+	var (
+		internal   *types.InternalServerError
+		conflict   *types.TransactionConflictException
+		inProgress *types.TransactionInProgressException
+		limit      *types.LimitExceededException
+		canceled   *types.TransactionCanceledException
+		response   *smithyhttp.ResponseError
+	)
+	switch {
+	case errors.As(err, &internal), errors.As(err, &conflict), errors.As(err, &inProgress), errors.As(err, &limit):
+		return true
+	case errors.As(err, &canceled):
+		for _, reason := range canceled.CancellationReasons {
+			if aws.ToString(reason.Code) == "TransactionConflict" {
+				return true
+			}
+		}
+		return false
+	case errors.As(err, &response):
+		return response.HTTPStatusCode() >= http.StatusInternalServerError
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package foundations
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+func TestErrors(t *testing.T) {
+	ctx, cli := setupAccounts(t)
+	repo, err := NewRepository[Account]("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Get(ctx, cli, repo.KeyOf("a1"))
+	if !errors.Is(err, ErrItemNotFound) || IsTableNotFound(err) || !IsNotFound(err) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+	_, err = Get(ctx, cli, func() (string, map[string]types.AttributeValue, []string, error) {
+		return "missing", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}}, nil, nil
+	}, func(tableName string, value Record) error { return nil })
+	if !errors.Is(err, ErrTableNotFound) || IsItemNotFound(err) || !IsNotFound(err) {
+		t.Fatalf("expected ErrTableNotFound, got %v", err)
+	}
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected the original error, got %v", err)
+	}
+
+	if _, err = Put(ctx, cli, PutItem(ctx, "accounts", map[string]any{"id": "a1", "balance": 10})); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Put(ctx, cli, PutItem(ctx, "accounts", map[string]any{"id": "a1"}, func() (expression.Expression, error) {
+		return expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("id"))).Build()
+	}), options.ReturnValuesOnConditionCheckFailure(types.ReturnValuesOnConditionCheckFailureAllOld))
+	var e *Error
+	if !errors.As(err, &e) || e.Kind != ErrConditionFailed || e.Table != "accounts" {
+		t.Fatalf("expected ErrConditionFailed, got %v", err)
+	}
+	if e.Item == nil {
+		t.Fatal("expected the current item")
+	}
+	if IsRetryable(err) {
+		t.Fatal("condition failure is not retryable")
+	}
+	// version conflicts are condition failures
+	if _, err = Put(ctx, cli, PutItem(ctx, "accounts", &Account{ID: "a1", UpdateCnt: 5})); !errors.Is(err, ErrConditionFailed) {
+		t.Fatalf("expected ErrConditionFailed, got %v", err)
+	}
+
+	_, err = Put(ctx, cli, PutItem(ctx, "accounts", map[string]any{"balance": 10}))
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("expected ErrValidation, got %v", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: &types.ProvisionedThroughputExceededException{}, want: true},
+		{err: &types.RequestLimitExceeded{}, want: true},
+		{err: &smithy.GenericAPIError{Code: "ThrottlingException"}, want: true},
+		{err: &types.InternalServerError{}, want: true},
+		{err: &types.TransactionConflictException{}, want: true},
+		{err: &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")}, {Code: aws.String("TransactionConflict")},
+		}}, want: true},
+		{err: &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("ConditionalCheckFailed")},
+		}}, want: false},
+		{err: &smithy.GenericAPIError{Code: "ValidationException"}, want: false},
+		{err: &types.ResourceNotFoundException{}, want: false},
+		{err: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%T) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+	if err := Classify("t", &types.ProvisionedThroughputExceededException{}); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+}
@@ -15,8 +15,8 @@ type EvaluatedValue struct {
 	Value string `json:"v"`
 }
 
-func (ek EvaluatedKey) String() (string, error) {
-	m := make(map[string]EvaluatedValue, 2)
+func (ek EvaluatedKey) values() (map[string]EvaluatedValue, error) {
+	m := make(map[string]EvaluatedValue, len(ek))
 	for k, v := range ek {
 		switch val := v.(type) {
 		case *types.AttributeValueMemberS:
@@ -29,28 +29,42 @@ func (ek EvaluatedKey) String() (string, error) {
 				Type:  "n",
 				Value: val.Value,
 			}
+		case *types.AttributeValueMemberB:
+			m[k] = EvaluatedValue{
+				Type:  "bin",
+				Value: base64.StdEncoding.EncodeToString(val.Value),
+			}
 		case *types.AttributeValueMemberBOOL:
 			m[k] = EvaluatedValue{
 				Type:  "b",
 				Value: strconv.FormatBool(val.Value),
 			}
+		default:
+			return nil, errors.Errorf("unsupported key type: %s=%T", k, v)
 		}
 	}
-	bin, err := json.Marshal(m)
-	if err != nil {
-		return "", err
-	}
-	return base64.RawURLEncoding.EncodeToString(bin), nil
+	return m, nil
 }
 
-func EvaluatedKeyOf(key string) (EvaluatedKey, error) {
-	bin, err := base64.RawURLEncoding.DecodeString(key)
+func (ek EvaluatedKey) MarshalJSON() ([]byte, error) {
+	if ek == nil {
+		return []byte("null"), nil
+	}
+	m, err := ek.values()
 	if err != nil {
 		return nil, err
 	}
-	m := make(map[string]EvaluatedValue, 2)
-	if err = json.Unmarshal(bin, &m); err != nil {
-		return nil, err
+	return json.Marshal(m)
+}
+
+func (ek *EvaluatedKey) UnmarshalJSON(bin []byte) error {
+	var m map[string]EvaluatedValue
+	if err := json.Unmarshal(bin, &m); err != nil {
+		return err
+	}
+	if m == nil {
+		*ek = nil
+		return nil
 	}
 	values := make(EvaluatedKey, len(m))
 	for k, v := range m {
@@ -59,11 +73,42 @@ func EvaluatedKeyOf(key string) (EvaluatedKey, error) {
 			values[k] = &types.AttributeValueMemberS{Value: v.Value}
 		case "n":
 			values[k] = &types.AttributeValueMemberN{Value: v.Value}
+		case "bin":
+			b, err := base64.StdEncoding.DecodeString(v.Value)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			values[k] = &types.AttributeValueMemberB{Value: b}
 		case "b":
 			values[k] = &types.AttributeValueMemberBOOL{Value: v.Value == "true"}
 		default:
-			return nil, errors.Errorf("unsupported type: %T", v)
+			return errors.Errorf("unsupported type: %s", v.Type)
 		}
 	}
+	*ek = values
+	return nil
+}
+
+func (ek EvaluatedKey) String() (string, error) {
+	m, err := ek.values()
+	if err != nil {
+		return "", err
+	}
+	bin, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bin), nil
+}
+
+func EvaluatedKeyOf(key string) (EvaluatedKey, error) {
+	bin, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	var values EvaluatedKey
+	if err = values.UnmarshalJSON(bin); err != nil {
+		return nil, err
+	}
 	return values, nil
 }
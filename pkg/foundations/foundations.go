@@ -49,11 +49,13 @@ func IsNil(record interface{}) bool {
 
 var ErrNotFound *types.ResourceNotFoundException
 
+// IsNotFound Reports whether the item or the table does not exist. Use IsItemNotFound or IsTableNotFound to tell them apart.
 func IsNotFound(err error) bool {
-	var notFound *types.ResourceNotFoundException
-	return errors.As(err, &notFound)
+	return IsItemNotFound(err) || IsTableNotFound(err)
 }
 
+// NotFound
+// Deprecated: missing items are reported with ErrItemNotFound.
 func NotFound(tableName string) *types.ResourceNotFoundException {
 	msg := fmt.Sprintf("Requested resource not found: %s: record not found", tableName)
 	return &types.ResourceNotFoundException{Message: &msg}
@@ -85,8 +87,10 @@ func Get(ctx context.Context, cli GetClient, getKeys GetKeyFunc, fetch FetchItem
 		}
 	}
 	var out *dynamodb.GetItemOutput
-	if out, err = cli.GetItem(ctx, input); err != nil {
-		return nil, errors.WithStack(err)
+	if out, err = retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.GetItemOutput, error) {
+		return cli.GetItem(ctx, input)
+	}); err != nil {
+		return nil, errors.WithStack(Classify(table, err))
 	} else if out.Item != nil {
 		if err = fetch(table, out.Item); err != nil {
 			return nil, errors.WithStack(err)
@@ -94,7 +98,7 @@ func Get(ctx context.Context, cli GetClient, getKeys GetKeyFunc, fetch FetchItem
 			return out, nil
 		}
 	}
-	return nil, errors.WithStack(NotFound(table))
+	return nil, itemNotFound(table)
 }
 
 // EnableErrorWithEmptyList Make the list return an error if it is empty.
@@ -104,10 +108,10 @@ func EnableErrorWithEmptyList(v bool) {
 
 var errorWithEmptyList = false
 
-func Scan(ctx context.Context, cli ScanClient, condition ScanFilterFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.ScanOutput, error) {
+func scanInput(condition ScanFilterFunc, opt ...options.Option) (string, *dynamodb.ScanInput, error) {
 	table, expr, err := condition()
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 	input := &dynamodb.ScanInput{
 		TableName:                 &table,
@@ -121,49 +125,130 @@ func Scan(ctx context.Context, cli ScanClient, condition ScanFilterFunc, fetch F
 			input = f(input).(*dynamodb.ScanInput)
 		}
 	}
-	out, err := cli.Scan(ctx, input)
+	return table, input, nil
+}
+
+func Scan(ctx context.Context, cli ScanClient, condition ScanFilterFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.ScanOutput, error) {
+	table, out, err := scanPage(ctx, cli, condition, fetch, opt...)
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Items) == 0 && emptyListError(cli) {
+		return nil, itemNotFound(table)
+	}
+	return out, nil
+}
+
+func scanPage(ctx context.Context, cli ScanClient, condition ScanFilterFunc, fetch FetchItemsFunc, opt ...options.Option) (string, *dynamodb.ScanOutput, error) {
+	table, input, err := scanInput(condition, opt...)
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.ScanOutput, error) {
+		return cli.Scan(ctx, input)
+	})
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return "", nil, errors.WithStack(Classify(table, err))
 	}
 	if len(out.Items) > 0 {
 		if err = fetch(table, out.Items); err != nil {
-			return nil, err
-		} else {
-			return out, nil
+			return "", nil, err
 		}
 	}
-	if errorWithEmptyList {
-		return nil, errors.WithStack(NotFound(table))
-	}
-	return out, nil
+	return table, out, nil
 }
 
+// ScanAll Scans every page. Count, ScannedCount and ConsumedCapacity of the output are the totals of all pages,
+// and Items are those of the last page, so that the pages are not kept in memory.
+// With EnableErrorWithEmptyList, it fails only if no page has items.
 func ScanAll(ctx context.Context, cli ScanClient, condition ScanFilterFunc, fetch FetchItemsFunc, opt ...options.Option) (out *dynamodb.ScanOutput, err error) {
 	var key EvaluatedKey
+	var table string
+	total := &dynamodb.ScanOutput{}
+	found := false
 	for {
 		opts := make([]options.Option, len(opt))
 		copy(opts, opt)
 		if key != nil {
 			opts = append(opts, options.ExclusiveStartKey(key))
 		}
-		out, err = Scan(ctx, cli, condition, fetch, opts...)
+		table, out, err = scanPage(ctx, cli, condition, fetch, opts...)
 		if err != nil {
 			return nil, err
 		}
+		found = found || len(out.Items) > 0
+		total.Items = out.Items
+		total.Count += out.Count
+		total.ScannedCount += out.ScannedCount
+		total.ConsumedCapacity = mergeConsumedCapacity(total.ConsumedCapacity, out.ConsumedCapacity)
+		total.ResultMetadata = out.ResultMetadata
 		if out.LastEvaluatedKey == nil {
 			break
 		}
 		key = out.LastEvaluatedKey
 	}
-	return out, nil
+	if !found && emptyListError(cli) {
+		return nil, itemNotFound(table)
+	}
+	return total, nil
 }
 
-func Query(ctx context.Context, cli QueryClient, condition QueryConditionFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.QueryOutput, error) {
-	table, index, expr, err := condition()
+// QueryAll Queries every page. Count, ScannedCount and ConsumedCapacity of the output are the totals of all pages,
+// and Items are those of the last page, so that the pages are not kept in memory.
+// With EnableErrorWithEmptyList, it fails only if no page has items.
+func QueryAll(ctx context.Context, cli QueryClient, condition QueryConditionFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.QueryOutput, error) {
+	table, total, found, err := queryPages(ctx, cli, condition, fetch, opt...)
 	if err != nil {
 		return nil, err
 	}
+	if !found && emptyListError(cli) {
+		return nil, itemNotFound(table)
+	}
+	return total, nil
+}
+
+// QueryPages Queries every page as QueryAll does, but an empty result is not an error even with EnableErrorWithEmptyList.
+func QueryPages(ctx context.Context, cli QueryClient, condition QueryConditionFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.QueryOutput, error) {
+	_, total, _, err := queryPages(ctx, cli, condition, fetch, opt...)
+	if err != nil {
+		return nil, err
+	}
+	return total, nil
+}
+
+// queryPages 全ページを問い合わせ、集計した出力とアイテムがあったかどうかを返す
+func queryPages(ctx context.Context, cli QueryClient, condition QueryConditionFunc, fetch FetchItemsFunc, opt ...options.Option) (table string, total *dynamodb.QueryOutput, found bool, err error) {
+	var key EvaluatedKey
 	var out *dynamodb.QueryOutput
+	total = &dynamodb.QueryOutput{}
+	for {
+		opts := make([]options.Option, len(opt))
+		copy(opts, opt)
+		if key != nil {
+			opts = append(opts, options.ExclusiveStartKey(key))
+		}
+		table, out, err = queryPage(ctx, cli, condition, fetch, opts...)
+		if err != nil {
+			return table, nil, false, err
+		}
+		found = found || len(out.Items) > 0
+		total.Items = out.Items
+		total.Count += out.Count
+		total.ScannedCount += out.ScannedCount
+		total.ConsumedCapacity = mergeConsumedCapacity(total.ConsumedCapacity, out.ConsumedCapacity)
+		total.ResultMetadata = out.ResultMetadata
+		if out.LastEvaluatedKey == nil {
+			return table, total, found, nil
+		}
+		key = out.LastEvaluatedKey
+	}
+}
+
+func queryInput(condition QueryConditionFunc, opt ...options.Option) (string, *dynamodb.QueryInput, error) {
+	table, index, expr, err := condition()
+	if err != nil {
+		return "", nil, err
+	}
 	var indexName *string
 	if index != "" {
 		indexName = aws.String(index)
@@ -182,23 +267,40 @@ func Query(ctx context.Context, cli QueryClient, condition QueryConditionFunc, f
 			input = f(input).(*dynamodb.QueryInput)
 		}
 	}
-	if out, err = cli.Query(ctx, input); err != nil {
-		return nil, errors.WithStack(err)
+	return table, input, nil
+}
+
+func Query(ctx context.Context, cli QueryClient, condition QueryConditionFunc, fetch FetchItemsFunc, opt ...options.Option) (*dynamodb.QueryOutput, error) {
+	table, out, err := queryPage(ctx, cli, condition, fetch, opt...)
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Items) == 0 && emptyListError(cli) {
+		return nil, itemNotFound(table)
+	}
+	return out, nil
+}
+
+func queryPage(ctx context.Context, cli QueryClient, condition QueryConditionFunc, fetch FetchItemsFunc, opt ...options.Option) (string, *dynamodb.QueryOutput, error) {
+	table, input, err := queryInput(condition, opt...)
+	if err != nil {
+		return "", nil, err
+	}
+	var out *dynamodb.QueryOutput
+	if out, err = retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.QueryOutput, error) {
+		return cli.Query(ctx, input)
+	}); err != nil {
+		return "", nil, errors.WithStack(Classify(table, err))
 	} else if len(out.Items) > 0 {
 		if err = fetch(table, out.Items); err != nil {
-			return nil, err
-		} else {
-			return out, nil
+			return "", nil, err
 		}
 	}
-	if errorWithEmptyList {
-		return nil, errors.WithStack(NotFound(table))
-	}
-	return out, nil
+	return table, out, nil
 }
 
-func Put(ctx context.Context, cli WriteClient, items WriteItemFunc, opt ...options.Option) (*dynamodb.PutItemOutput, error) {
-	table, item, expr, err := items()
+func Put(ctx context.Context, cli WriteClient, items WriteItem, opt ...options.Option) (*dynamodb.PutItemOutput, error) {
+	table, item, expr, version, err := items.WriteItem()
 	if err != nil {
 		return nil, err
 	}
@@ -209,20 +311,27 @@ func Put(ctx context.Context, cli WriteClient, items WriteItemFunc, opt ...optio
 		ExpressionAttributeValues: expr.Values(),
 		ConditionExpression:       expr.Condition(),
 	}
+	check := VersionCheckOf(table, version, item)
+	input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 	if len(opt) > 0 {
 		for _, f := range opt {
 			input = f(input).(*dynamodb.PutItemInput)
 		}
 	}
 	var out *dynamodb.PutItemOutput
-	if out, err = cli.PutItem(ctx, input); err != nil {
-		return nil, errors.WithStack(err)
+	if out, err = retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.PutItemOutput, error) {
+		return cli.PutItem(ctx, input)
+	}); err != nil {
+		if conflict := versionConflict(check, err); conflict != nil {
+			return nil, errors.WithStack(conflict)
+		}
+		return nil, errors.WithStack(Classify(table, err))
 	}
 	return out, nil
 }
 
-func Update(ctx context.Context, cli WriteClient, items WriteItemFunc, opt ...options.Option) (*dynamodb.UpdateItemOutput, error) {
-	table, item, expr, err := items()
+func Update(ctx context.Context, cli WriteClient, items WriteItem, opt ...options.Option) (*dynamodb.UpdateItemOutput, error) {
+	table, item, expr, version, err := items.WriteItem()
 	if err != nil {
 		return nil, err
 	}
@@ -234,20 +343,27 @@ func Update(ctx context.Context, cli WriteClient, items WriteItemFunc, opt ...op
 		ExpressionAttributeNames:  expr.Names(),
 		ConditionExpression:       expr.Condition(),
 	}
+	check := VersionCheckOf(table, version, item)
+	input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 	if len(opt) > 0 {
 		for _, f := range opt {
 			input = f(input).(*dynamodb.UpdateItemInput)
 		}
 	}
 	var out *dynamodb.UpdateItemOutput
-	if out, err = cli.UpdateItem(ctx, input); err != nil {
-		return nil, errors.WithStack(err)
+	if out, err = retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.UpdateItemOutput, error) {
+		return cli.UpdateItem(ctx, input)
+	}); err != nil {
+		if conflict := versionConflict(check, err); conflict != nil {
+			return nil, errors.WithStack(conflict)
+		}
+		return nil, errors.WithStack(Classify(table, err))
 	}
 	return out, nil
 }
 
-func Delete(ctx context.Context, cli WriteClient, items WriteItemFunc, opt ...options.Option) (*dynamodb.DeleteItemOutput, error) {
-	table, keys, expr, err := items()
+func Delete(ctx context.Context, cli WriteClient, items WriteItem, opt ...options.Option) (*dynamodb.DeleteItemOutput, error) {
+	table, keys, expr, version, err := items.WriteItem()
 	if err != nil {
 		return nil, err
 	}
@@ -258,19 +374,46 @@ func Delete(ctx context.Context, cli WriteClient, items WriteItemFunc, opt ...op
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 	}
+	check := VersionCheckOf(table, version, keys)
+	input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 	if len(opt) > 0 {
 		for _, f := range opt {
 			input = f(input).(*dynamodb.DeleteItemInput)
 		}
 	}
 	var out *dynamodb.DeleteItemOutput
-	if out, err = cli.DeleteItem(ctx, input); err != nil {
-		return nil, err
+	if out, err = retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.DeleteItemOutput, error) {
+		return cli.DeleteItem(ctx, input)
+	}); err != nil {
+		if conflict := versionConflict(check, err); conflict != nil {
+			return nil, errors.WithStack(conflict)
+		}
+		return nil, errors.WithStack(Classify(table, err))
 	}
 	return out, nil
 }
 
 type WriteItemFunc func() (table string, item map[string]types.AttributeValue, expr expression.Expression, err error)
+
+// WriteItem Returns the write of f, which is not versioned.
+func (f WriteItemFunc) WriteItem() (table string, item map[string]types.AttributeValue, expr expression.Expression, version string, err error) {
+	table, item, expr, err = f()
+	return
+}
+
+// VersionedWriteItemFunc is a WriteItemFunc that also returns the name of the version attribute of its condition,
+// or an empty name if the write is not versioned.
+type VersionedWriteItemFunc func() (table string, item map[string]types.AttributeValue, expr expression.Expression, version string, err error)
+
+// WriteItem Returns the write of f and the name of its version attribute.
+func (f VersionedWriteItemFunc) WriteItem() (table string, item map[string]types.AttributeValue, expr expression.Expression, version string, err error) {
+	return f()
+}
+
+// WriteItem is a WriteItemFunc or a VersionedWriteItemFunc. The writes of a VersionedWriteItemFunc are checked for version conflicts.
+type WriteItem interface {
+	WriteItem() (table string, item map[string]types.AttributeValue, expr expression.Expression, version string, err error)
+}
 type GetItemFunc WriteItemFunc
 
 type UpdateField func(ctx context.Context, builder *expression.UpdateBuilder) expression.UpdateBuilder
@@ -297,20 +440,26 @@ type FetchItemsPostprocessor interface {
 
 type ExpressionFunc func() (expr expression.Expression, err error)
 
-func PutItem(ctx context.Context, tableName string, rec any, f ...ExpressionFunc) WriteItemFunc {
-	return func() (table string, item map[string]types.AttributeValue, expr expression.Expression, err error) {
-		if preprocessor, ok := rec.(PutItemPreprocessor); ok {
-			rec, err = preprocessor.BeforePutItem(ctx)
-			if err != nil {
+// PutItem Returns a VersionedWriteItemFunc that puts rec. If rec has a version attribute, the put is conditioned on its version.
+func PutItem(ctx context.Context, tableName string, rec any, f ...ExpressionFunc) VersionedWriteItemFunc {
+	return func() (table string, item map[string]types.AttributeValue, expr expression.Expression, name string, err error) {
+		var v *version
+		if item, v, err = marshalRecord(ctx, rec); err != nil {
+			return
+		}
+		if v != nil {
+			// バージョン属性がある場合は楽観ロックの条件を付与する
+			if len(f) > 0 {
+				err = fmt.Errorf("%T has a version attribute, use ConditionalPutItem to add a condition", rec)
+				return
+			}
+			item[v.name] = v.next()
+			if expr, err = expression.NewBuilder().WithCondition(v.condition()).Build(); err != nil {
 				err = errors.WithStack(err)
 				return
 			}
-		}
-		if item, err = attributevalue.MarshalMap(rec); err != nil {
-			err = errors.WithStack(err)
-			return
-		}
-		if len(f) > 0 {
+			name = v.name
+		} else if len(f) > 0 {
 			expr, err = f[0]()
 		}
 		table = tableName
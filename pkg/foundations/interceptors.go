@@ -0,0 +1,105 @@
+package foundations
+
+import (
+	"context"
+	"time"
+
+	"github.com/goccha/dynamodb-verse/pkg/capacity"
+)
+
+const (
+	OperationGetItem            = "GetItem"
+	OperationPutItem            = "PutItem"
+	OperationUpdateItem         = "UpdateItem"
+	OperationDeleteItem         = "DeleteItem"
+	OperationQuery              = "Query"
+	OperationScan               = "Scan"
+	OperationBatchWriteItem     = "BatchWriteItem"
+	OperationBatchGetItem       = "BatchGetItem"
+	OperationTransactWriteItems = "TransactWriteItems"
+	OperationTransactGetItems   = "TransactGetItems"
+)
+
+// Interceptor is called around every request of DB.Client.
+// input is the typed input of the operation (e.g. *dynamodb.GetItemInput) with the table names resolved,
+// and it can be modified in BeforeRequest. output is the typed output, or nil if err is not nil.
+type Interceptor interface {
+	// BeforeRequest An error cancels the request. The returned context is passed to the request and AfterResponse.
+	BeforeRequest(ctx context.Context, operation string, input any) (context.Context, error)
+	AfterResponse(ctx context.Context, operation string, input, output any, err error, duration time.Duration)
+}
+
+// InterceptorFuncs is an Interceptor made of functions. Nil functions are skipped.
+type InterceptorFuncs struct {
+	Before func(ctx context.Context, operation string, input any) (context.Context, error)
+	After  func(ctx context.Context, operation string, input, output any, err error, duration time.Duration)
+}
+
+func (f InterceptorFuncs) BeforeRequest(ctx context.Context, operation string, input any) (context.Context, error) {
+	if f.Before == nil {
+		return ctx, nil
+	}
+	return f.Before(ctx, operation, input)
+}
+
+func (f InterceptorFuncs) AfterResponse(ctx context.Context, operation string, input, output any, err error, duration time.Duration) {
+	if f.After != nil {
+		f.After(ctx, operation, input, output, err, duration)
+	}
+}
+
+// Interceptors Registers interceptors. BeforeRequest is called in the order of registration and AfterResponse in the reverse order.
+func Interceptors(interceptors ...Interceptor) DBOption {
+	return func(db *DB) {
+		db.interceptors = append(db.interceptors, interceptors...)
+	}
+}
+
+// invoke リトライポリシーとインターセプターを通してリクエストを実行する
+func invoke[In, Out any](ctx context.Context, db *DB, operation string, in *In, call func(ctx context.Context, in *In) (*Out, error)) (*Out, error) {
+	p := RetryPolicyFrom(ctx)
+	if p == nil {
+		p = db.retry
+	}
+	return retry(ctx, p, in, func(ctx context.Context) (*Out, error) {
+		return intercept(ctx, db, operation, in, call)
+	})
+}
+
+// intercept インターセプターを通してリクエストを1回実行する
+func intercept[In, Out any](ctx context.Context, db *DB, operation string, in *In, call func(ctx context.Context, in *In) (*Out, error)) (*Out, error) {
+	ctx = capacity.Request(ctx, in)
+	if len(db.interceptors) == 0 {
+		out, err := call(ctx, in)
+		if err == nil {
+			capacity.Response(ctx, out)
+		}
+		return out, err
+	}
+	contexts := make([]context.Context, 0, len(db.interceptors))
+	after := func(out *Out, err error, duration time.Duration) {
+		var output any
+		if out != nil {
+			output = out
+		}
+		for i := len(contexts) - 1; i >= 0; i-- {
+			db.interceptors[i].AfterResponse(contexts[i], operation, in, output, err, duration)
+		}
+	}
+	for _, interceptor := range db.interceptors {
+		c, err := interceptor.BeforeRequest(ctx, operation, in)
+		if err != nil {
+			after(nil, err, 0)
+			return nil, err
+		}
+		ctx = c
+		contexts = append(contexts, ctx)
+	}
+	start := time.Now()
+	out, err := call(ctx, in)
+	if err == nil {
+		capacity.Response(ctx, out)
+	}
+	after(out, err, time.Since(start))
+	return out, err
+}
@@ -0,0 +1,85 @@
+package foundations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type traceKey struct{}
+
+func TestInterceptors(t *testing.T) {
+	ctx, cli := setupAccounts(t)
+	var calls []string
+	trace := InterceptorFuncs{
+		Before: func(ctx context.Context, operation string, input any) (context.Context, error) {
+			calls = append(calls, "before:"+operation)
+			return context.WithValue(ctx, traceKey{}, operation), nil
+		},
+		After: func(ctx context.Context, operation string, input, output any, err error, duration time.Duration) {
+			if ctx.Value(traceKey{}) != operation {
+				t.Errorf("expected the context of BeforeRequest")
+			}
+			if err == nil && output == nil {
+				t.Errorf("expected the output of %s", operation)
+			}
+			calls = append(calls, "after:"+operation)
+		},
+	}
+	denied := errors.New("denied")
+	guard := InterceptorFuncs{
+		Before: func(ctx context.Context, operation string, input any) (context.Context, error) {
+			switch in := input.(type) {
+			case *dynamodb.PutItemInput:
+				// リクエストを書き換える
+				in.Item["tenant"] = &types.AttributeValueMemberS{Value: "t1"}
+			case *dynamodb.DeleteItemInput:
+				return ctx, denied
+			}
+			return ctx, nil
+		},
+	}
+	db := NewDB(cli, Interceptors(trace, guard))
+	if _, err := db.Put(ctx, PutItem(ctx, "accounts", map[string]any{"id": "a1"})); err != nil {
+		t.Fatal(err)
+	}
+	var rec map[string]any
+	if _, err := db.Get(ctx, func() (string, map[string]types.AttributeValue, []string, error) {
+		return "accounts", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}}, nil, nil
+	}, FetchItem(ctx, &rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec["tenant"] != "t1" {
+		t.Fatalf("expected the modified item, got %v", rec)
+	}
+	if _, err := db.Delete(ctx, DeleteItem(func() (string, map[string]types.AttributeValue, []string, error) {
+		return "accounts", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}}, nil, nil
+	})); !errors.Is(err, denied) {
+		t.Fatalf("expected the error of the interceptor, got %v", err)
+	}
+	if _, err := db.Client().BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{"accounts": {Keys: []map[string]types.AttributeValue{
+			{"id": &types.AttributeValueMemberS{Value: "a1"}},
+		}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"before:PutItem", "after:PutItem",
+		"before:GetItem", "after:GetItem",
+		"before:DeleteItem", "after:DeleteItem",
+		"before:BatchGetItem", "after:BatchGetItem",
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("unexpected calls: %v", calls)
+		}
+	}
+}
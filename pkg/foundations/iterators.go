@@ -0,0 +1,159 @@
+package foundations
+
+import (
+	"context"
+	"iter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/pkg/errors"
+)
+
+// PageStats Totals of the pages fetched by QueryIter and ScanIter.
+type PageStats struct {
+	Pages            int
+	Count            int32
+	ScannedCount     int32
+	ConsumedCapacity *types.ConsumedCapacity
+	// LastEvaluatedKey is the key of the last fetched page, nil when every page was read.
+	LastEvaluatedKey EvaluatedKey
+}
+
+func (s *PageStats) add(count, scanned int32, capacity *types.ConsumedCapacity, key EvaluatedKey) {
+	if s == nil {
+		return
+	}
+	s.Pages++
+	s.Count += count
+	s.ScannedCount += scanned
+	s.ConsumedCapacity = mergeConsumedCapacity(s.ConsumedCapacity, capacity)
+	s.LastEvaluatedKey = key
+}
+
+// QueryIter Iterates the items of every page of the query, fetching the next page lazily.
+// stats may be nil.
+func QueryIter[T any](ctx context.Context, cli QueryClient, condition QueryConditionFunc, stats *PageStats, opt ...options.Option) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		table, input, err := queryInput(condition, opt...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for {
+			out, err := retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.QueryOutput, error) {
+				return cli.Query(ctx, input)
+			})
+			if err != nil {
+				yield(zero, errors.WithStack(Classify(table, err)))
+				return
+			}
+			stats.add(out.Count, out.ScannedCount, out.ConsumedCapacity, out.LastEvaluatedKey)
+			if !yieldItems(ctx, out.Items, yield) {
+				return
+			}
+			if out.LastEvaluatedKey == nil {
+				return
+			}
+			input.ExclusiveStartKey = out.LastEvaluatedKey
+		}
+	}
+}
+
+// ScanIter Iterates the items of every page of the scan, fetching the next page lazily.
+// stats may be nil.
+func ScanIter[T any](ctx context.Context, cli ScanClient, condition ScanFilterFunc, stats *PageStats, opt ...options.Option) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		table, input, err := scanInput(condition, opt...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for {
+			out, err := retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.ScanOutput, error) {
+				return cli.Scan(ctx, input)
+			})
+			if err != nil {
+				yield(zero, errors.WithStack(Classify(table, err)))
+				return
+			}
+			stats.add(out.Count, out.ScannedCount, out.ConsumedCapacity, out.LastEvaluatedKey)
+			if !yieldItems(ctx, out.Items, yield) {
+				return
+			}
+			if out.LastEvaluatedKey == nil {
+				return
+			}
+			input.ExclusiveStartKey = out.LastEvaluatedKey
+		}
+	}
+}
+
+func yieldItems[T any](ctx context.Context, items []map[string]types.AttributeValue, yield func(T, error) bool) bool {
+	for _, item := range items {
+		var v T
+		if err := Record(item).Unmarshal(ctx, &v); err != nil {
+			var zero T
+			yield(zero, err)
+			return false
+		}
+		if !yield(v, nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeConsumedCapacity adds the units of src to dst.
+func mergeConsumedCapacity(dst, src *types.ConsumedCapacity) *types.ConsumedCapacity {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = &types.ConsumedCapacity{TableName: src.TableName}
+	}
+	dst.CapacityUnits = addUnits(dst.CapacityUnits, src.CapacityUnits)
+	dst.ReadCapacityUnits = addUnits(dst.ReadCapacityUnits, src.ReadCapacityUnits)
+	dst.WriteCapacityUnits = addUnits(dst.WriteCapacityUnits, src.WriteCapacityUnits)
+	dst.Table = mergeCapacity(dst.Table, src.Table)
+	dst.GlobalSecondaryIndexes = mergeIndexCapacity(dst.GlobalSecondaryIndexes, src.GlobalSecondaryIndexes)
+	dst.LocalSecondaryIndexes = mergeIndexCapacity(dst.LocalSecondaryIndexes, src.LocalSecondaryIndexes)
+	return dst
+}
+
+func mergeCapacity(dst, src *types.Capacity) *types.Capacity {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = &types.Capacity{}
+	}
+	dst.CapacityUnits = addUnits(dst.CapacityUnits, src.CapacityUnits)
+	dst.ReadCapacityUnits = addUnits(dst.ReadCapacityUnits, src.ReadCapacityUnits)
+	dst.WriteCapacityUnits = addUnits(dst.WriteCapacityUnits, src.WriteCapacityUnits)
+	return dst
+}
+
+func mergeIndexCapacity(dst, src map[string]types.Capacity) map[string]types.Capacity {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]types.Capacity, len(src))
+	}
+	for name, c := range src {
+		v := dst[name]
+		dst[name] = *mergeCapacity(&v, &c)
+	}
+	return dst
+}
+
+func addUnits(a, b *float64) *float64 {
+	if b == nil {
+		return a
+	}
+	return aws.Float64(aws.ToFloat64(a) + *b)
+}
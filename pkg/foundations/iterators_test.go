@@ -0,0 +1,125 @@
+package foundations
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+type Event struct {
+	ID  string `dynamodbav:"id"`
+	Seq int    `dynamodbav:"seq"`
+}
+
+func setupEvents(t *testing.T, n int) (context.Context, *dynamodbfake.Client) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String("events"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("seq"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("seq"), KeyType: types.KeyTypeRange},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := Put(ctx, cli, PutItem(ctx, "events", Event{ID: "e", Seq: i})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ctx, cli
+}
+
+func TestQueryIter(t *testing.T) {
+	ctx, cli := setupEvents(t, 10)
+	condition := func() (string, string, expression.Expression, error) {
+		expr, err := expression.NewBuilder().WithKeyCondition(expression.Key("id").Equal(expression.Value("e"))).Build()
+		return "events", "", expr, err
+	}
+	stats := &PageStats{}
+	seq := 0
+	for v, err := range QueryIter[Event](ctx, cli, condition, stats, options.Limit(3), options.ReturnConsumedCapacity(types.ReturnConsumedCapacityTotal)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Seq != seq {
+			t.Fatalf("expected %d, got %d", seq, v.Seq)
+		}
+		seq++
+	}
+	if seq != 10 || stats.Pages != 4 || stats.Count != 10 || stats.LastEvaluatedKey != nil {
+		t.Fatalf("unexpected stats: %d %+v", seq, stats)
+	}
+	if aws.ToFloat64(stats.ConsumedCapacity.CapacityUnits) != 2 {
+		t.Fatalf("unexpected capacity: %v", aws.ToFloat64(stats.ConsumedCapacity.CapacityUnits))
+	}
+
+	stats = &PageStats{}
+	for v, err := range ScanIter[Event](ctx, cli, func() (string, expression.Expression, error) {
+		return "events", expression.Expression{}, nil
+	}, stats, options.Limit(3)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Seq == 4 {
+			break
+		}
+	}
+	if stats.Pages != 2 || stats.LastEvaluatedKey == nil {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestQueryAll(t *testing.T) {
+	ctx, cli := setupEvents(t, 5)
+	var pages []string
+	out, err := QueryAll(ctx, cli, func() (string, string, expression.Expression, error) {
+		expr, err := expression.NewBuilder().WithKeyCondition(expression.Key("id").Equal(expression.Value("e"))).Build()
+		return "events", "", expr, err
+	}, func(tableName string, value Records) error {
+		pages = append(pages, fmt.Sprint(len(value)))
+		return nil
+	}, options.Limit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Count != 5 || len(pages) != 3 {
+		t.Fatalf("unexpected output: %d %v", out.Count, pages)
+	}
+}
+
+func TestQueryAllWithEmptyLastPage(t *testing.T) {
+	ctx, cli := setupEvents(t, 4)
+	db := NewDB(cli, ErrorWithEmptyList(true))
+	condition := func(id string) QueryConditionFunc {
+		return func() (string, string, expression.Expression, error) {
+			expr, err := expression.NewBuilder().WithKeyCondition(expression.Key("id").Equal(expression.Value(id))).Build()
+			return "events", "", expr, err
+		}
+	}
+	fetch := func(tableName string, value Records) error { return nil }
+	// 2件ずつの2ページの後に空のページが返る
+	out, err := db.QueryAll(ctx, condition("e"), fetch, options.Limit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Count != 4 || len(out.Items) != 0 { // 全てのページのアイテムは保持しない
+		t.Fatalf("unexpected output: %d %d", out.Count, len(out.Items))
+	}
+	if _, err = db.QueryAll(ctx, condition("none"), fetch, options.Limit(2)); !IsItemNotFound(err) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package foundations
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownKeySchema is returned when the key schema of a table is not registered.
+var ErrUnknownKeySchema = errors.New("unknown key schema")
+
+// KeySchema is the names of the hash key and the range key of a table.
+type KeySchema struct {
+	Hash  string
+	Range string
+}
+
+func (s KeySchema) Names() []string {
+	if s.Range != "" {
+		return []string{s.Hash, s.Range}
+	}
+	return []string{s.Hash}
+}
+
+// Key Returns the key attributes of item.
+func (s KeySchema) Key(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	names := s.Names()
+	key := make(map[string]types.AttributeValue, len(names))
+	for _, name := range names {
+		v, ok := item[name]
+		if !ok {
+			return nil, fmt.Errorf("key attribute %s is missing", name)
+		}
+		key[name] = v
+	}
+	return key, nil
+}
+
+// KeySchemaOf Returns the key schema of the `dynamodbkey` tags of T.
+func KeySchemaOf[T any]() (KeySchema, error) {
+	t := reflect.TypeFor[T]()
+	schema, err := schemaOf(t)
+	if err != nil {
+		return KeySchema{}, err
+	}
+	if schema.table.hash == nil {
+		return KeySchema{}, fmt.Errorf("%s has no %s:\"hash\" field", t, KeyTag)
+	}
+	ks := KeySchema{Hash: schema.table.hash.name}
+	if schema.table.rng != nil {
+		ks.Range = schema.table.rng.name
+	}
+	return ks, nil
+}
+
+// KeySchemaFrom Returns the key schema of the elements of CreateTable or DescribeTable.
+func KeySchemaFrom(elements []types.KeySchemaElement) KeySchema {
+	var ks KeySchema
+	for _, e := range elements {
+		switch e.KeyType {
+		case types.KeyTypeHash:
+			ks.Hash = aws.ToString(e.AttributeName)
+		case types.KeyTypeRange:
+			ks.Range = aws.ToString(e.AttributeName)
+		}
+	}
+	return ks
+}
+
+type DescribeTableClient interface {
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+}
+
+// KeyRegistry holds the key schemas of the tables, so that the keys can be derived from items.
+// Table names are the names the requests are built with. It is safe for concurrent use.
+type KeyRegistry struct {
+	mu     sync.RWMutex
+	tables map[string]KeySchema
+}
+
+func NewKeyRegistry() *KeyRegistry {
+	return &KeyRegistry{tables: map[string]KeySchema{}}
+}
+
+// DefaultKeyRegistry is used by batches and transactions to derive the keys of entities,
+// unless another registry is given to their options.
+var DefaultKeyRegistry = NewKeyRegistry()
+
+// Keys Holds the key schemas of the tables of the DB in r in place of DefaultKeyRegistry.
+// Pass DB.KeyRegistry to batches.KeyRegistry and transactions.KeyRegistry to derive the keys with it.
+func Keys(r *KeyRegistry) DBOption {
+	return func(db *DB) {
+		db.keys = r
+	}
+}
+
+// KeyRegistry Returns the registry of the key schemas of the DB.
+func (db *DB) KeyRegistry() *KeyRegistry {
+	return db.keys
+}
+
+func (r *KeyRegistry) Register(table string, schema KeySchema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tables[table] = schema
+}
+
+// Unregister Removes the key schema of table.
+func (r *KeyRegistry) Unregister(table string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tables, table)
+}
+
+// Describe Registers the key schemas of tables with DescribeTable.
+func (r *KeyRegistry) Describe(ctx context.Context, cli DescribeTableClient, tables ...string) error {
+	for _, table := range tables {
+		schema, err := DescribeKeySchema(ctx, cli, table)
+		if err != nil {
+			return err
+		}
+		r.Register(table, schema)
+	}
+	return nil
+}
+
+// DescribeKeySchema Returns the key schema of table with DescribeTable without registering it.
+func DescribeKeySchema(ctx context.Context, cli DescribeTableClient, table string) (KeySchema, error) {
+	out, err := cli.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return KeySchema{}, errors.WithStack(Classify(table, err))
+	}
+	return KeySchemaFrom(out.Table.KeySchema), nil
+}
+
+func (r *KeyRegistry) Lookup(table string) (KeySchema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.tables[table]
+	return s, ok
+}
+
+// Key Returns the key attributes of item. It returns ErrUnknownKeySchema if table is not registered.
+func (r *KeyRegistry) Key(table string, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	s, ok := r.Lookup(table)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeySchema, table)
+	}
+	key, err := s.Key(item)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", table, err)
+	}
+	return key, nil
+}
+
+// KeyOrItem Returns the key attributes of item, or item as it is if table is not registered.
+func (r *KeyRegistry) KeyOrItem(table string, item map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	if _, ok := r.Lookup(table); !ok {
+		return item, nil
+	}
+	return r.Key(table, item)
+}
+
+// RegisterKeys Registers the key schema of the `dynamodbkey` tags of T for table.
+func RegisterKeys[T any](r *KeyRegistry, table string) error {
+	s, err := KeySchemaOf[T]()
+	if err != nil {
+		return err
+	}
+	r.Register(table, s)
+	return nil
+}
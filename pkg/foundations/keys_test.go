@@ -0,0 +1,72 @@
+package foundations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+)
+
+func TestKeyRegistry(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String("orders"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("line"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("line"), KeyType: types.KeyTypeRange},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	item := map[string]types.AttributeValue{
+		"id":     &types.AttributeValueMemberS{Value: "o1"},
+		"line":   &types.AttributeValueMemberN{Value: "1"},
+		"status": &types.AttributeValueMemberS{Value: "open"},
+	}
+
+	r := NewKeyRegistry()
+	if _, err := r.Key("orders", item); !errors.Is(err, ErrUnknownKeySchema) {
+		t.Fatalf("expected ErrUnknownKeySchema, got %v", err)
+	}
+	if v, err := r.KeyOrItem("orders", item); err != nil || len(v) != 3 {
+		t.Fatalf("expected the item as it is, got %v %v", v, err)
+	}
+	if err := r.Describe(ctx, cli, "orders"); err != nil {
+		t.Fatal(err)
+	}
+	key, err := r.Key("orders", item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 2 || key["id"] == nil || key["line"] == nil {
+		t.Fatalf("unexpected key: %v", key)
+	}
+	if _, err = r.Key("orders", map[string]types.AttributeValue{"id": item["id"]}); err == nil {
+		t.Fatal("expected an error for the missing range key")
+	}
+
+	s, err := KeySchemaOf[Order]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if described, _ := r.Lookup("orders"); s != described {
+		t.Fatalf("expected %v, got %v", described, s)
+	}
+	if err = RegisterKeys[Audit](r, "audits"); err == nil {
+		t.Fatal("expected an error for the entity without a hash key")
+	}
+	r.Unregister("orders")
+	if _, ok := r.Lookup("orders"); ok {
+		t.Fatal("expected the key schema to be removed")
+	}
+}
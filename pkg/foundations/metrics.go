@@ -0,0 +1,250 @@
+package foundations
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/goccha/dynamodb-verse/pkg/capacity"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/goccha/dynamodb-verse"
+
+const (
+	attrTable     = attribute.Key("dynamodb.table")
+	attrOperation = attribute.Key("dynamodb.operation")
+	attrError     = attribute.Key("error.type")
+	attrReason    = attribute.Key("dynamodb.cancellation_reason")
+)
+
+type metrics struct {
+	duration      metric.Float64Histogram
+	throttles     metric.Int64Counter
+	conditions    metric.Int64Counter
+	cancellations metric.Int64Counter
+	unprocessed   metric.Int64Counter
+	readUnits     metric.Float64Counter
+	writeUnits    metric.Float64Counter
+}
+
+func newMetrics(mp metric.MeterProvider) (m *metrics, err error) {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(meterName)
+	m = &metrics{}
+	if m.duration, err = meter.Float64Histogram("dynamodb.operation.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of DynamoDB requests")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if m.throttles, err = meter.Int64Counter("dynamodb.throttles",
+		metric.WithDescription("Number of throttled requests")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if m.conditions, err = meter.Int64Counter("dynamodb.condition_check_failures",
+		metric.WithDescription("Number of requests whose condition was not satisfied")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if m.cancellations, err = meter.Int64Counter("dynamodb.transaction.cancellations",
+		metric.WithDescription("Number of canceled transactions")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if m.unprocessed, err = meter.Int64Counter("dynamodb.batch.unprocessed",
+		metric.WithDescription("Number of unprocessed items and keys of batch requests to be retried")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if m.readUnits, err = meter.Float64Counter("dynamodb.consumed.read_capacity_units",
+		metric.WithUnit("{RCU}"), metric.WithDescription("Consumed read capacity units")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if m.writeUnits, err = meter.Float64Counter("dynamodb.consumed.write_capacity_units",
+		metric.WithUnit("{WCU}"), metric.WithDescription("Consumed write capacity units")); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m, nil
+}
+
+func (m *metrics) record(ctx context.Context, operation string, input, output any, err error, duration time.Duration) {
+	table := attrTable.String(strings.Join(tablesOf(input), ","))
+	op := attrOperation.String(operation)
+	attrs := []attribute.KeyValue{table, op}
+	if err != nil {
+		kind, _ := classify(err)
+		switch kind {
+		case ErrThrottled:
+			m.throttles.Add(ctx, 1, metric.WithAttributes(table, op))
+		case ErrConditionFailed:
+			m.conditions.Add(ctx, 1, metric.WithAttributes(table, op))
+		}
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			m.cancellations.Add(ctx, 1, metric.WithAttributes(table, attrReason.String(cancellationReason(canceled))))
+		}
+		attrs = append(attrs, attrError.String(errorType(kind, err)))
+	}
+	m.duration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+	if err != nil || output == nil {
+		return
+	}
+	switch out := output.(type) {
+	case *dynamodb.BatchWriteItemOutput:
+		for name, items := range out.UnprocessedItems {
+			m.unprocessed.Add(ctx, int64(len(items)), metric.WithAttributes(attrTable.String(name), op))
+		}
+	case *dynamodb.BatchGetItemOutput:
+		for name, keys := range out.UnprocessedKeys {
+			m.unprocessed.Add(ctx, int64(len(keys.Keys)), metric.WithAttributes(attrTable.String(name), op))
+		}
+	}
+	consumed, isRead := capacity.Consumed(output)
+	for _, c := range consumed {
+		m.consume(ctx, operation, c, isRead)
+	}
+}
+
+func (m *metrics) consume(ctx context.Context, operation string, c types.ConsumedCapacity, isRead bool) {
+	attrs := metric.WithAttributes(attrTable.String(aws.ToString(c.TableName)), attrOperation.String(operation))
+	read, write := capacity.Split(c.CapacityUnits, c.ReadCapacityUnits, c.WriteCapacityUnits, isRead)
+	if read > 0 {
+		m.readUnits.Add(ctx, read, attrs)
+	}
+	if write > 0 {
+		m.writeUnits.Add(ctx, write, attrs)
+	}
+}
+
+func errorType(kind, err error) string {
+	switch kind {
+	case ErrItemNotFound:
+		return "ItemNotFound"
+	case ErrTableNotFound:
+		return "TableNotFound"
+	case ErrConditionFailed:
+		return "ConditionFailed"
+	case ErrThrottled:
+		return "Throttled"
+	case ErrValidation:
+		return "Validation"
+	}
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		return "TransactionCanceled"
+	}
+	return "Other"
+}
+
+func cancellationReason(err *types.TransactionCanceledException) string {
+	for _, reason := range err.CancellationReasons {
+		if code := aws.ToString(reason.Code); code != "" && code != "None" {
+			return code
+		}
+	}
+	return "Unknown"
+}
+
+func tablesOf(input any) []string {
+	switch in := input.(type) {
+	case *dynamodb.GetItemInput:
+		return []string{aws.ToString(in.TableName)}
+	case *dynamodb.PutItemInput:
+		return []string{aws.ToString(in.TableName)}
+	case *dynamodb.UpdateItemInput:
+		return []string{aws.ToString(in.TableName)}
+	case *dynamodb.DeleteItemInput:
+		return []string{aws.ToString(in.TableName)}
+	case *dynamodb.QueryInput:
+		return []string{aws.ToString(in.TableName)}
+	case *dynamodb.ScanInput:
+		return []string{aws.ToString(in.TableName)}
+	case *dynamodb.BatchWriteItemInput:
+		return sortedKeys(in.RequestItems)
+	case *dynamodb.BatchGetItemInput:
+		return sortedKeys(in.RequestItems)
+	case *dynamodb.TransactWriteItemsInput:
+		names := map[string]struct{}{}
+		for _, item := range in.TransactItems {
+			switch {
+			case item.ConditionCheck != nil:
+				names[aws.ToString(item.ConditionCheck.TableName)] = struct{}{}
+			case item.Put != nil:
+				names[aws.ToString(item.Put.TableName)] = struct{}{}
+			case item.Update != nil:
+				names[aws.ToString(item.Update.TableName)] = struct{}{}
+			case item.Delete != nil:
+				names[aws.ToString(item.Delete.TableName)] = struct{}{}
+			}
+		}
+		return sortedKeys(names)
+	case *dynamodb.TransactGetItemsInput:
+		names := map[string]struct{}{}
+		for _, item := range in.TransactItems {
+			if item.Get != nil {
+				names[aws.ToString(item.Get.TableName)] = struct{}{}
+			}
+		}
+		return sortedKeys(names)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MetricsInterceptor Returns an Interceptor that records the metrics of the requests of DB.Client.
+// The global MeterProvider is used if mp is nil.
+func MetricsInterceptor(mp metric.MeterProvider) (Interceptor, error) {
+	m, err := newMetrics(mp)
+	if err != nil {
+		return nil, err
+	}
+	return InterceptorFuncs{After: m.record}, nil
+}
+
+type metricsInputKey struct{}
+
+// AppendMetricsMiddlewares Records the metrics of the DynamoDB requests of the clients made from the options.
+// Every attempt of the retryer of the SDK is recorded as a request. The global MeterProvider is used if mp is nil.
+func AppendMetricsMiddlewares(apiOptions *[]func(*middleware.Stack) error, mp metric.MeterProvider) error {
+	m, err := newMetrics(mp)
+	if err != nil {
+		return err
+	}
+	*apiOptions = append(*apiOptions, func(stack *middleware.Stack) error {
+		// Finalizeでは入力が参照できないので、Initializeで保持しておく
+		if err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("DynamoDBVerseMetricsInput", func(
+			ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			return next.HandleInitialize(middleware.WithStackValue(ctx, metricsInputKey{}, in.Parameters), in)
+		}), middleware.After); err != nil {
+			return err
+		}
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("DynamoDBVerseMetrics", func(
+			ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			if awsmiddleware.GetServiceID(ctx) != dynamodb.ServiceID {
+				return next.HandleFinalize(ctx, in)
+			}
+			start := time.Now()
+			out, metadata, err := next.HandleFinalize(ctx, in)
+			m.record(ctx, awsmiddleware.GetOperationName(ctx), middleware.GetStackValue(ctx, metricsInputKey{}), out.Result, err, time.Since(start))
+			return out, metadata, err
+		}), "Retry", middleware.After)
+	})
+	return nil
+}
@@ -0,0 +1,157 @@
+package foundations
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsretry "github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx, cli := setupAccounts(t)
+	reader := sdkmetric.NewManualReader()
+	interceptor, err := MetricsInterceptor(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewDB(cli, Interceptors(interceptor), DefaultOptions(options.ReturnConsumedCapacity(types.ReturnConsumedCapacityTotal)))
+	repo, err := NewRepository[Account]("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Put(ctx, db.Client(), &Account{ID: "a1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Get(ctx, db.Client(), repo.KeyOf("a1")); err != nil {
+		t.Fatal(err)
+	}
+	// 古いバージョンでの更新は条件チェックに失敗する
+	if err = repo.Put(ctx, db.Client(), &Account{ID: "a1"}); err == nil {
+		t.Fatal("expected version conflict")
+	}
+	_, err = db.Client().TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{{ConditionCheck: &types.ConditionCheck{
+			TableName:           aws.String("accounts"),
+			Key:                 map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}},
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		}}},
+	})
+	if err == nil {
+		t.Fatal("expected transaction cancellation")
+	}
+
+	values := collectMetrics(t, reader)
+	want := map[string]float64{
+		"dynamodb.operation.duration":           4,
+		"dynamodb.condition_check_failures":     2,
+		"dynamodb.transaction.cancellations":    1,
+		"dynamodb.consumed.read_capacity_units": 0.5,
+	}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("%s = %v, want %v", name, values[name], v)
+		}
+	}
+	if values["dynamodb.consumed.write_capacity_units"] <= 0 {
+		t.Errorf("expected write capacity units, got %v", values)
+	}
+}
+
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]float64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[float64]:
+				for _, p := range data.DataPoints {
+					values[m.Name] += float64(p.Count)
+				}
+			case metricdata.Sum[int64]:
+				for _, p := range data.DataPoints {
+					values[m.Name] += float64(p.Value)
+				}
+			case metricdata.Sum[float64]:
+				for _, p := range data.DataPoints {
+					values[m.Name] += p.Value
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestMetricsMiddlewares(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if n == 1 { // 1回目はスロットリングされてSDKがリトライする
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ThrottlingException","message":"throttled"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Item":{"id":{"S":"a1"}},"ConsumedCapacity":{"TableName":"accounts","CapacityUnits":0.5}}`))
+	}))
+	defer server.Close()
+
+	reader := sdkmetric.NewManualReader()
+	mp := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(mp) })
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("ap-northeast-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("key", "secret", "")),
+		config.WithRetryer(func() aws.Retryer {
+			return awsretry.NewStandard(func(o *awsretry.StandardOptions) {
+				o.Backoff = awsretry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+			})
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := Setup(ctx, AwsConfig(&cfg), Endpoint(server.URL), EnabledMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cli.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("accounts"),
+		Key:       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	values := collectMetrics(t, reader)
+	// リトライも1回のリクエストとして記録される
+	want := map[string]float64{
+		"dynamodb.operation.duration":           2,
+		"dynamodb.throttles":                    1,
+		"dynamodb.consumed.read_capacity_units": 0.5,
+	}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("%s = %v, want %v", name, values[name], v)
+		}
+	}
+}
@@ -62,6 +62,12 @@ func ReturnConsumedCapacity(capacity types.ReturnConsumedCapacity) Option {
 			in.ReturnConsumedCapacity = capacity
 		case *dynamodb.BatchWriteItemInput:
 			in.ReturnConsumedCapacity = capacity
+		case *dynamodb.BatchGetItemInput:
+			in.ReturnConsumedCapacity = capacity
+		case *dynamodb.TransactWriteItemsInput:
+			in.ReturnConsumedCapacity = capacity
+		case *dynamodb.TransactGetItemsInput:
+			in.ReturnConsumedCapacity = capacity
 		}
 		return input
 	}
@@ -105,10 +111,13 @@ func AttributeUpdates(updates map[string]types.AttributeValueUpdate) Option {
 	}
 }
 
-// Limit dynamodb.QueryInput.Limit
+// Limit dynamodb.QueryInput.Limit, dynamodb.ScanInput.Limit
 func Limit(limit int32) Option {
 	return func(input any) any {
-		if in, ok := input.(*dynamodb.QueryInput); ok {
+		switch in := input.(type) {
+		case *dynamodb.QueryInput:
+			in.Limit = &limit
+		case *dynamodb.ScanInput:
 			in.Limit = &limit
 		}
 		return input
@@ -125,25 +134,32 @@ func ScanIndexForward(asc bool) Option {
 	}
 }
 
+// ReturnValuesOnConditionCheckFailure dynamodb.PutItemInput, dynamodb.UpdateItemInput, dynamodb.DeleteItemInput, types.Put, types.Update, types.Delete
 func ReturnValuesOnConditionCheckFailure(value types.ReturnValuesOnConditionCheckFailure) Option {
 	return func(input any) any {
-		return func(input any) any {
-			switch in := input.(type) {
-			case *types.Put:
-				in.ReturnValuesOnConditionCheckFailure = value
-			case *types.Update:
-				in.ReturnValuesOnConditionCheckFailure = value
-			case *types.Delete:
-				in.ReturnValuesOnConditionCheckFailure = value
-			}
-			return input
+		switch in := input.(type) {
+		case *dynamodb.PutItemInput:
+			in.ReturnValuesOnConditionCheckFailure = value
+		case *dynamodb.UpdateItemInput:
+			in.ReturnValuesOnConditionCheckFailure = value
+		case *dynamodb.DeleteItemInput:
+			in.ReturnValuesOnConditionCheckFailure = value
+		case *types.Put:
+			in.ReturnValuesOnConditionCheckFailure = value
+		case *types.Update:
+			in.ReturnValuesOnConditionCheckFailure = value
+		case *types.Delete:
+			in.ReturnValuesOnConditionCheckFailure = value
 		}
+		return input
 	}
 }
 
 func ConsistentRead(consistentRead *bool) Option {
 	return func(input any) any {
 		switch in := input.(type) {
+		case *dynamodb.GetItemInput:
+			in.ConsistentRead = consistentRead
 		case *dynamodb.QueryInput:
 			in.ConsistentRead = consistentRead
 		case *dynamodb.ScanInput:
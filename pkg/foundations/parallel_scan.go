@@ -0,0 +1,196 @@
+package foundations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const DefaultScanSegments = 4
+
+type parallelScanConfig struct {
+	segments    int32
+	concurrency int
+	resume      map[int32]EvaluatedKey
+	checkpoint  func(segment int32, key EvaluatedKey) error
+	options     []options.Option
+}
+
+type ParallelScanOption func(c *parallelScanConfig)
+
+// Segments Sets TotalSegments of the scan.
+func Segments(n int32) ParallelScanOption {
+	return func(c *parallelScanConfig) {
+		c.segments = n
+	}
+}
+
+// Concurrency Limits the number of segments scanned at the same time. The default is the number of segments.
+func Concurrency(n int) ParallelScanOption {
+	return func(c *parallelScanConfig) {
+		c.concurrency = n
+	}
+}
+
+// ResumeFrom Scans only the segments in keys, each starting after its key.
+// A nil key starts the segment from the beginning. Pass ParallelScanResult.LastEvaluatedKeys to resume a failed scan.
+func ResumeFrom(keys map[int32]EvaluatedKey) ParallelScanOption {
+	return func(c *parallelScanConfig) {
+		c.resume = keys
+	}
+}
+
+// Checkpoint Calls f after every page has been handled, with the key to resume the segment from.
+// The key is nil when the segment has finished. Calls are serialized.
+func Checkpoint(f func(segment int32, key EvaluatedKey) error) ParallelScanOption {
+	return func(c *parallelScanConfig) {
+		c.checkpoint = f
+	}
+}
+
+// ScanOptions Applies options to the ScanInput of every segment.
+func ScanOptions(opt ...options.Option) ParallelScanOption {
+	return func(c *parallelScanConfig) {
+		c.options = append(c.options, opt...)
+	}
+}
+
+type ParallelScanResult struct {
+	Count            int64
+	ScannedCount     int64
+	ConsumedCapacity *types.ConsumedCapacity
+	// LastEvaluatedKeys has an entry for every segment that did not finish.
+	// A nil key means that the segment has not fetched any page.
+	LastEvaluatedKeys map[int32]EvaluatedKey
+}
+
+// ParallelScan Scans the segments of the table concurrently and calls handler for every item.
+// The first error cancels the other segments. The result is returned with the error, so that the scan can be resumed with ResumeFrom.
+func ParallelScan[T any](ctx context.Context, cli ScanClient, condition ScanFilterFunc, handler func(ctx context.Context, segment int32, item T) error, opt ...ParallelScanOption) (*ParallelScanResult, error) {
+	return ParallelScanPages(ctx, cli, condition, func(ctx context.Context, segment int32, items Records) error {
+		for _, item := range items {
+			var v T
+			if err := Record(item).Unmarshal(ctx, &v); err != nil {
+				return err
+			}
+			if err := handler(ctx, segment, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, opt...)
+}
+
+// ParallelScanPages Scans like ParallelScan, and calls handler with the items of every page as they are.
+func ParallelScanPages(ctx context.Context, cli ScanClient, condition ScanFilterFunc, handler func(ctx context.Context, segment int32, items Records) error, opt ...ParallelScanOption) (*ParallelScanResult, error) {
+	conf := &parallelScanConfig{segments: DefaultScanSegments}
+	for _, o := range opt {
+		o(conf)
+	}
+	if conf.segments < 1 {
+		return nil, fmt.Errorf("invalid number of segments: %d", conf.segments)
+	}
+	starts := make(map[int32]EvaluatedKey, conf.segments)
+	if conf.resume != nil {
+		for segment, key := range conf.resume {
+			if segment < 0 || segment >= conf.segments {
+				return nil, fmt.Errorf("invalid segment: %d", segment)
+			}
+			starts[segment] = key
+		}
+	} else {
+		for segment := int32(0); segment < conf.segments; segment++ {
+			starts[segment] = nil
+		}
+	}
+	res := &ParallelScanResult{LastEvaluatedKeys: make(map[int32]EvaluatedKey, len(starts))}
+	segments := make([]int32, 0, len(starts))
+	for segment, key := range starts {
+		res.LastEvaluatedKeys[segment] = key
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	concurrency := conf.concurrency
+	if concurrency <= 0 {
+		concurrency = len(segments)
+	}
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for _, segment := range segments {
+		start := starts[segment]
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			return scanSegment(gctx, cli, condition, handler, conf, segment, start, func(count, scanned int32, capacity *types.ConsumedCapacity, key EvaluatedKey) error {
+				mu.Lock()
+				defer mu.Unlock()
+				res.Count += int64(count)
+				res.ScannedCount += int64(scanned)
+				res.ConsumedCapacity = mergeConsumedCapacity(res.ConsumedCapacity, capacity)
+				if key == nil {
+					delete(res.LastEvaluatedKeys, segment)
+				} else {
+					res.LastEvaluatedKeys[segment] = key
+				}
+				if conf.checkpoint != nil {
+					return conf.checkpoint(segment, key)
+				}
+				return nil
+			})
+		})
+	}
+	err := g.Wait()
+	return res, err
+}
+
+func scanSegment(ctx context.Context, cli ScanClient, condition ScanFilterFunc, handler func(ctx context.Context, segment int32, items Records) error,
+	conf *parallelScanConfig, segment int32, start EvaluatedKey, done func(count, scanned int32, capacity *types.ConsumedCapacity, key EvaluatedKey) error) error {
+	total := conf.segments
+	opts := make([]options.Option, 0, len(conf.options)+3)
+	opts = append(opts, conf.options...)
+	opts = append(opts, options.Segment(&segment), options.TotalSegments(&total), options.ExclusiveStartKey(start))
+	table, input, err := scanInput(condition, opts...)
+	if err != nil {
+		return err
+	}
+	for {
+		out, err := retry(ctx, RetryPolicyFrom(ctx), input, func(ctx context.Context) (*dynamodb.ScanOutput, error) {
+			return cli.Scan(ctx, input)
+		})
+		if err != nil {
+			return errors.WithStack(Classify(table, err))
+		}
+		if err = handler(ctx, segment, out.Items); err != nil {
+			return err
+		}
+		if err = done(out.Count, out.ScannedCount, out.ConsumedCapacity, out.LastEvaluatedKey); err != nil {
+			return err
+		}
+		if out.LastEvaluatedKey == nil {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// ParallelScanChan Sends the items of a ParallelScan to out, and closes out when the scan finishes.
+func ParallelScanChan[T any](ctx context.Context, cli ScanClient, condition ScanFilterFunc, out chan<- T, opt ...ParallelScanOption) (*ParallelScanResult, error) {
+	defer close(out)
+	return ParallelScan(ctx, cli, condition, func(ctx context.Context, segment int32, item T) error {
+		select {
+		case out <- item:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, opt...)
+}
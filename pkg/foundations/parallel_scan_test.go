@@ -0,0 +1,112 @@
+package foundations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+)
+
+func TestParallelScan(t *testing.T) {
+	ctx, cli := setupEvents(t, 0)
+	for i := 0; i < 50; i++ {
+		if _, err := Put(ctx, cli, PutItem(ctx, "events", Event{ID: fmt.Sprintf("e%02d", i), Seq: i})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	condition := func() (string, expression.Expression, error) {
+		return "events", expression.Expression{}, nil
+	}
+	var count atomic.Int64
+	res, err := ParallelScan(ctx, cli, condition, func(ctx context.Context, segment int32, item Event) error {
+		count.Add(1)
+		return nil
+	}, Segments(5), Concurrency(2), ScanOptions(options.Limit(4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Load() != 50 || res.Count != 50 || len(res.LastEvaluatedKeys) != 0 {
+		t.Fatalf("unexpected result: %d %+v", count.Load(), res)
+	}
+
+	failure := errors.New("failure")
+	count.Store(0)
+	res, err = ParallelScan(ctx, cli, condition, func(ctx context.Context, segment int32, item Event) error {
+		if item.Seq == 10 {
+			return failure
+		}
+		return nil
+	}, Segments(5), Concurrency(1), ScanOptions(options.Limit(4)))
+	if !errors.Is(err, failure) || len(res.LastEvaluatedKeys) == 0 {
+		t.Fatalf("unexpected result: %v %+v", err, res)
+	}
+
+	var checkpoints atomic.Int64
+	items := make(chan Event)
+	go func() {
+		for range items {
+			count.Add(1)
+		}
+	}()
+	before := res.Count
+	res, err = ParallelScanChan(ctx, cli, condition, items, Segments(5), ResumeFrom(res.LastEvaluatedKeys),
+		Checkpoint(func(segment int32, key EvaluatedKey) error {
+			checkpoints.Add(1)
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before+res.Count != 50 || checkpoints.Load() == 0 {
+		t.Fatalf("unexpected result: %d %+v", before, res)
+	}
+}
+
+func TestParallelScanPagesRetry(t *testing.T) {
+	ctx := context.Background()
+	var throttles atomic.Int64
+	throttles.Store(3)
+	cli := dynamodbfake.New(dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		if operation == "Scan" && throttles.Add(-1) >= 0 {
+			return &types.ProvisionedThroughputExceededException{Message: aws.String("throttled")}
+		}
+		return nil
+	}))
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("events"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := Put(ctx, cli, PutItem(ctx, "events", map[string]any{"id": fmt.Sprintf("e%02d", i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// スロットリングされたページはコンテキストのポリシーで再試行する
+	policy := &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+	var count atomic.Int64
+	res, err := ParallelScanPages(WithRetryPolicy(ctx, policy), cli, func() (string, expression.Expression, error) {
+		return "events", expression.Expression{}, nil
+	}, func(ctx context.Context, segment int32, items Records) error {
+		count.Add(int64(len(items)))
+		return nil
+	}, Segments(3), ScanOptions(options.Limit(4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Load() != 20 || res.Count != 20 || throttles.Load() >= 0 {
+		t.Fatalf("unexpected result: %d %+v", count.Load(), res)
+	}
+}
@@ -0,0 +1,359 @@
+package foundations
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyTag marks the key attributes of the table: `dynamodbkey:"hash"` or `dynamodbkey:"range"`.
+	KeyTag = "dynamodbkey"
+	// IndexTag marks the key attributes of secondary indexes: `dynamodbindex:"status-index:hash,owner-index:range"`.
+	// The role defaults to hash.
+	IndexTag = "dynamodbindex"
+	// VersionTag marks the version attribute for optimistic locking: `dynamodbversion:"true"`.
+	VersionTag = "dynamodbversion"
+)
+
+type keyAttribute struct {
+	name  string
+	index []int
+}
+
+type keySchema struct {
+	hash *keyAttribute
+	rng  *keyAttribute
+}
+
+func (ks *keySchema) attributes() []*keyAttribute {
+	if ks.rng != nil {
+		return []*keyAttribute{ks.hash, ks.rng}
+	}
+	return []*keyAttribute{ks.hash}
+}
+
+type entitySchema struct {
+	table   keySchema
+	indexes map[string]*keySchema
+	version *keyAttribute
+}
+
+var schemas sync.Map // reflect.Type -> *entitySchema
+
+func schemaOf(t reflect.Type) (*entitySchema, error) {
+	if v, ok := schemas.Load(t); ok {
+		return v.(*entitySchema), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	s := &entitySchema{indexes: map[string]*keySchema{}}
+	if err := s.parse(t, nil); err != nil {
+		return nil, err
+	}
+	for name, ks := range s.indexes {
+		if ks.hash == nil {
+			return nil, fmt.Errorf("index %s of %s has no hash key", name, t)
+		}
+	}
+	v, _ := schemas.LoadOrStore(t, s)
+	return v.(*entitySchema), nil
+}
+
+func (s *entitySchema) parse(t reflect.Type, parent []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		tag := f.Tag.Get("dynamodbav")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			// 埋め込み構造体のフィールドも対象にする
+			if err := s.parse(f.Type, index); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		attr := &keyAttribute{name: name, index: index}
+		if role, ok := f.Tag.Lookup(KeyTag); ok {
+			if err := s.table.set(role, attr); err != nil {
+				return fmt.Errorf("%s.%s: %w", t, f.Name, err)
+			}
+		}
+		if v, ok := f.Tag.Lookup(VersionTag); ok && v == "true" {
+			if s.version != nil {
+				return fmt.Errorf("%s.%s: duplicate version attribute", t, f.Name)
+			}
+			switch f.Type.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return fmt.Errorf("%s.%s: version attribute must be an integer", t, f.Name)
+			}
+			s.version = attr
+		}
+		if v, ok := f.Tag.Lookup(IndexTag); ok {
+			for _, def := range strings.Split(v, ",") {
+				indexName, role, _ := strings.Cut(strings.TrimSpace(def), ":")
+				if indexName == "" {
+					return fmt.Errorf("%s.%s: empty index name", t, f.Name)
+				}
+				ks, ok := s.indexes[indexName]
+				if !ok {
+					ks = &keySchema{}
+					s.indexes[indexName] = ks
+				}
+				if err := ks.set(role, attr); err != nil {
+					return fmt.Errorf("%s.%s: %w", t, f.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (ks *keySchema) set(role string, attr *keyAttribute) error {
+	switch role {
+	case "hash", "":
+		if ks.hash != nil {
+			return fmt.Errorf("duplicate hash key: %s", attr.name)
+		}
+		ks.hash = attr
+	case "range":
+		if ks.rng != nil {
+			return fmt.Errorf("duplicate range key: %s", attr.name)
+		}
+		ks.rng = attr
+	default:
+		return fmt.Errorf("unknown key type: %s", role)
+	}
+	return nil
+}
+
+// Repository reads and writes T in a table. The keys of the table and the indexes are read from the struct tags of T.
+//
+//	type Order struct {
+//		ID     string `dynamodbav:"id" dynamodbkey:"hash"`
+//		Status string `dynamodbav:"status" dynamodbindex:"status-index:hash"`
+//	}
+type Repository[T any] struct {
+	table  string
+	schema *entitySchema
+}
+
+func NewRepository[T any](table string) (*Repository[T], error) {
+	t := reflect.TypeFor[T]()
+	schema, err := schemaOf(t)
+	if err != nil {
+		return nil, err
+	}
+	if schema.table.hash == nil {
+		return nil, fmt.Errorf("%s has no %s:\"hash\" field", t, KeyTag)
+	}
+	return &Repository[T]{table: table, schema: schema}, nil
+}
+
+func (r *Repository[T]) TableName() string {
+	return r.table
+}
+
+// Key Returns the key of v.
+func (r *Repository[T]) Key(v *T) GetKeyFunc {
+	return func() (table string, keys map[string]types.AttributeValue, attrs []string, err error) {
+		rv := reflect.ValueOf(v).Elem()
+		keys = make(map[string]types.AttributeValue, 2)
+		for _, attr := range r.schema.table.attributes() {
+			var fv reflect.Value
+			if fv, err = rv.FieldByIndexErr(attr.index); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+			if keys[attr.name], err = attributevalue.Marshal(fv.Interface()); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+		}
+		table = r.table
+		return
+	}
+}
+
+// KeyOf Returns the key of the hash key value and the range key value.
+func (r *Repository[T]) KeyOf(values ...any) GetKeyFunc {
+	return func() (table string, keys map[string]types.AttributeValue, attrs []string, err error) {
+		schema := r.schema.table.attributes()
+		if len(values) != len(schema) {
+			err = fmt.Errorf("%s requires %d key values, got %d", r.table, len(schema), len(values))
+			return
+		}
+		keys = make(map[string]types.AttributeValue, len(schema))
+		for i, attr := range schema {
+			if keys[attr.name], err = attributevalue.Marshal(values[i]); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+		}
+		table = r.table
+		return
+	}
+}
+
+// KeyCondition Returns the condition of the hash key of the index. An empty index means the table.
+func (r *Repository[T]) KeyCondition(index string, value any) (expression.KeyConditionBuilder, error) {
+	ks := &r.schema.table
+	if index != "" {
+		var ok bool
+		if ks, ok = r.schema.indexes[index]; !ok {
+			return expression.KeyConditionBuilder{}, fmt.Errorf("unknown index: %s", index)
+		}
+	}
+	return expression.Key(ks.hash.name).Equal(expression.Value(value)), nil
+}
+
+// KeyNames Returns the names of the hash key and the range key of the table.
+func (r *Repository[T]) KeyNames() []string {
+	attrs := r.schema.table.attributes()
+	names := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		names = append(names, attr.name)
+	}
+	return names
+}
+
+// RangeKey Returns the name of the range key of the index, or an empty string if the index has no range key.
+func (r *Repository[T]) RangeKey(index string) string {
+	ks := &r.schema.table
+	if index != "" {
+		if ks = r.schema.indexes[index]; ks == nil {
+			return ""
+		}
+	}
+	if ks.rng == nil {
+		return ""
+	}
+	return ks.rng.name
+}
+
+func (r *Repository[T]) PutItem(ctx context.Context, v *T, f ...ExpressionFunc) VersionedWriteItemFunc {
+	return PutItem(ctx, r.table, v, f...)
+}
+
+// DeleteItem Returns a VersionedWriteItemFunc that deletes v. If T has a version attribute, the delete is conditioned on the version of v.
+func (r *Repository[T]) DeleteItem(v *T) VersionedWriteItemFunc {
+	return VersionedDeleteItem(r.Key(v), v)
+}
+
+// UpdateItem Returns a VersionedWriteItemFunc that updates v. If T has a version attribute, the update is conditioned on the version of v.
+func (r *Repository[T]) UpdateItem(ctx context.Context, v *T, fields ...UpdateField) VersionedWriteItemFunc {
+	return VersionedUpdateItem(ctx, r.Key(v), v, fields...)
+}
+
+// Get Returns the item of key. It fails with ErrItemNotFound if the item does not exist.
+func (r *Repository[T]) Get(ctx context.Context, cli GetClient, key GetKeyFunc, opt ...options.Option) (*T, error) {
+	var v T
+	if _, err := Get(ctx, cli, key, FetchItem(ctx, &v), opt...); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Put Puts v. If T has a version attribute, the version of v is incremented after the put succeeds.
+func (r *Repository[T]) Put(ctx context.Context, cli WriteClient, v *T, opt ...options.Option) error {
+	ver, err := versionOf(v)
+	if err != nil {
+		return err
+	}
+	if _, err = Put(ctx, cli, r.PutItem(ctx, v), opt...); err != nil {
+		return err
+	}
+	if ver != nil {
+		ver.increment()
+	}
+	return nil
+}
+
+// Update Updates the item of v and returns the updated item.
+func (r *Repository[T]) Update(ctx context.Context, cli WriteClient, v *T, fields []UpdateField, opt ...options.Option) (*T, error) {
+	opt = append(opt, options.ReturnValues(types.ReturnValueAllNew))
+	out, err := Update(ctx, cli, r.UpdateItem(ctx, v, fields...), opt...)
+	if err != nil {
+		return nil, err
+	}
+	var res T
+	if err = Record(out.Attributes).Unmarshal(ctx, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (r *Repository[T]) Delete(ctx context.Context, cli WriteClient, v *T, opt ...options.Option) error {
+	_, err := Delete(ctx, cli, r.DeleteItem(v), opt...)
+	return err
+}
+
+// Query Returns all items of the table matching key.
+func (r *Repository[T]) Query(ctx context.Context, cli QueryClient, key expression.KeyConditionBuilder, opt ...options.Option) ([]T, error) {
+	return r.QueryByIndex(ctx, cli, "", key, opt...)
+}
+
+// QueryByIndex Returns all items of the index matching key.
+func (r *Repository[T]) QueryByIndex(ctx context.Context, cli QueryClient, index string, key expression.KeyConditionBuilder, opt ...options.Option) ([]T, error) {
+	if index != "" {
+		if _, ok := r.schema.indexes[index]; !ok {
+			return nil, fmt.Errorf("unknown index: %s", index)
+		}
+	}
+	list := make([]T, 0)
+	_, err := QueryAll(ctx, cli, func() (string, string, expression.Expression, error) {
+		expr, err := expression.NewBuilder().WithKeyCondition(key).Build()
+		return r.table, index, expr, errors.WithStack(err)
+	}, r.fetchAll(ctx, &list), opt...)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Scan Returns all items of the table matching filter. An unset filter returns every item.
+func (r *Repository[T]) Scan(ctx context.Context, cli ScanClient, filter expression.ConditionBuilder, opt ...options.Option) ([]T, error) {
+	list := make([]T, 0)
+	_, err := ScanAll(ctx, cli, func() (string, expression.Expression, error) {
+		if !filter.IsSet() {
+			return r.table, expression.Expression{}, nil
+		}
+		expr, err := expression.NewBuilder().WithFilter(filter).Build()
+		return r.table, expr, errors.WithStack(err)
+	}, r.fetchAll(ctx, &list), opt...)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *Repository[T]) fetchAll(ctx context.Context, list *[]T) FetchItemsFunc {
+	return func(tableName string, values Records) error {
+		var page []T
+		if err := values.Unmarshal(ctx, &page); err != nil {
+			return err
+		}
+		*list = append(*list, page...)
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package foundations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+)
+
+type Audit struct {
+	UpdatedBy string `dynamodbav:"updated_by"`
+}
+
+type Order struct {
+	ID     string `dynamodbav:"id" dynamodbkey:"hash"`
+	Line   int    `dynamodbav:"line" dynamodbkey:"range"`
+	Status string `dynamodbav:"status" dynamodbindex:"status-index"`
+	Amount int    `dynamodbav:"amount"`
+	Audit
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String("orders"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("line"), AttributeType: types.ScalarAttributeTypeN},
+			{AttributeName: aws.String("status"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("line"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+			IndexName:  aws.String("status-index"),
+			KeySchema:  []types.KeySchemaElement{{AttributeName: aws.String("status"), KeyType: types.KeyTypeHash}},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}},
+		BillingMode: types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewRepository[Order]("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, status := range []string{"open", "open", "closed"} {
+		if err = repo.Put(ctx, cli, &Order{ID: "o1", Line: i, Status: status, Amount: 100, Audit: Audit{UpdatedBy: "u"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	order, err := repo.Get(ctx, cli, repo.KeyOf("o1", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != "open" || order.UpdatedBy != "u" {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+	if order, err = repo.Update(ctx, cli, order, []UpdateField{AddValue("amount", 50)}); err != nil {
+		t.Fatal(err)
+	} else if order.Amount != 150 {
+		t.Fatalf("expected 150, got %d", order.Amount)
+	}
+	key, err := repo.KeyCondition("", "o1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, err := repo.Query(ctx, cli, key.And(expression.Key(repo.RangeKey("")).GreaterThan(expression.Value(0))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(orders))
+	}
+	if key, err = repo.KeyCondition("status-index", "open"); err != nil {
+		t.Fatal(err)
+	}
+	if orders, err = repo.QueryByIndex(ctx, cli, "status-index", key); err != nil {
+		t.Fatal(err)
+	} else if len(orders) != 2 {
+		t.Fatalf("expected 2 open orders, got %d", len(orders))
+	}
+	if err = repo.Delete(ctx, cli, &Order{ID: "o1", Line: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Get(ctx, cli, repo.KeyOf("o1", 0)); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if orders, err = repo.Scan(ctx, cli, expression.Name("status").Equal(expression.Value("closed"))); err != nil {
+		t.Fatal(err)
+	} else if len(orders) != 1 {
+		t.Fatalf("expected 1 closed order, got %d", len(orders))
+	}
+	if orders, err = repo.Scan(ctx, cli, expression.ConditionBuilder{}); err != nil {
+		t.Fatal(err)
+	} else if len(orders) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(orders))
+	}
+	if _, _, _, err = repo.KeyOf("o1")(); err == nil {
+		t.Fatal("expected error for a missing range key")
+	}
+}
+
+func TestRepositorySchema(t *testing.T) {
+	type NoKey struct {
+		ID string `dynamodbav:"id"`
+	}
+	if _, err := NewRepository[NoKey]("t"); err == nil {
+		t.Fatal("expected error for a struct without hash key")
+	}
+	type DuplicateKey struct {
+		ID   string `dynamodbav:"id" dynamodbkey:"hash"`
+		Name string `dynamodbav:"name" dynamodbkey:"hash"`
+	}
+	if _, err := NewRepository[DuplicateKey]("t"); err == nil {
+		t.Fatal("expected error for duplicate hash keys")
+	}
+}
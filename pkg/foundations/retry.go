@@ -0,0 +1,266 @@
+package foundations
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/pkg/errors"
+)
+
+// RetryReason is the kind of the errors retried by a RetryPolicy.
+type RetryReason string
+
+const (
+	RetryThroughputExceeded   RetryReason = "ProvisionedThroughputExceeded"
+	RetryRequestLimitExceeded RetryReason = "RequestLimitExceeded"
+	RetryThrottling           RetryReason = "Throttling"
+	RetryTransactionConflict  RetryReason = "TransactionConflict"
+	RetryInternalServerError  RetryReason = "InternalServerError"
+)
+
+// RetryReasonOf Returns the reason to retry the request that failed with err.
+func RetryReasonOf(err error) (RetryReason, bool) {
+	if err == nil {
+		return "", false
+	}
+	var (
+		throughput   *types.ProvisionedThroughputExceededException
+		requestLimit *types.RequestLimitExceeded
+		conflict     *types.TransactionConflictException
+		inProgress   *types.TransactionInProgressException
+		canceled     *types.TransactionCanceledException
+		internal     *types.InternalServerError
+		response     *smithyhttp.ResponseError
+		api          smithy.APIError
+	)
+	switch {
+	case errors.As(err, &throughput):
+		return RetryThroughputExceeded, true
+	case errors.As(err, &requestLimit):
+		return RetryRequestLimitExceeded, true
+	case errors.As(err, &conflict), errors.As(err, &inProgress):
+		return RetryTransactionConflict, true
+	case errors.As(err, &canceled):
+		var reason RetryReason
+		for _, r := range canceled.CancellationReasons {
+			switch aws.ToString(r.Code) {
+			case "None", "":
+			case "TransactionConflict":
+				reason = RetryTransactionConflict
+			case "ThrottlingError", "ProvisionedThroughputExceeded":
+				if reason == "" {
+					reason = RetryThroughputExceeded
+				}
+			default:
+				// 条件や入力の誤りは再試行しても成功しない
+				return "", false
+			}
+		}
+		return reason, reason != ""
+	case errors.As(err, &internal):
+		return RetryInternalServerError, true
+	case errors.As(err, &api) && api.ErrorCode() == "ThrottlingException":
+		return RetryThrottling, true
+	case errors.As(err, &response) && response.HTTPStatusCode() >= http.StatusInternalServerError:
+		return RetryInternalServerError, true
+	}
+	return "", false
+}
+
+// RetryPolicy retries the requests that failed with the errors of Reasons.
+// The delays grow exponentially from BaseDelay up to MaxDelay with full jitter,
+// and a delay that exceeds the deadline of the context ends the retries.
+// Every attempt is retried again by the retryer of the SDK (3 attempts by default), so the attempts multiply.
+// Set RetryMaxAttempts of the aws.Config to 1 to leave the retries to the policy.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Reasons are the errors to retry. All reasons are retried if it is empty.
+	Reasons []RetryReason
+	// Budget limits the retries shared by the requests. It is unlimited if nil.
+	Budget *RetryBudget
+	// RetryAmbiguous retries the internal server errors of the requests that are not idempotent,
+	// UpdateItem, PutItem and DeleteItem with a condition, and TransactWriteItems without ClientRequestToken,
+	// which may have been applied before the error.
+	RetryAmbiguous bool
+}
+
+// DefaultRetryPolicy Returns a policy that makes 3 attempts starting with a 50ms delay.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+type retryingKey struct{}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy Returns a context whose requests are retried with p by foundations, batches and transactions.
+func WithRetryPolicy(ctx context.Context, p *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, p)
+}
+
+// RetryPolicyFrom Returns the policy of the context, or nil.
+func RetryPolicyFrom(ctx context.Context) *RetryPolicy {
+	p, _ := ctx.Value(retryPolicyKey{}).(*RetryPolicy)
+	return p
+}
+
+// Retries Retries the requests of DB.Client with p. The policy of the context takes precedence.
+func Retries(p *RetryPolicy) DBOption {
+	return func(db *DB) {
+		db.retry = p
+	}
+}
+
+// Do Calls f until it succeeds or the error is not retried.
+// f is called only once within f of another Do, so the nested policies do not multiply the attempts.
+func (p *RetryPolicy) Do(ctx context.Context, f func(ctx context.Context) error) error {
+	return p.do(ctx, true, f)
+}
+
+// do idempotentでないリクエストは結果が不明なエラーを再試行しない
+func (p *RetryPolicy) do(ctx context.Context, idempotent bool, f func(ctx context.Context) error) error {
+	if p == nil || ctx.Value(retryingKey{}) != nil {
+		return f(ctx)
+	}
+	ctx = context.WithValue(ctx, retryingKey{}, p)
+	for attempt := 1; ; attempt++ {
+		err := f(ctx)
+		if err == nil {
+			p.Budget.deposit()
+			return nil
+		}
+		if attempt >= p.MaxAttempts || !p.retryable(err, idempotent) {
+			return err
+		}
+		delay := p.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		if !p.Budget.withdraw() {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *RetryPolicy) retryable(err error, idempotent bool) bool {
+	reason, ok := RetryReasonOf(err)
+	if !ok {
+		return false
+	}
+	if reason == RetryInternalServerError && !idempotent && !p.RetryAmbiguous {
+		return false
+	}
+	if len(p.Reasons) == 0 {
+		return true
+	}
+	for _, r := range p.Reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// delay Returns a random duration up to BaseDelay * 2^(attempt-1) capped by MaxDelay.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d + 1)
+}
+
+// retry p.Do の結果を返す版。inputで再試行してよいエラーを判断する
+func retry[Out any](ctx context.Context, p *RetryPolicy, input any, f func(ctx context.Context) (*Out, error)) (out *Out, err error) {
+	err = p.do(ctx, idempotent(input), func(ctx context.Context) (err error) {
+		out, err = f(ctx)
+		return err
+	})
+	return out, err
+}
+
+// idempotent 適用済みかもしれないリクエストを再試行しても結果が変わらないか
+func idempotent(input any) bool {
+	switch in := input.(type) {
+	case *dynamodb.UpdateItemInput:
+		return false
+	case *dynamodb.PutItemInput: // 適用済みなら条件で失敗する
+		return in.ConditionExpression == nil
+	case *dynamodb.DeleteItemInput:
+		return in.ConditionExpression == nil
+	case *dynamodb.TransactWriteItemsInput:
+		return in.ClientRequestToken != nil
+	}
+	return true
+}
+
+// RetryBudget limits the retries of the requests sharing it.
+// A retry takes a token and a successful request returns one, so retries stop when most requests fail.
+type RetryBudget struct {
+	mu     sync.Mutex
+	tokens int
+	max    int
+}
+
+func NewRetryBudget(tokens int) *RetryBudget {
+	return &RetryBudget{tokens: tokens, max: tokens}
+}
+
+// Available Returns the number of the retries left.
+func (b *RetryBudget) Available() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
+
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens <= 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < b.max {
+		b.tokens++
+	}
+}
@@ -0,0 +1,216 @@
+package foundations
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	ctx := context.Background()
+	failures := map[string]int{}
+	cli := dynamodbfake.New(dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		if failures[operation] > 0 {
+			failures[operation]--
+			return &types.ProvisionedThroughputExceededException{Message: aws.String("throttled")}
+		}
+		return nil
+	}))
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("accounts"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	attempts := 0
+	db := NewDB(cli, Retries(policy), Interceptors(InterceptorFuncs{
+		Before: func(ctx context.Context, operation string, input any) (context.Context, error) {
+			attempts++
+			return ctx, nil
+		},
+	}))
+
+	failures["PutItem"] = 2
+	if _, err := db.Put(ctx, PutItem(ctx, "accounts", map[string]any{"id": "a1"})); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	// 入れ子のポリシーで試行回数が増えない
+	attempts = 0
+	failures["PutItem"] = 3
+	_, err := db.Put(WithRetryPolicy(ctx, policy), PutItem(ctx, "accounts", map[string]any{"id": "a1"}))
+	if !errors.Is(err, ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+
+	// 再試行しない理由
+	attempts = 0
+	failures["PutItem"] = 1
+	only := &RetryPolicy{MaxAttempts: 3, Reasons: []RetryReason{RetryTransactionConflict}}
+	if _, err = Put(WithRetryPolicy(ctx, only), db.Client(), PutItem(ctx, "accounts", map[string]any{"id": "a1"})); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+
+	// 期限を超える待機はしない
+	failures["PutItem"] = 1
+	slow := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	deadline, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err = Put(WithRetryPolicy(deadline, slow), cli, PutItem(ctx, "accounts", map[string]any{"id": "a1"})); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+
+	// 予算を使い切ると再試行しない
+	budget := NewRetryBudget(1)
+	limited := &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, Budget: budget}
+	failures["PutItem"] = 3
+	if _, err = Put(WithRetryPolicy(ctx, limited), cli, PutItem(ctx, "accounts", map[string]any{"id": "a1"})); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("expected ErrThrottled, got %v", err)
+	}
+	if budget.Available() != 0 || failures["PutItem"] != 1 {
+		t.Fatalf("unexpected budget: %d, failures: %d", budget.Available(), failures["PutItem"])
+	}
+}
+
+func TestRetryAmbiguous(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	failures := map[string]int{}
+	attempts := map[string]int{}
+	tokens := map[string]struct{}{}
+	cli := dynamodbfake.New(dynamodbfake.WithRequestHook(func(ctx context.Context, operation string, input any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[operation]++
+		if in, ok := input.(*dynamodb.TransactWriteItemsInput); ok {
+			tokens[aws.ToString(in.ClientRequestToken)] = struct{}{}
+		}
+		if failures[operation] > 0 {
+			failures[operation]--
+			return &types.InternalServerError{Message: aws.String("internal")}
+		}
+		return nil
+	}))
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("accounts"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	db := NewDB(cli, Retries(policy))
+	update := WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		expr, err := expression.NewBuilder().WithUpdate(expression.Add(expression.Name("balance"), expression.Value(10))).Build()
+		return "accounts", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}}, expr, err
+	})
+
+	// 適用済みかもしれない更新は再試行しない
+	failures["UpdateItem"] = 1
+	if _, err := db.Update(ctx, update); err == nil {
+		t.Fatal("expected the internal server error")
+	}
+	if attempts["UpdateItem"] != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts["UpdateItem"])
+	}
+	attempts["UpdateItem"] = 0
+	failures["UpdateItem"] = 1
+	ambiguous := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryAmbiguous: true}
+	if _, err := Update(WithRetryPolicy(ctx, ambiguous), cli, update); err != nil {
+		t.Fatal(err)
+	}
+	if attempts["UpdateItem"] != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts["UpdateItem"])
+	}
+
+	// 条件付きの書き込みは適用済みなら条件で失敗するので再試行しない
+	failures["PutItem"] = 1
+	if _, err := db.Put(ctx, PutItem(ctx, "accounts", map[string]any{"id": "a3"}, func() (expression.Expression, error) {
+		return expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("id"))).Build()
+	})); err == nil {
+		t.Fatal("expected the internal server error")
+	}
+	failures["DeleteItem"] = 1
+	if _, err := db.Delete(ctx, WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		expr, err := expression.NewBuilder().WithCondition(expression.AttributeExists(expression.Name("id"))).Build()
+		return "accounts", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}}, expr, err
+	})); err == nil {
+		t.Fatal("expected the internal server error")
+	}
+	if attempts["PutItem"] != 1 || attempts["DeleteItem"] != 1 {
+		t.Fatalf("expected 1 attempt each, got %v", attempts)
+	}
+	failures["PutItem"] = 1
+	if _, err := db.Put(ctx, PutItem(ctx, "accounts", map[string]any{"id": "a3"})); err != nil {
+		t.Fatal(err)
+	}
+	if attempts["PutItem"] != 3 {
+		t.Fatalf("expected the unconditional put to be retried, got %d", attempts["PutItem"])
+	}
+
+	// トークンを付けたトランザクションは同じトークンで再試行する
+	failures["TransactWriteItems"] = 1
+	if _, err := db.Client().TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{{Put: &types.Put{
+			TableName: aws.String("accounts"),
+			Item:      map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a2"}},
+		}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts["TransactWriteItems"] != 2 || len(tokens) != 1 {
+		t.Fatalf("expected 2 attempts with one token, got %d, %v", attempts["TransactWriteItems"], tokens)
+	}
+	for token := range tokens {
+		if token == "" {
+			t.Fatal("expected a client request token")
+		}
+	}
+}
+
+func TestRetryReasonOf(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason RetryReason
+		ok     bool
+	}{
+		{&types.ProvisionedThroughputExceededException{}, RetryThroughputExceeded, true},
+		{&types.RequestLimitExceeded{}, RetryRequestLimitExceeded, true},
+		{&types.TransactionConflictException{}, RetryTransactionConflict, true},
+		{&types.InternalServerError{}, RetryInternalServerError, true},
+		{&types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")}, {Code: aws.String("TransactionConflict")},
+		}}, RetryTransactionConflict, true},
+		{&types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("ConditionalCheckFailed")}, {Code: aws.String("TransactionConflict")},
+		}}, "", false},
+		{&types.ConditionalCheckFailedException{}, "", false},
+	}
+	for _, tt := range tests {
+		reason, ok := RetryReasonOf(tt.err)
+		if reason != tt.reason || ok != tt.ok {
+			t.Errorf("RetryReasonOf(%T) = %s, %v", tt.err, reason, ok)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package foundations
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pkg/errors"
+)
+
+// VersionConflictError is returned when a write is rejected because the version of the item has been changed.
+// Item is the current item, or nil if the item does not exist.
+type VersionConflictError struct {
+	Table string
+	Item  Record
+	Err   error
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict: %s", e.Table)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return e.Err
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	if target == ErrConditionFailed {
+		return true
+	}
+	_, ok := target.(*VersionConflictError)
+	return ok
+}
+
+// ErrVersionConflict matches every VersionConflictError with errors.Is. A VersionConflictError also matches ErrConditionFailed.
+var ErrVersionConflict *VersionConflictError
+
+func IsVersionConflict(err error) bool {
+	var conflict *VersionConflictError
+	return errors.As(err, &conflict)
+}
+
+// VersionCheck is the version condition of a write of a VersionedWriteItemFunc,
+// built by PutItem, ConditionalPutItem, VersionedUpdateItem and VersionedDeleteItem.
+type VersionCheck struct {
+	Table string
+	Name  string
+	// expected 書き込み前のバージョン。Putの場合だけ分かる
+	expected *int64
+}
+
+// VersionCheckOf Returns the version condition of a write of item on the version attribute name,
+// or nil if name is empty and the write is not versioned.
+func VersionCheckOf(table, name string, item map[string]types.AttributeValue) *VersionCheck {
+	if name == "" {
+		return nil
+	}
+	c := &VersionCheck{Table: table, Name: name}
+	if n, ok := item[name].(*types.AttributeValueMemberN); ok {
+		if next, err := strconv.ParseInt(n.Value, 10, 64); err == nil {
+			expected := next - 1
+			c.expected = &expected
+		}
+	}
+	return c
+}
+
+// ReturnValues Returns the ReturnValuesOnConditionCheckFailure that returns the current item on a version conflict.
+func (c *VersionCheck) ReturnValues() types.ReturnValuesOnConditionCheckFailure {
+	if c == nil {
+		return ""
+	}
+	return types.ReturnValuesOnConditionCheckFailureAllOld
+}
+
+// Conflict Returns a VersionConflictError if the condition of the write failed for the version,
+// or nil if it failed for another condition combined with the version. current is the item returned on the failure.
+func (c *VersionCheck) Conflict(current Record, err error) *VersionConflictError {
+	if c == nil {
+		return nil
+	}
+	if c.expected != nil {
+		v, ok := current[c.Name]
+		if *c.expected == 0 && !ok {
+			return nil
+		}
+		if n, isN := v.(*types.AttributeValueMemberN); isN && n.Value == strconv.FormatInt(*c.expected, 10) {
+			return nil
+		}
+	}
+	return &VersionConflictError{Table: c.Table, Item: current, Err: err}
+}
+
+// versionConflict ConditionalCheckFailedの場合だけ判定する
+func versionConflict(c *VersionCheck, err error) *VersionConflictError {
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		return nil
+	}
+	return c.Conflict(ccf.Item, err)
+}
+
+type version struct {
+	name    string
+	current int64
+	field   reflect.Value
+}
+
+func versionOf(rec any) (*version, error) {
+	rv := reflect.ValueOf(rec)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	schema, err := schemaOf(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	if schema.version == nil {
+		return nil, nil
+	}
+	field, err := rv.FieldByIndexErr(schema.version.index)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	v := &version{name: schema.version.name, field: field}
+	if field.CanInt() {
+		v.current = field.Int()
+	} else {
+		v.current = int64(field.Uint())
+	}
+	return v, nil
+}
+
+// condition 未保存(0)の場合は属性が存在しないことを条件にする
+func (v *version) condition() expression.ConditionBuilder {
+	if v.current == 0 {
+		return expression.AttributeNotExists(expression.Name(v.name))
+	}
+	return expression.Name(v.name).Equal(expression.Value(v.current))
+}
+
+func (v *version) next() types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(v.current+1, 10)}
+}
+
+// increment Sets the version of the record to the next value after a successful write.
+func (v *version) increment() {
+	if !v.field.CanSet() {
+		return
+	}
+	if v.field.CanInt() {
+		v.field.SetInt(v.current + 1)
+	} else {
+		v.field.SetUint(uint64(v.current + 1))
+	}
+}
+
+// ConditionalPutItem Returns a VersionedWriteItemFunc that puts rec if cond is satisfied.
+// If rec has a version attribute, cond is combined with the version condition.
+func ConditionalPutItem(ctx context.Context, tableName string, rec any, cond expression.ConditionBuilder) VersionedWriteItemFunc {
+	return func() (table string, item map[string]types.AttributeValue, expr expression.Expression, name string, err error) {
+		var v *version
+		if item, v, err = marshalRecord(ctx, rec); err != nil {
+			return
+		}
+		condition := cond
+		if v != nil {
+			item[v.name] = v.next()
+			if condition.IsSet() {
+				condition = condition.And(v.condition())
+			} else {
+				condition = v.condition()
+			}
+		}
+		if condition.IsSet() {
+			if expr, err = expression.NewBuilder().WithCondition(condition).Build(); err != nil {
+				err = errors.WithStack(err)
+				return
+			}
+		}
+		if v != nil {
+			name = v.name
+		}
+		table = tableName
+		return
+	}
+}
+
+func marshalRecord(ctx context.Context, rec any) (item map[string]types.AttributeValue, v *version, err error) {
+	if preprocessor, ok := rec.(PutItemPreprocessor); ok {
+		rec, err = preprocessor.BeforePutItem(ctx)
+		if err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+	}
+	if item, err = attributevalue.MarshalMap(rec); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if v, err = versionOf(rec); err != nil {
+		return
+	}
+	return item, v, nil
+}
+
+// VersionedUpdateItem Returns a VersionedWriteItemFunc that updates the item of rec if its version has not been changed,
+// and increments the version. It is the same as UpdateItem if rec has no version attribute.
+func VersionedUpdateItem(ctx context.Context, keyFunc GetKeyFunc, rec any, fields ...UpdateField) VersionedWriteItemFunc {
+	return func() (table string, item map[string]types.AttributeValue, expr expression.Expression, name string, err error) {
+		var v *version
+		if v, err = versionOf(rec); err != nil {
+			return
+		}
+		if v == nil {
+			return UpdateItem(ctx, keyFunc, fields...).WriteItem()
+		}
+		table, item, _, err = keyFunc()
+		if err != nil {
+			return
+		}
+		builder := UpdateBuilder(ctx, fields...).Set(expression.Name(v.name), expression.Value(v.current+1))
+		if expr, err = expression.NewBuilder().WithUpdate(builder).WithCondition(v.condition()).Build(); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		name = v.name
+		return
+	}
+}
+
+// VersionedDeleteItem Returns a VersionedWriteItemFunc that deletes the item of rec if its version has not been changed.
+// It is the same as DeleteItem if rec has no version attribute.
+func VersionedDeleteItem(keyFunc GetKeyFunc, rec any) VersionedWriteItemFunc {
+	return func() (table string, keys map[string]types.AttributeValue, expr expression.Expression, name string, err error) {
+		if table, keys, _, err = keyFunc(); err != nil {
+			return
+		}
+		var v *version
+		if v, err = versionOf(rec); err != nil || v == nil {
+			return
+		}
+		if expr, err = expression.NewBuilder().WithCondition(v.condition()).Build(); err != nil {
+			err = errors.WithStack(err)
+			return
+		}
+		name = v.name
+		return
+	}
+}
@@ -0,0 +1,155 @@
+package foundations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+)
+
+type Account struct {
+	ID        string `dynamodbav:"id" dynamodbkey:"hash"`
+	Balance   int    `dynamodbav:"balance"`
+	UpdateCnt int    `dynamodbav:"update_cnt" dynamodbversion:"true"`
+}
+
+func setupAccounts(t *testing.T) (context.Context, *dynamodbfake.Client) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("accounts"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ctx, cli
+}
+
+func TestVersion(t *testing.T) {
+	ctx, cli := setupAccounts(t)
+	repo, err := NewRepository[Account]("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &Account{ID: "a1", Balance: 100}
+	if err = repo.Put(ctx, cli, account); err != nil {
+		t.Fatal(err)
+	}
+	if account.UpdateCnt != 1 {
+		t.Fatalf("expected version 1, got %d", account.UpdateCnt)
+	}
+	// 新規作成は既存のアイテムと衝突する
+	if _, err = Put(ctx, cli, PutItem(ctx, "accounts", &Account{ID: "a1"})); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+	stale := *account
+	updated, err := repo.Update(ctx, cli, account, []UpdateField{AddValue("balance", 50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.UpdateCnt != 2 || updated.Balance != 150 {
+		t.Fatalf("unexpected account: %+v", updated)
+	}
+	_, err = repo.Update(ctx, cli, &stale, []UpdateField{AddValue("balance", 50)})
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+	var current Account
+	if err = conflict.Item.Unmarshal(ctx, &current); err != nil {
+		t.Fatal(err)
+	}
+	if current.UpdateCnt != 2 || current.Balance != 150 {
+		t.Fatalf("unexpected current item: %+v", current)
+	}
+	if err = repo.Delete(ctx, cli, &stale); !IsVersionConflict(err) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+	if err = repo.Put(ctx, cli, updated); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Delete(ctx, cli, updated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.Get(ctx, cli, repo.KeyOf("a1")); !IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestConditionalPutItem(t *testing.T) {
+	ctx, cli := setupAccounts(t)
+	cond := expression.AttributeNotExists(expression.Name("id"))
+	if _, err := Put(ctx, cli, PutItem(ctx, "accounts", &Account{ID: "a1"}, func() (expression.Expression, error) {
+		return expression.NewBuilder().WithCondition(cond).Build()
+	})); err == nil {
+		t.Fatal("expected error for an expression with a versioned item")
+	}
+	if _, err := Put(ctx, cli, ConditionalPutItem(ctx, "accounts", &Account{ID: "a1"}, cond)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Put(ctx, cli, ConditionalPutItem(ctx, "accounts", &Account{ID: "a1", UpdateCnt: 1}, expression.Name("balance").GreaterThan(expression.Value(0))))
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) || IsVersionConflict(err) {
+		t.Fatalf("expected ConditionalCheckFailedException, got %v", err)
+	}
+	// 条件とバージョンの両方が満たされない場合はバージョンの衝突になる
+	_, err = Put(ctx, cli, ConditionalPutItem(ctx, "accounts", &Account{ID: "a1", UpdateCnt: 5}, expression.Name("balance").GreaterThan(expression.Value(0))))
+	if !IsVersionConflict(err) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+	// バージョン属性と同じ名前の条件でもバージョンの条件ではない
+	_, err = Update(ctx, cli, WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		expr, err := expression.NewBuilder().
+			WithUpdate(expression.Set(expression.Name("balance"), expression.Value(10))).
+			WithCondition(expression.Name("update_cnt").Equal(expression.Value(5))).Build()
+		return "accounts", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}}, expr, err
+	}))
+	if !errors.As(err, &ccf) || IsVersionConflict(err) {
+		t.Fatalf("expected ConditionalCheckFailedException, got %v", err)
+	}
+}
+
+func TestVersionedWriteItemFunc(t *testing.T) {
+	ctx, cli := setupAccounts(t)
+	repo, err := NewRepository[Account]("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &Account{ID: "a1", UpdateCnt: 1}
+	for _, f := range []VersionedWriteItemFunc{
+		PutItem(ctx, "accounts", account),
+		VersionedUpdateItem(ctx, repo.KeyOf("a1"), account, AddValue("balance", 1)),
+		VersionedDeleteItem(repo.KeyOf("a1"), account),
+	} {
+		_, _, expr, name, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "update_cnt" || expr.Projection() != nil {
+			t.Fatalf("unexpected version: %s %v", name, expr.Projection())
+		}
+	}
+	if _, _, _, name, _ := PutItem(ctx, "accounts", map[string]any{"id": "a1"}).WriteItem(); name != "" {
+		t.Fatalf("expected no version, got %s", name)
+	}
+	// 書き込み式の内容ではバージョンの条件にならない
+	if _, err = Put(ctx, cli, PutItem(ctx, "accounts", &Account{ID: "a1"})); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Put(ctx, cli, WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		expr, err := expression.NewBuilder().
+			WithCondition(expression.Name("update_cnt").Equal(expression.Value(5))).
+			WithProjection(expression.NamesList(expression.Name("update_cnt"))).Build()
+		return "accounts", map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a1"}}, expr, err
+	}))
+	if !errors.Is(err, ErrConditionFailed) || IsVersionConflict(err) {
+		t.Fatalf("expected ConditionalCheckFailedException, got %v", err)
+	}
+}
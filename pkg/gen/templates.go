@@ -47,7 +47,7 @@ type {{ $DaoName }} struct {
 {{- else }}
 	{{ .EntityName }}
 {{- end }}
-    UpdateCnt int {{ .BackQuote }}json:"-" dynamodbav:"update_cnt"{{ .BackQuote }}
+    UpdateCnt int {{ .BackQuote }}json:"-" dynamodbav:"update_cnt" dynamodbversion:"true"{{ .BackQuote }}
 }
 
 {{- if .BinaryMarshaller }}
@@ -73,16 +73,16 @@ func (rec *{{ $DaoName }}) GetKey(ctx context.Context) foundations.GetKeyFunc {
     }
 }
 
-func (rec *{{ $DaoName }}) PutItem(ctx context.Context) foundations.WriteItemFunc {
+func (rec *{{ $DaoName }}) PutItem(ctx context.Context) foundations.VersionedWriteItemFunc {
 	return foundations.PutItem(ctx, rec.TableName(), rec)
 }
 
-func (rec *{{ $DaoName }}) DeleteItem(ctx context.Context) foundations.WriteItemFunc {
-	return foundations.DeleteItem(rec.GetKey(ctx))
+func (rec *{{ $DaoName }}) DeleteItem(ctx context.Context) foundations.VersionedWriteItemFunc {
+	return foundations.VersionedDeleteItem(rec.GetKey(ctx), rec)
 }
 
-func (rec *{{ $DaoName }}) UpdateItem(ctx context.Context, fields ...foundations.UpdateField) foundations.WriteItemFunc {
-	return foundations.UpdateItem(ctx, rec.GetKey(ctx), fields...)
+func (rec *{{ $DaoName }}) UpdateItem(ctx context.Context, fields ...foundations.UpdateField) foundations.VersionedWriteItemFunc {
+	return foundations.VersionedUpdateItem(ctx, rec.GetKey(ctx), rec, fields...)
 }
 
 func (rec *{{ $DaoName }}) Get(ctx context.Context) (res *{{ $DaoName }}, err error) {
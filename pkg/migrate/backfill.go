@@ -0,0 +1,574 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// BackfillFunc Returns the fields to update item with. No fields leave the item as it is.
+// It may be called again for the same item when a backfill is resumed, so the fields should not depend on how many times it was called.
+type BackfillFunc func(ctx context.Context, item foundations.Record) ([]foundations.UpdateField, error)
+
+type BackfillClient interface {
+	MigrationApi
+	foundations.ScanClient
+	foundations.WriteClient
+}
+
+// BackfillProgress is the progress of a Backfill in this process.
+type BackfillProgress struct {
+	Scanned int64
+	Updated int64
+	Skipped int64
+	// Conflicts is the number of the items that were modified concurrently every time they were updated.
+	Conflicts int64
+}
+
+// BackfillState is the state of a backfill saved in MigrationTable.
+type BackfillState struct {
+	ID            string                      `dynamodbav:"id"`
+	Table         string                      `dynamodbav:"table"`
+	TotalSegments int32                       `dynamodbav:"total_segments"`
+	Segments      map[string]*BackfillSegment `dynamodbav:"segments"`
+	CompletedAt   *time.Time                  `dynamodbav:"completed_at,omitempty"`
+}
+
+// BackfillSegment is the state of a scan segment. Owner is the claim of the worker that scans the segment until Lease,
+// which is the name of the process followed by the run, the worker and a nonce.
+type BackfillSegment struct {
+	Owner   string    `dynamodbav:"owner,omitempty"`
+	Lease   time.Time `dynamodbav:"lease,unixtime"`
+	Key     string    `dynamodbav:"key,omitempty"`
+	Done    bool      `dynamodbav:"done"`
+	Scanned int64     `dynamodbav:"scanned"`
+	Updated int64     `dynamodbav:"updated"`
+}
+
+func (s *BackfillState) completed() bool {
+	for _, v := range s.Segments {
+		if !v.Done {
+			return false
+		}
+	}
+	return true
+}
+
+type backfillConfig struct {
+	segments    int32
+	concurrency int
+	guards      []string
+	retries     int
+	wait        func(ctx context.Context) error
+	lease       time.Duration
+	owner       string
+	scan        []options.Option
+	progress    func(p BackfillProgress)
+}
+
+type BackfillOption func(c *backfillConfig)
+
+// BackfillSegments Scans the table with n parallel segments. The default is foundations.DefaultScanSegments.
+// It is used only when the backfill starts for the first time.
+func BackfillSegments(n int32) BackfillOption {
+	return func(c *backfillConfig) {
+		c.segments = n
+	}
+}
+
+// BackfillConcurrency Scans at most n segments at once in this process. The default is the number of segments.
+func BackfillConcurrency(n int) BackfillOption {
+	return func(c *backfillConfig) {
+		c.concurrency = n
+	}
+}
+
+// BackfillGuard Updates an item only if the attributes of names have not changed since the item was read,
+// e.g. the version attribute of the entities. Without guards an item is updated only if none of its attributes
+// and none of the attributes the update expression refers to have changed, which may exceed the size limit
+// of a condition expression for an item with many attributes.
+func BackfillGuard(names ...string) BackfillOption {
+	return func(c *backfillConfig) {
+		c.guards = append(c.guards, names...)
+	}
+}
+
+// BackfillConflictRetries Reads an item again and retries the update at most n times when it was modified concurrently. The default is 3.
+func BackfillConflictRetries(n int) BackfillOption {
+	return func(c *backfillConfig) {
+		c.retries = n
+	}
+}
+
+// BackfillRateLimit Calls wait before every UpdateItem, e.g. to wait for a write unit with ratelimit.Limiter.Wait.
+func BackfillRateLimit(wait func(ctx context.Context) error) BackfillOption {
+	return func(c *backfillConfig) {
+		c.wait = wait
+	}
+}
+
+// BackfillLease Sets how long a segment is owned by this process without progress. The default is a minute.
+// The segments of a process that stopped are taken over by the others after the lease.
+func BackfillLease(d time.Duration) BackfillOption {
+	return func(c *backfillConfig) {
+		c.lease = d
+	}
+}
+
+// BackfillOwner Sets the name of this process in the state. The default is the host name and the process id.
+func BackfillOwner(owner string) BackfillOption {
+	return func(c *backfillConfig) {
+		c.owner = owner
+	}
+}
+
+// BackfillScanOptions Applies opt to the ScanInput of every segment, e.g. options.Limit to checkpoint in smaller pages.
+func BackfillScanOptions(opt ...options.Option) BackfillOption {
+	return func(c *backfillConfig) {
+		c.scan = append(c.scan, opt...)
+	}
+}
+
+// OnBackfillProgress Calls f after every page has been updated. Calls are serialized.
+func OnBackfillProgress(f func(p BackfillProgress)) BackfillOption {
+	return func(c *backfillConfig) {
+		c.progress = f
+	}
+}
+
+func backfillID(name string) string {
+	return "backfill/" + name
+}
+
+// errLeaseLost セグメントが他のプロセスに引き継がれた
+var errLeaseLost = errors.New("lease lost")
+
+// topLevelNames 更新式のパスの先頭の属性名のプレースホルダー
+var topLevelNames = regexp.MustCompile(`(?:^|[^.\w#])(#\w+)`)
+
+type backfill struct {
+	api      BackfillClient
+	id       string
+	run      string // 同じ名前のプロセスとも区別する
+	table    string
+	schema   foundations.KeySchema
+	f        BackfillFunc
+	conf     *backfillConfig
+	mu       sync.Mutex
+	progress BackfillProgress
+}
+
+// Backfill Updates every item of table with the fields returned by f, e.g. to populate the attribute of a new index.
+// The table is scanned with parallel segments, and the LastEvaluatedKey of every segment is saved to the item of name
+// in MigrationTable after its page has been updated. Processes running the same backfill share the segments,
+// and a backfill that stopped is resumed from the saved keys. It returns when all the segments have finished.
+func Backfill(ctx context.Context, api BackfillClient, name, table string, f BackfillFunc, opt ...BackfillOption) (BackfillProgress, error) {
+	conf := &backfillConfig{segments: foundations.DefaultScanSegments, retries: 3, lease: time.Minute}
+	for _, o := range opt {
+		o(conf)
+	}
+	if conf.owner == "" {
+		host, _ := os.Hostname()
+		conf.owner = fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+	}
+	if conf.segments < 1 {
+		return BackfillProgress{}, fmt.Errorf("invalid number of segments: %d", conf.segments)
+	}
+	if err := prepareMigrationTable(ctx, api); err != nil {
+		return BackfillProgress{}, err
+	}
+	schema, err := foundations.DescribeKeySchema(ctx, api, table)
+	if err != nil {
+		return BackfillProgress{}, err
+	}
+	b := &backfill{api: api, id: backfillID(name), run: uuid.NewString(), table: table, schema: schema, f: f, conf: conf}
+	state, err := b.start(ctx)
+	if err != nil {
+		return b.progress, err
+	}
+	if state.CompletedAt != nil {
+		return b.progress, nil
+	}
+	concurrency := conf.concurrency
+	if concurrency <= 0 || concurrency > int(state.TotalSegments) {
+		concurrency = int(state.TotalSegments)
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			return b.work(gctx, i)
+		})
+	}
+	err = g.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.progress, err
+}
+
+// BackfillStatus Returns the state of the backfill of name, or nil if it has not started.
+func BackfillStatus(ctx context.Context, api MigrationApi, name string) (*BackfillState, error) {
+	out, err := api.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: backfillID(name)}},
+		TableName:      aws.String(MigrationTable),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(foundations.Classify(MigrationTable, err))
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	state := &BackfillState{}
+	if err = attributevalue.UnmarshalMap(out.Item, state); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return state, nil
+}
+
+// start 状態のアイテムが無ければ作成し、あれば読み込む
+func (b *backfill) start(ctx context.Context) (*BackfillState, error) {
+	state := &BackfillState{
+		ID:            b.id,
+		Table:         b.table,
+		TotalSegments: b.conf.segments,
+		Segments:      make(map[string]*BackfillSegment, b.conf.segments),
+	}
+	for segment := int32(0); segment < b.conf.segments; segment++ {
+		state.Segments[strconv.Itoa(int(segment))] = &BackfillSegment{}
+	}
+	item, err := attributevalue.MarshalMap(state)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	expr, err := expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("id"))).Build()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err = foundations.Put(ctx, b.api, foundations.WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		return MigrationTable, item, expr, nil
+	})); err == nil {
+		return state, nil
+	} else if !errors.Is(err, foundations.ErrConditionFailed) {
+		return nil, err
+	}
+	if state, err = b.load(ctx); err != nil {
+		return nil, err
+	}
+	if state.Table != b.table {
+		return nil, fmt.Errorf("backfill %s is of table %s", b.id, state.Table)
+	}
+	return state, nil
+}
+
+func (b *backfill) load(ctx context.Context) (*BackfillState, error) {
+	state := &BackfillState{}
+	if _, err := foundations.Get(ctx, b.api, func() (string, map[string]types.AttributeValue, []string, error) {
+		return MigrationTable, map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: b.id}}, nil, nil
+	}, foundations.FetchItem(ctx, state), options.ConsistentRead(aws.Bool(true))); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// work セグメントを取得して処理することを全てのセグメントが終わるまで繰り返す
+func (b *backfill) work(ctx context.Context, worker int) error {
+	for {
+		state, err := b.load(ctx)
+		if err != nil {
+			return err
+		}
+		if state.completed() {
+			return b.complete(ctx)
+		}
+		now := time.Now()
+		wait := b.conf.lease / 10 // 他のプロセスが終わるのを待つ間の確認の間隔
+		claimed, others := false, false
+		for segment := int32(0); segment < state.TotalSegments; segment++ {
+			s := state.Segments[strconv.Itoa(int(segment))]
+			if s == nil || s.Done || b.owns(s) { // このプロセスの他のワーカーのセグメントは期限が切れていても取得しない
+				continue
+			}
+			if s.Owner != "" && s.Lease.After(now) {
+				others = true
+				wait = min(wait, s.Lease.Sub(now))
+				continue
+			}
+			if token, err := b.claim(ctx, worker, segment, now); err != nil {
+				return err
+			} else if token != "" {
+				claimed = true
+				if err = b.scan(ctx, token, state.TotalSegments, segment, s.Key); err != nil && !errors.Is(err, errLeaseLost) {
+					b.release(context.WithoutCancel(ctx), token, segment)
+					return err
+				}
+				break
+			}
+			others = true // 同時に他から取得された
+		}
+		if !claimed {
+			if !others { // 残りはこのプロセスの他のワーカーが処理している
+				return nil
+			}
+			// 他のプロセスが処理中のセグメントは期限が切れたら引き継ぐ
+			wait = max(wait, 10*time.Millisecond)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// owns セグメントがこのプロセスのワーカーに取得されているか
+func (b *backfill) owns(s *BackfillSegment) bool {
+	return strings.HasPrefix(s.Owner, b.conf.owner+"/"+b.run+"/")
+}
+
+func (b *backfill) segmentName(segment int32, names ...string) expression.NameBuilder {
+	path := "segments." + strconv.Itoa(int(segment))
+	for _, v := range names {
+		path += "." + v
+	}
+	return expression.Name(path)
+}
+
+// claim 未処理か期限切れのセグメントを取得し、取得ごとに異なるトークンを返す
+func (b *backfill) claim(ctx context.Context, worker int, segment int32, now time.Time) (string, error) {
+	token := fmt.Sprintf("%s/%s/%d/%s", b.conf.owner, b.run, worker, uuid.NewString())
+	condition := b.segmentName(segment, "done").Equal(expression.Value(false)).
+		And(expression.Or(
+			expression.AttributeNotExists(b.segmentName(segment, "owner")),
+			b.segmentName(segment, "lease").LessThanEqual(expression.Value(now.Unix())),
+		))
+	update := expression.Set(b.segmentName(segment, "owner"), expression.Value(token)).
+		Set(b.segmentName(segment, "lease"), expression.Value(now.Add(b.conf.lease).Unix()))
+	if err := b.update(ctx, update, condition); err != nil {
+		if errors.Is(err, foundations.ErrConditionFailed) {
+			return "", nil
+		}
+		return "", err
+	}
+	return token, nil
+}
+
+// renew 取得したセグメントの期限を延長し、進捗を保存する
+func (b *backfill) renew(ctx context.Context, token string, segment int32, update expression.UpdateBuilder) error {
+	update = update.Set(b.segmentName(segment, "lease"), expression.Value(time.Now().Add(b.conf.lease).Unix()))
+	condition := b.segmentName(segment, "owner").Equal(expression.Value(token))
+	if err := b.update(ctx, update, condition); err != nil {
+		if errors.Is(err, foundations.ErrConditionFailed) {
+			return errors.WithStack(errLeaseLost)
+		}
+		return err
+	}
+	return nil
+}
+
+// release 失敗したセグメントを他のプロセスがすぐに引き継げるようにする
+func (b *backfill) release(ctx context.Context, token string, segment int32) {
+	_ = b.update(ctx, expression.Set(b.segmentName(segment, "lease"), expression.Value(0)),
+		b.segmentName(segment, "owner").Equal(expression.Value(token)))
+}
+
+func (b *backfill) update(ctx context.Context, update expression.UpdateBuilder, condition expression.ConditionBuilder) error {
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = foundations.Update(ctx, b.api, foundations.WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		return MigrationTable, map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: b.id}}, expr, nil
+	}))
+	return err
+}
+
+// complete 全てのセグメントが終わったことを記録する
+func (b *backfill) complete(ctx context.Context) error {
+	err := b.update(ctx, expression.Set(expression.Name("completed_at"), expression.Value(time.Now())),
+		expression.AttributeNotExists(expression.Name("completed_at")))
+	if errors.Is(err, foundations.ErrConditionFailed) {
+		return nil
+	}
+	return err
+}
+
+// scan 取得したセグメントを保存されたキーから処理する
+func (b *backfill) scan(ctx context.Context, token string, total, segment int32, start string) error {
+	var key foundations.EvaluatedKey
+	if start != "" {
+		var err error
+		if key, err = foundations.EvaluatedKeyOf(start); err != nil {
+			return err
+		}
+	}
+	renewed := time.Now()
+	var scanned, updated int64
+	_, err := foundations.ParallelScanPages(ctx, b.api, func() (string, expression.Expression, error) {
+		return b.table, expression.Expression{}, nil
+	}, func(ctx context.Context, segment int32, items foundations.Records) error {
+		scanned, updated = int64(len(items)), 0
+		for _, v := range items {
+			ok, err := b.apply(ctx, v)
+			if err != nil {
+				return err
+			}
+			if ok {
+				updated++
+			}
+			if time.Since(renewed) > b.conf.lease/2 { // 大きなページの途中で期限が切れないようにする
+				if err = b.renew(ctx, token, segment, expression.UpdateBuilder{}); err != nil {
+					return err
+				}
+				renewed = time.Now()
+			}
+		}
+		return nil
+	}, foundations.Segments(total), foundations.ResumeFrom(map[int32]foundations.EvaluatedKey{segment: key}),
+		foundations.ScanOptions(b.conf.scan...),
+		foundations.Checkpoint(func(segment int32, key foundations.EvaluatedKey) error {
+			update := expression.Add(b.segmentName(segment, "scanned"), expression.Value(scanned)).
+				Add(b.segmentName(segment, "updated"), expression.Value(updated))
+			if key == nil {
+				update = update.Set(b.segmentName(segment, "done"), expression.Value(true)).
+					Remove(b.segmentName(segment, "key"))
+			} else {
+				next, err := key.String()
+				if err != nil {
+					return err
+				}
+				update = update.Set(b.segmentName(segment, "key"), expression.Value(next))
+			}
+			if err := b.renew(ctx, token, segment, update); err != nil {
+				return err
+			}
+			renewed = time.Now()
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.progress.Scanned += scanned
+			b.progress.Updated += updated
+			if b.conf.progress != nil {
+				b.conf.progress(b.progress)
+			}
+			return nil
+		}))
+	return err
+}
+
+// apply 同時に更新されていた場合は読み直して更新をやり直す
+func (b *backfill) apply(ctx context.Context, item foundations.Record) (bool, error) {
+	key, err := b.schema.Key(item)
+	if err != nil {
+		return false, err
+	}
+	for attempt := 0; ; attempt++ {
+		fields, err := b.f(ctx, item)
+		if err != nil {
+			return false, err
+		}
+		if len(fields) == 0 {
+			b.count(func(p *BackfillProgress) { p.Skipped++ })
+			return false, nil
+		}
+		update := foundations.UpdateBuilder(ctx, fields...)
+		expr, err := expression.NewBuilder().WithUpdate(update).Build()
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		if expr, err = expression.NewBuilder().WithUpdate(update).WithCondition(b.guard(item, expr)).Build(); err != nil {
+			return false, errors.WithStack(err)
+		}
+		if b.conf.wait != nil {
+			if err = b.conf.wait(ctx); err != nil {
+				return false, err
+			}
+		}
+		if _, err = foundations.Update(ctx, b.api, foundations.WriteItemFunc(func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+			return b.table, key, expr, nil
+		})); err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, foundations.ErrConditionFailed) {
+			return false, err
+		}
+		if attempt >= b.conf.retries {
+			b.count(func(p *BackfillProgress) { p.Conflicts++ })
+			return false, nil
+		}
+		item = nil
+		if _, err = foundations.Get(ctx, b.api, func() (string, map[string]types.AttributeValue, []string, error) {
+			return b.table, key, nil, nil
+		}, func(tableName string, value foundations.Record) error {
+			item = value
+			return nil
+		}, options.ConsistentRead(aws.Bool(true))); err != nil {
+			if foundations.IsItemNotFound(err) { // 削除されたアイテムは更新しない
+				b.count(func(p *BackfillProgress) { p.Skipped++ })
+				return false, nil
+			}
+			return false, err
+		}
+	}
+}
+
+// guard 読み込んだ時点から変更されていないことを条件にする
+// 指定が無ければ、BackfillFuncが読んだかもしれない全ての属性と更新式が参照する属性を比べる
+func (b *backfill) guard(item foundations.Record, update expression.Expression) expression.ConditionBuilder {
+	condition := expression.AttributeExists(expression.NameNoDotSplit(b.schema.Hash))
+	guards := b.conf.guards
+	if len(guards) == 0 {
+		keys := map[string]bool{}
+		for _, name := range b.schema.Names() {
+			keys[name] = true
+		}
+		for name := range item {
+			if !keys[name] {
+				guards = append(guards, name)
+			}
+		}
+		sort.Strings(guards)
+		for _, m := range topLevelNames.FindAllStringSubmatch(aws.ToString(update.Update()), -1) {
+			if name, ok := update.Names()[m[1]]; ok && !keys[name] {
+				keys[name] = true
+				if _, read := item[name]; !read {
+					guards = append(guards, name)
+				}
+			}
+		}
+	}
+	for _, name := range guards {
+		if v, ok := item[name]; ok {
+			condition = condition.And(expression.NameNoDotSplit(name).Equal(expression.Value(v)))
+		} else {
+			condition = condition.And(expression.AttributeNotExists(expression.NameNoDotSplit(name)))
+		}
+	}
+	return condition
+}
+
+func (b *backfill) count(f func(p *BackfillProgress)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f(&b.progress)
+}
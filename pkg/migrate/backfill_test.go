@@ -0,0 +1,344 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/goccha/dynamodb-verse/pkg/ratelimit"
+)
+
+func newBackfillTable(t *testing.T, n int) *dynamodbfake.Client {
+	t.Helper()
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("users"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeN}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := cli.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String("users"),
+			Item: map[string]types.AttributeValue{
+				"id":      &types.AttributeValueMemberN{Value: fmt.Sprint(i)},
+				"version": &types.AttributeValueMemberN{Value: "1"},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cli
+}
+
+func idOf(item foundations.Record) int {
+	id, _ := strconv.Atoi(item["id"].(*types.AttributeValueMemberN).Value)
+	return id
+}
+
+func groupOf(ctx context.Context, item foundations.Record) ([]foundations.UpdateField, error) {
+	id := idOf(item)
+	if id%10 == 0 {
+		return nil, nil
+	}
+	return []foundations.UpdateField{foundations.SetValue("group", fmt.Sprintf("g%d", id%3))}, nil
+}
+
+func assertBackfilled(t *testing.T, cli *dynamodbfake.Client, n int) {
+	t.Helper()
+	out, err := cli.Scan(context.Background(), &dynamodb.ScanInput{TableName: aws.String("users")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(out.Count) != n {
+		t.Fatalf("expected %d items, got %d", n, out.Count)
+	}
+	for _, item := range out.Items {
+		id := idOf(item)
+		if v, ok := item["group"]; id%10 == 0 && ok {
+			t.Fatalf("expected item %d to be skipped: %v", id, v)
+		} else if id%10 != 0 && (!ok || v.(*types.AttributeValueMemberS).Value != fmt.Sprintf("g%d", id%3)) {
+			t.Fatalf("expected item %d to be backfilled: %v", id, item)
+		}
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	cli := newBackfillTable(t, 50)
+	var wg sync.WaitGroup
+	limiter := ratelimit.New(ratelimit.Table("users", 0, 1000))
+	results := make([]BackfillProgress, 2)
+	errs := make([]error, 2)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = Backfill(ctx, cli, "users-group", "users", groupOf, BackfillSegments(3), BackfillLease(2*time.Second),
+				BackfillOwner(fmt.Sprintf("process%d", i)), BackfillScanOptions(options.Limit(7)),
+				BackfillRateLimit(func(ctx context.Context) error {
+					return limiter.Wait(ctx, "users", "", ratelimit.Units{Write: 1})
+				}))
+		}()
+	}
+	wg.Wait()
+	var total BackfillProgress
+	for i, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+		total.Scanned += results[i].Scanned
+		total.Updated += results[i].Updated
+		total.Skipped += results[i].Skipped
+	}
+	if total.Scanned != 50 || total.Updated != 45 || total.Skipped != 5 {
+		t.Fatalf("unexpected progress: %+v", total)
+	}
+	assertBackfilled(t, cli, 50)
+
+	state, err := BackfillStatus(ctx, cli, "users-group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.CompletedAt == nil || state.TotalSegments != 3 {
+		t.Fatalf("expected the backfill to be completed: %+v", state)
+	}
+	var scanned int64
+	for _, s := range state.Segments {
+		scanned += s.Scanned
+	}
+	if scanned != 50 {
+		t.Fatalf("expected 50 scanned items in the state, got %d", scanned)
+	}
+	p, err := Backfill(ctx, cli, "users-group", "users", func(ctx context.Context, item foundations.Record) ([]foundations.UpdateField, error) {
+		return nil, errors.New("a completed backfill must not run again")
+	})
+	if err != nil || p.Scanned != 0 {
+		t.Fatalf("unexpected result: %+v, %v", p, err)
+	}
+}
+
+func TestBackfillResume(t *testing.T) {
+	ctx := context.Background()
+	cli := newBackfillTable(t, 50)
+	var mu sync.Mutex
+	calls := 0
+	_, err := Backfill(ctx, cli, "users-group", "users", func(ctx context.Context, item foundations.Record) ([]foundations.UpdateField, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if calls++; calls > 20 {
+			return nil, errors.New("stopped")
+		}
+		return groupOf(ctx, item)
+	}, BackfillSegments(2), BackfillOwner("first"), BackfillScanOptions(options.Limit(5)))
+	if err == nil {
+		t.Fatal("expected the backfill to fail")
+	}
+	state, err := BackfillStatus(ctx, cli, "users-group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.CompletedAt != nil || state.Segments["0"].Key == "" && state.Segments["1"].Key == "" {
+		t.Fatalf("expected the progress to be saved: %+v", state)
+	}
+	// 停止したプロセスが所有したままのセグメントは期限が切れてから引き継がれる
+	if _, err = cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(MigrationTable),
+		Key:                      map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "backfill/users-group"}},
+		UpdateExpression:         aws.String("SET #s.#0.#o = :o, #s.#0.#l = :l"),
+		ExpressionAttributeNames: map[string]string{"#s": "segments", "#0": "0", "#o": "owner", "#l": "lease"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":o": &types.AttributeValueMemberS{Value: "crashed"},
+			":l": &types.AttributeValueMemberN{Value: fmt.Sprint(time.Now().Add(time.Second).Unix())},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Backfill(ctx, cli, "users-group", "users", groupOf, BackfillOwner("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Scanned >= 50 {
+		t.Fatalf("expected the backfill to be resumed: %+v", p)
+	}
+	assertBackfilled(t, cli, 50)
+}
+
+func TestBackfillConflict(t *testing.T) {
+	ctx := context.Background()
+	cli := newBackfillTable(t, 10)
+	var mu sync.Mutex
+	versions := map[string]int{}
+	p, err := Backfill(ctx, cli, "users-group", "users", func(ctx context.Context, item foundations.Record) ([]foundations.UpdateField, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if idOf(item) == 5 {
+			v := item["version"].(*types.AttributeValueMemberN).Value
+			if versions[v]++; v == "1" { // 読み込んだ後で他から更新される
+				if _, err := cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+					TableName:                 aws.String("users"),
+					Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberN{Value: "5"}},
+					UpdateExpression:          aws.String("SET version = :v"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{":v": &types.AttributeValueMemberN{Value: "2"}},
+				}); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return groupOf(ctx, item)
+	}, BackfillSegments(1), BackfillGuard("version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions["1"] != 1 || versions["2"] != 1 {
+		t.Fatalf("expected the item to be read again: %v", versions)
+	}
+	if p.Updated != 9 || p.Conflicts != 0 {
+		t.Fatalf("unexpected progress: %+v", p)
+	}
+	assertBackfilled(t, cli, 10)
+}
+
+func TestBackfillDefaultGuard(t *testing.T) {
+	ctx := context.Background()
+	cli := newBackfillTable(t, 10)
+	var mu sync.Mutex
+	reads := 0
+	p, err := Backfill(ctx, cli, "users-group", "users", func(ctx context.Context, item foundations.Record) ([]foundations.UpdateField, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if idOf(item) == 5 {
+			if reads++; reads == 1 { // 読み込んだ後で他から設定される
+				if _, err := cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+					TableName:                 aws.String("users"),
+					Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberN{Value: "5"}},
+					UpdateExpression:          aws.String("SET #g = :g"),
+					ExpressionAttributeNames:  map[string]string{"#g": "group"},
+					ExpressionAttributeValues: map[string]types.AttributeValue{":g": &types.AttributeValueMemberS{Value: "manual"}},
+				}); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if _, ok := item["group"]; ok { // 設定済みの値は上書きしない
+			return nil, nil
+		}
+		return groupOf(ctx, item)
+	}, BackfillSegments(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 2 || p.Updated != 8 || p.Skipped != 2 {
+		t.Fatalf("unexpected progress: %+v, %d reads", p, reads)
+	}
+	out, err := cli.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("users"),
+		Key:       map[string]types.AttributeValue{"id": &types.AttributeValueMemberN{Value: "5"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := out.Item["group"].(*types.AttributeValueMemberS).Value; v != "manual" {
+		t.Fatalf("expected the concurrent update to be kept, got %s", v)
+	}
+}
+
+func TestBackfillClaims(t *testing.T) {
+	ctx := context.Background()
+	cli := newBackfillTable(t, 1)
+	if err := prepareMigrationTable(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	// 同じ名前で実行された2つのプロセス
+	newBackfill := func(run string) *backfill {
+		return &backfill{api: cli, id: backfillID("users-group"), run: run, table: "users",
+			schema: foundations.KeySchema{Hash: "id"}, f: groupOf, conf: &backfillConfig{segments: 1, lease: time.Second, owner: "same"}}
+	}
+	first, second := newBackfill("first"), newBackfill("second")
+	if _, err := first.start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	token, err := first.claim(ctx, 0, 0, now.Add(-2*time.Second))
+	if err != nil || token == "" {
+		t.Fatalf("expected the segment to be claimed: %v", err)
+	}
+	// 期限が切れていても、このプロセスの他のワーカーのセグメントは取得しない
+	if err = first.work(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	state, err := first.load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := state.Segments["0"]; s.Owner != token || s.Done {
+		t.Fatalf("expected the segment to be left to the worker: %+v", s)
+	}
+	other, err := second.claim(ctx, 0, 0, now)
+	if err != nil || other == "" || other == token {
+		t.Fatalf("expected the segment to be taken over: %q, %v", other, err)
+	}
+	if err = first.renew(ctx, token, 0, expression.UpdateBuilder{}); !errors.Is(err, errLeaseLost) {
+		t.Fatalf("expected the lease to be lost, got %v", err)
+	}
+	first.release(ctx, token, 0)
+	if err = second.renew(ctx, other, 0, expression.UpdateBuilder{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackfillSourceChanged(t *testing.T) {
+	ctx := context.Background()
+	cli := newBackfillTable(t, 10)
+	var mu sync.Mutex
+	reads := 0
+	// 読み込んだ属性から導出した値は、その属性が変わっていれば読み直して導出し直す
+	p, err := Backfill(ctx, cli, "users-version", "users", func(ctx context.Context, item foundations.Record) ([]foundations.UpdateField, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		v := item["version"].(*types.AttributeValueMemberN).Value
+		if idOf(item) == 5 {
+			if reads++; reads == 1 {
+				if _, err := cli.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+					TableName:                 aws.String("users"),
+					Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberN{Value: "5"}},
+					UpdateExpression:          aws.String("SET version = :v"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{":v": &types.AttributeValueMemberN{Value: "2"}},
+				}); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return []foundations.UpdateField{foundations.SetValue("label", "v"+v)}, nil
+	}, BackfillSegments(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 2 || p.Updated != 10 || p.Conflicts != 0 {
+		t.Fatalf("unexpected progress: %+v, %d reads", p, reads)
+	}
+	out, err := cli.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String("users"),
+		Key:       map[string]types.AttributeValue{"id": &types.AttributeValueMemberN{Value: "5"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := out.Item["label"].(*types.AttributeValueMemberS).Value; v != "v2" {
+		t.Fatalf("expected the label of the current version, got %s", v)
+	}
+}
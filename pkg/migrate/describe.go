@@ -0,0 +1,272 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+	"github.com/pkg/errors"
+)
+
+// ErrDroppedSettings is returned by TableSchema.Recreate for a table with the settings that TableSchema does not keep.
+var ErrDroppedSettings = errors.New("settings dropped by recreating the table")
+
+// SettingsClient is implemented by the clients that can describe the settings of a table
+// that are not returned by DescribeTable, e.g. *dynamodb.Client.
+type SettingsClient interface {
+	DescribeContinuousBackups(ctx context.Context, params *dynamodb.DescribeContinuousBackupsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeContinuousBackupsOutput, error)
+	DescribeKinesisStreamingDestination(ctx context.Context, params *dynamodb.DescribeKinesisStreamingDestinationInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeKinesisStreamingDestinationOutput, error)
+	DescribeContributorInsights(ctx context.Context, params *dynamodb.DescribeContributorInsightsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeContributorInsightsOutput, error)
+	GetResourcePolicy(ctx context.Context, params *dynamodb.GetResourcePolicyInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetResourcePolicyOutput, error)
+	ListTagsOfResource(ctx context.Context, params *dynamodb.ListTagsOfResourceInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTagsOfResourceOutput, error)
+}
+
+// The settings that TableSchema does not keep, in ErrDroppedSettings and DropSettings.
+const (
+	SettingStream              = "StreamSpecification"
+	SettingEncryption          = "SSESpecification"
+	SettingDeletionProtection  = "DeletionProtectionEnabled"
+	SettingOnDemandThroughput  = "OnDemandThroughput"
+	SettingReplicas            = "Replicas"
+	SettingPointInTimeRecovery = "PointInTimeRecovery"
+	SettingKinesisDestinations = "KinesisStreamingDestinations"
+	SettingContributorInsights = "ContributorInsights"
+	SettingResourcePolicy      = "ResourcePolicy"
+	SettingTags                = "Tags"
+)
+
+// undescribed SettingsClientでなければ確認できない設定
+var undescribed = []string{SettingPointInTimeRecovery, SettingKinesisDestinations, SettingContributorInsights, SettingResourcePolicy, SettingTags}
+
+// Describe Returns the schema of an existing table, including the secondary indexes and the time to live.
+// The streams, the server-side encryption with KMS, the deletion protection, the on-demand throughput limits of the table
+// and the indexes, the replicas, the point-in-time recovery, the Kinesis streaming destinations, the contributor insights,
+// the resource policy and the tags are not part of the schema, and TableSchema.Recreate refuses to drop them.
+// The settings that DescribeTable does not return are checked only if api is a SettingsClient,
+// and are otherwise regarded as dropped.
+func Describe(ctx context.Context, api MigrationApi, table string) (*TableSchema, error) {
+	out, err := api.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, errors.WithStack(foundations.Classify(table, err))
+	}
+	desc := out.Table
+	t := &TableSchema{
+		TableName: table,
+		Keys:      keysOf(desc.KeySchema),
+	}
+	for _, v := range desc.AttributeDefinitions {
+		t.Attributes = append(t.Attributes, Attribute{Name: aws.ToString(v.AttributeName), Type: v.AttributeType})
+	}
+	if desc.BillingModeSummary != nil {
+		t.BillingMode = desc.BillingModeSummary.BillingMode
+	}
+	if t.BillingMode != types.BillingModePayPerRequest {
+		t.Throughput = throughputOf(desc.ProvisionedThroughput)
+		if t.Throughput.Read > 0 {
+			t.BillingMode = types.BillingModeProvisioned
+		}
+	}
+	if desc.TableClassSummary != nil {
+		t.TableClass = desc.TableClassSummary.TableClass
+	}
+	for _, v := range desc.GlobalSecondaryIndexes {
+		index := SecondaryIndex{Name: aws.ToString(v.IndexName), Keys: keysOf(v.KeySchema), Projection: projectionOf(v.Projection)}
+		if t.BillingMode == types.BillingModeProvisioned {
+			tp := throughputOf(v.ProvisionedThroughput)
+			index.Throughput = &tp
+		}
+		t.GlobalSecondaryIndex = append(t.GlobalSecondaryIndex, index)
+	}
+	for _, v := range desc.LocalSecondaryIndexes {
+		t.LocalSecondaryIndex = append(t.LocalSecondaryIndex, SecondaryIndex{Name: aws.ToString(v.IndexName), Keys: keysOf(v.KeySchema), Projection: projectionOf(v.Projection)})
+	}
+	if t.dropped, err = droppedSettings(ctx, api, desc); err != nil {
+		return nil, err
+	}
+	ttl, err := api.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, errors.WithStack(foundations.Classify(table, err))
+	}
+	if d := ttl.TimeToLiveDescription; d != nil && d.AttributeName != nil {
+		switch d.TimeToLiveStatus {
+		case types.TimeToLiveStatusEnabled, types.TimeToLiveStatusEnabling:
+			t.TimeToLive = &TimeToLiveSpecification{AttributeName: aws.ToString(d.AttributeName), Enabled: true}
+		}
+	}
+	return t, nil
+}
+
+// droppedSettings スキーマに含まれず、作り直すと失われる設定を返す
+func droppedSettings(ctx context.Context, api MigrationApi, desc *types.TableDescription) ([]string, error) {
+	var dropped []string
+	if v := desc.StreamSpecification; v != nil && aws.ToBool(v.StreamEnabled) {
+		dropped = append(dropped, SettingStream)
+	}
+	if v := desc.SSEDescription; v != nil && v.Status != types.SSEStatusDisabled && v.Status != types.SSEStatusDisabling {
+		dropped = append(dropped, SettingEncryption)
+	}
+	if aws.ToBool(desc.DeletionProtectionEnabled) {
+		dropped = append(dropped, SettingDeletionProtection)
+	}
+	limited := onDemandLimited(desc.OnDemandThroughput)
+	for _, v := range desc.GlobalSecondaryIndexes {
+		limited = limited || onDemandLimited(v.OnDemandThroughput)
+	}
+	if limited {
+		dropped = append(dropped, SettingOnDemandThroughput)
+	}
+	if len(desc.Replicas) > 0 {
+		dropped = append(dropped, SettingReplicas)
+	}
+	c, ok := api.(SettingsClient)
+	if !ok {
+		return append(dropped, undescribed...), nil
+	}
+	more, err := describeSettings(ctx, c, desc)
+	if err != nil {
+		return nil, errors.WithStack(foundations.Classify(aws.ToString(desc.TableName), err))
+	}
+	return append(dropped, more...), nil
+}
+
+func onDemandLimited(v *types.OnDemandThroughput) bool {
+	return v != nil && (aws.ToInt64(v.MaxReadRequestUnits) > 0 || aws.ToInt64(v.MaxWriteRequestUnits) > 0)
+}
+
+// describeSettings DescribeTableで返されない設定を確認する
+func describeSettings(ctx context.Context, c SettingsClient, desc *types.TableDescription) ([]string, error) {
+	var dropped []string
+	table := desc.TableName
+	backups, err := c.DescribeContinuousBackups(ctx, &dynamodb.DescribeContinuousBackupsInput{TableName: table})
+	if err != nil {
+		return nil, err
+	}
+	if d := backups.ContinuousBackupsDescription; d != nil && d.PointInTimeRecoveryDescription != nil &&
+		d.PointInTimeRecoveryDescription.PointInTimeRecoveryStatus == types.PointInTimeRecoveryStatusEnabled {
+		dropped = append(dropped, SettingPointInTimeRecovery)
+	}
+	kinesis, err := c.DescribeKinesisStreamingDestination(ctx, &dynamodb.DescribeKinesisStreamingDestinationInput{TableName: table})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range kinesis.KinesisDataStreamDestinations {
+		if v.DestinationStatus != types.DestinationStatusDisabled && v.DestinationStatus != types.DestinationStatusDisabling {
+			dropped = append(dropped, SettingKinesisDestinations)
+			break
+		}
+	}
+	indexes := []*string{nil}
+	for _, v := range desc.GlobalSecondaryIndexes {
+		indexes = append(indexes, v.IndexName)
+	}
+	for _, index := range indexes {
+		insights, err := c.DescribeContributorInsights(ctx, &dynamodb.DescribeContributorInsightsInput{TableName: table, IndexName: index})
+		if err != nil {
+			return nil, err
+		}
+		if insights.ContributorInsightsStatus != types.ContributorInsightsStatusDisabled && insights.ContributorInsightsStatus != "" {
+			dropped = append(dropped, SettingContributorInsights)
+			break
+		}
+	}
+	var notFound *types.PolicyNotFoundException
+	if _, err = c.GetResourcePolicy(ctx, &dynamodb.GetResourcePolicyInput{ResourceArn: desc.TableArn}); err == nil {
+		dropped = append(dropped, SettingResourcePolicy)
+	} else if !errors.As(err, &notFound) {
+		return nil, err
+	}
+	tags, err := c.ListTagsOfResource(ctx, &dynamodb.ListTagsOfResourceInput{ResourceArn: desc.TableArn})
+	if err != nil {
+		return nil, err
+	}
+	if len(tags.Tags) > 0 {
+		dropped = append(dropped, SettingTags)
+	}
+	return dropped, nil
+}
+
+func keysOf(elements []types.KeySchemaElement) Keys {
+	keys := make(Keys, 0, len(elements))
+	for _, e := range elements {
+		keys = append(keys, KeySchema{Name: aws.ToString(e.AttributeName), Type: e.KeyType})
+	}
+	return keys
+}
+
+func throughputOf(desc *types.ProvisionedThroughputDescription) ProvisionedThroughput {
+	if desc == nil {
+		return ProvisionedThroughput{}
+	}
+	return ProvisionedThroughput{Read: aws.ToInt64(desc.ReadCapacityUnits), Write: aws.ToInt64(desc.WriteCapacityUnits)}
+}
+
+func projectionOf(p *types.Projection) *Projection {
+	if p == nil {
+		return nil
+	}
+	return &Projection{Type: p.ProjectionType, AttributeNames: p.NonKeyAttributes}
+}
+
+type recreateConfig struct {
+	drop map[string]bool
+}
+
+type RecreateOption func(c *recreateConfig)
+
+// DropSettings Recreates the table even if it has the settings of names, e.g. SettingTags, which are lost.
+func DropSettings(names ...string) RecreateOption {
+	return func(c *recreateConfig) {
+		for _, name := range names {
+			c.drop[name] = true
+		}
+	}
+}
+
+// Recreate Deletes the table and creates it again with the schema, which removes all the items at once.
+// It waits at most maxWait for each of the deletion and the creation.
+// It is destructive to the settings that are not part of the schema, such as the streams and the tags,
+// and returns ErrDroppedSettings without deleting the table if Describe found them, unless they are given to DropSettings.
+func (t TableSchema) Recreate(ctx context.Context, api MigrationApi, maxWait time.Duration, opt ...RecreateOption) error {
+	name := t.tableNamePrefix + t.TableName
+	conf := &recreateConfig{drop: map[string]bool{}}
+	for _, o := range opt {
+		o(conf)
+	}
+	var dropped []string
+	for _, v := range t.dropped {
+		if !conf.drop[v] {
+			dropped = append(dropped, v)
+		}
+	}
+	if len(dropped) > 0 {
+		return errors.Wrapf(ErrDroppedSettings, "%s: %s", name, strings.Join(dropped, ", "))
+	}
+	if _, err := t.Delete(ctx, api); err != nil {
+		return err
+	}
+	if err := dynamodb.NewTableNotExistsWaiter(api).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)}, maxWait); err != nil {
+		return errors.WithStack(err)
+	}
+	// テーブルが作成されるまでTTLは設定できない
+	ttl := t.TimeToLive
+	t.TimeToLive = nil
+	if _, err := t.Create(ctx, api); err != nil {
+		return err
+	}
+	if err := dynamodb.NewTableExistsWaiter(api).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)}, maxWait); err != nil {
+		return errors.WithStack(err)
+	}
+	if ttl != nil && ttl.Enabled {
+		if _, err := api.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+			TableName:               aws.String(name),
+			TimeToLiveSpecification: ttl.Element(),
+		}); err != nil {
+			return errors.WithStack(foundations.Classify(name, err))
+		}
+	}
+	return nil
+}
@@ -5,11 +5,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
 	"github.com/goccha/logging/log"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
@@ -127,11 +129,9 @@ type Migration struct {
 	ID string `json:"id" yaml:"id" dynamodbav:"id"`
 }
 
-//var ErrNotFound *types.ResourceNotFoundException
-
+// IsNotFound Reports whether the table does not exist.
 func IsNotFound(err error) bool {
-	var notFound *types.ResourceNotFoundException
-	return errors.As(err, &notFound)
+	return foundations.IsTableNotFound(err)
 }
 
 const MigrationTable = "dynamo_migrations"
@@ -158,6 +158,22 @@ func createMigrationTable(ctx context.Context, api MigrationApi) error {
 	return nil
 }
 
+// prepareMigrationTable MigrationTableが存在しない場合は作成して有効になるまで待つ
+func prepareMigrationTable(ctx context.Context, api MigrationApi) error {
+	if _, err := api.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(MigrationTable)}); err != nil {
+		if !IsNotFound(err) {
+			return err
+		}
+		if err = createMigrationTable(ctx, api); err != nil {
+			return err
+		}
+		if err = dynamodb.NewTableExistsWaiter(api).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(MigrationTable)}, time.Minute); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
 func migrated(ctx context.Context, api MigrationApi, name string) (bool, error) {
 	out, err := api.GetItem(ctx, &dynamodb.GetItemInput{
 		Key: map[string]types.AttributeValue{
@@ -192,14 +208,8 @@ func (v *FilesMigrate) read(path string, file os.DirEntry) (schemas []Schema, er
 }
 
 func (v *FilesMigrate) migrate(ctx context.Context, api MigrationApi, path string, file os.DirEntry, save SaveFunc) error {
-	if _, err := api.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(MigrationTable)}); err != nil {
-		if IsNotFound(err) { // テーブルが存在しない場合
-			if err = createMigrationTable(ctx, api); err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
+	if err := prepareMigrationTable(ctx, api); err != nil {
+		return err
 	}
 	out, err := api.GetItem(ctx, &dynamodb.GetItemInput{
 		Key: map[string]types.AttributeValue{
@@ -6,6 +6,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
 	"github.com/pkg/errors"
 )
 
@@ -20,6 +21,8 @@ type TableSchema struct {
 	TableClass           types.TableClass         `json:"TableClass" yaml:"TableClass"`
 	TimeToLive           *TimeToLiveSpecification `json:"TimeToLiveSpecification,omitempty" yaml:"TimeToLiveSpecification,omitempty"`
 	tableNamePrefix      string
+	// dropped Describeで見つかった、作り直すと失われる設定
+	dropped []string
 }
 
 func (t TableSchema) billingMode() types.BillingMode {
@@ -38,11 +41,16 @@ func (t TableSchema) Exists(ctx context.Context, api MigrationApi) (out *dynamod
 		if IsNotFound(err) {
 			return nil, nil
 		}
-		return nil, errors.WithStack(err) // テーブルが存在しない以外のエラー
+		return nil, errors.WithStack(foundations.Classify(t.tableNamePrefix+t.TableName, err)) // テーブルが存在しない以外のエラー
 	}
 	return out, nil
 }
 
+// RegisterKeys Registers the key schema of the table to r with the name without the prefix.
+func (t TableSchema) RegisterKeys(r *foundations.KeyRegistry) {
+	r.Register(t.TableName, foundations.KeySchemaFrom(t.Keys.Elements()))
+}
+
 func (t TableSchema) Create(ctx context.Context, api MigrationApi) (out *dynamodb.CreateTableOutput, err error) {
 	attrs := t.Attributes.Definitions()
 	keys := t.Keys.Elements()
@@ -69,7 +77,7 @@ func (t TableSchema) Create(ctx context.Context, api MigrationApi) (out *dynamod
 		Tags:                   nil, // TODO
 	}
 	if out, err = api.CreateTable(ctx, input); err != nil {
-		return nil, errors.WithStack(err)
+		return nil, errors.WithStack(foundations.Classify(t.tableNamePrefix+t.TableName, err))
 	}
 	if t.TimeToLive != nil {
 		if _, err = api.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
@@ -99,7 +107,7 @@ func (t TableSchema) Update(ctx context.Context, api MigrationApi, desc types.Ta
 		in.TableClass = t.TableClass
 	}
 	if out, err = api.UpdateTable(ctx, in); err != nil {
-		return nil, errors.WithStack(err)
+		return nil, errors.WithStack(foundations.Classify(t.tableNamePrefix+t.TableName, err))
 	}
 	if t.TimeToLive != nil {
 		var ttl *dynamodb.DescribeTimeToLiveOutput
@@ -128,7 +136,7 @@ func (t TableSchema) Update(ctx context.Context, api MigrationApi, desc types.Ta
 
 func (t TableSchema) Delete(ctx context.Context, api MigrationApi) (out *dynamodb.DeleteTableOutput, err error) {
 	if out, err = api.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(t.tableNamePrefix + t.TableName)}); err != nil {
-		return nil, errors.WithStack(err)
+		return nil, errors.WithStack(foundations.Classify(t.tableNamePrefix+t.TableName, err))
 	}
 	return
 }
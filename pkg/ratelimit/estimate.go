@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"math"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	writeUnitSize = 1024
+)
+
+// estimate Returns the units of the request per table and index before it is sent.
+// Reads are estimated as one item of 4KB and corrected with ConsumedCapacity after the request.
+func estimate(input any) map[key]Units {
+	units := map[key]Units{}
+	add := func(table, index *string, u Units) {
+		k := key{table: aws.ToString(table), index: aws.ToString(index)}
+		v := units[k]
+		v.Read += u.Read
+		v.Write += u.Write
+		units[k] = v
+	}
+	switch in := input.(type) {
+	case *dynamodb.GetItemInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		add(in.TableName, nil, Units{Read: readUnits(in.ConsistentRead)})
+	case *dynamodb.QueryInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		add(in.TableName, in.IndexName, Units{Read: readUnits(in.ConsistentRead)})
+	case *dynamodb.ScanInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		add(in.TableName, in.IndexName, Units{Read: readUnits(in.ConsistentRead)})
+	case *dynamodb.PutItemInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		add(in.TableName, nil, Units{Write: writeUnits(itemSize(in.Item))})
+	case *dynamodb.UpdateItemInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		add(in.TableName, nil, Units{Write: writeUnits(itemSize(in.Key) + itemSize(in.ExpressionAttributeValues))})
+	case *dynamodb.DeleteItemInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		add(in.TableName, nil, Units{Write: 1})
+	case *dynamodb.BatchGetItemInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		for table, keys := range in.RequestItems {
+			add(aws.String(table), nil, Units{Read: readUnits(keys.ConsistentRead) * float64(len(keys.Keys))})
+		}
+	case *dynamodb.BatchWriteItemInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		for table, requests := range in.RequestItems {
+			for _, r := range requests {
+				if r.PutRequest != nil {
+					add(aws.String(table), nil, Units{Write: writeUnits(itemSize(r.PutRequest.Item))})
+				} else {
+					add(aws.String(table), nil, Units{Write: 1})
+				}
+			}
+		}
+	case *dynamodb.TransactGetItemsInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		for _, item := range in.TransactItems {
+			if item.Get != nil {
+				add(item.Get.TableName, nil, Units{Read: 2})
+			}
+		}
+	case *dynamodb.TransactWriteItemsInput:
+		in.ReturnConsumedCapacity = requested(in.ReturnConsumedCapacity)
+		// トランザクションは通常の2倍の容量を消費する
+		for _, item := range in.TransactItems {
+			switch {
+			case item.Put != nil:
+				add(item.Put.TableName, nil, Units{Write: 2 * writeUnits(itemSize(item.Put.Item))})
+			case item.Update != nil:
+				add(item.Update.TableName, nil, Units{Write: 2 * writeUnits(itemSize(item.Update.Key)+itemSize(item.Update.ExpressionAttributeValues))})
+			case item.Delete != nil:
+				add(item.Delete.TableName, nil, Units{Write: 2})
+			case item.ConditionCheck != nil:
+				add(item.ConditionCheck.TableName, nil, Units{Read: 2})
+			}
+		}
+	}
+	return units
+}
+
+func requested(v types.ReturnConsumedCapacity) types.ReturnConsumedCapacity {
+	if v == "" {
+		return types.ReturnConsumedCapacityIndexes
+	}
+	return v
+}
+
+func readUnits(consistent *bool) float64 {
+	if aws.ToBool(consistent) {
+		return 1
+	}
+	return 0.5
+}
+
+func writeUnits(size int) float64 {
+	return math.Max(1, math.Ceil(float64(size)/writeUnitSize))
+}
+
+func itemSize(item map[string]types.AttributeValue) int {
+	size := 0
+	for k, v := range item {
+		size += len(k) + valueSize(v)
+	}
+	return size
+}
+
+func valueSize(v types.AttributeValue) int {
+	switch val := v.(type) {
+	case *types.AttributeValueMemberS:
+		return len(val.Value)
+	case *types.AttributeValueMemberN:
+		return (len(val.Value)+1)/2 + 1
+	case *types.AttributeValueMemberB:
+		return len(val.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range val.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, s := range val.Value {
+			size += (len(s)+1)/2 + 1
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, b := range val.Value {
+			size += len(b)
+		}
+		return size
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, e := range val.Value {
+			size += 1 + valueSize(e)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		return 3 + len(val.Value) + itemSize(val.Value)
+	}
+	return 0
+}
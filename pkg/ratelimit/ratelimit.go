@@ -0,0 +1,224 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/capacity"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+// Limit is the capacity units per second of a table or an index.
+// Zero units are not limited. Burst is the units that can be consumed at once, one second of the units if it is zero.
+type Limit struct {
+	Table      string
+	Index      string
+	ReadUnits  float64
+	WriteUnits float64
+	Burst      float64
+}
+
+// Table Returns the limit of a table.
+func Table(name string, readUnits, writeUnits float64) Limit {
+	return Limit{Table: name, ReadUnits: readUnits, WriteUnits: writeUnits}
+}
+
+// Index Returns the limit of a global secondary index.
+func Index(table, index string, readUnits, writeUnits float64) Limit {
+	return Limit{Table: table, Index: index, ReadUnits: readUnits, WriteUnits: writeUnits}
+}
+
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate, burst float64, now time.Time) *bucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return &bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// take 消費した分を差し引いて不足分を補うまでの待ち時間を返す
+func (b *bucket) take(units float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	b.tokens = math.Min(b.burst, b.tokens-units)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type buckets struct {
+	read  *bucket
+	write *bucket
+}
+
+type key struct {
+	table string
+	index string
+}
+
+// Limiter meters the read and write capacity units per table and index with token buckets.
+// The units of a request are estimated before it is sent and corrected with ConsumedCapacity after,
+// so requests wait while the consumed units exceed the limits. It is safe for concurrent use and is
+// shared by the goroutines of batches.MultiProcessor through DB.Client.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[key]*buckets
+	indexes map[string][]*buckets
+	now     func() time.Time
+}
+
+// New Returns a Limiter. Table names are the physical names the requests are sent with.
+func New(limits ...Limit) *Limiter {
+	l := &Limiter{
+		buckets: map[key]*buckets{},
+		indexes: map[string][]*buckets{},
+		now:     time.Now,
+	}
+	now := l.now()
+	for _, v := range limits {
+		b := &buckets{
+			read:  newBucket(v.ReadUnits, v.Burst, now),
+			write: newBucket(v.WriteUnits, v.Burst, now),
+		}
+		l.buckets[key{table: v.Table, index: v.Index}] = b
+		if v.Index != "" {
+			l.indexes[v.Table] = append(l.indexes[v.Table], b)
+		}
+	}
+	return l
+}
+
+// Units is the capacity units of a table or an index.
+type Units struct {
+	Read  float64
+	Write float64
+}
+
+// Wait Takes units of the table and waits until they are available.
+// Writes also wait while the indexes of the table have consumed more than their limits.
+func (l *Limiter) Wait(ctx context.Context, table, index string, units Units) error {
+	return l.wait(ctx, map[key]Units{{table: table, index: index}: units})
+}
+
+func (l *Limiter) wait(ctx context.Context, units map[key]Units) error {
+	delay := l.reserve(units)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve 全てのバケットから取り出して最も長い待ち時間を返す
+func (l *Limiter) reserve(units map[key]Units) (delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for k, u := range units {
+		if b, ok := l.buckets[k]; ok {
+			delay = max(delay, b.read.take(u.Read, now), b.write.take(u.Write, now))
+		}
+		if k.index == "" && u.Write > 0 {
+			for _, b := range l.indexes[k.table] {
+				delay = max(delay, b.write.take(0, now))
+			}
+		}
+	}
+	return delay
+}
+
+// Consume Takes units of the table or the index without waiting. Negative units return the units taken in excess.
+func (l *Limiter) Consume(table, index string, units Units) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key{table: table, index: index}]; ok {
+		now := l.now()
+		b.read.take(units.Read, now)
+		b.write.take(units.Write, now)
+	}
+}
+
+type estimateKey struct{}
+
+// Interceptor Returns an interceptor that waits for the capacity of every request of DB.Client.
+// It requests ReturnConsumedCapacity INDEXES if the request does not set it, to correct the estimates with the consumed units.
+func (l *Limiter) Interceptor() foundations.Interceptor {
+	return foundations.InterceptorFuncs{
+		Before: func(ctx context.Context, operation string, input any) (context.Context, error) {
+			estimates := estimate(input)
+			if len(estimates) == 0 {
+				return ctx, nil
+			}
+			if err := l.wait(ctx, estimates); err != nil {
+				return ctx, err
+			}
+			return context.WithValue(ctx, estimateKey{}, estimates), nil
+		},
+		After: func(ctx context.Context, operation string, input, output any, err error, duration time.Duration) {
+			estimates, ok := ctx.Value(estimateKey{}).(map[key]Units)
+			if !ok || err != nil {
+				return
+			}
+			consumed, isRead := capacity.Consumed(output)
+			l.correct(estimates, consumed, isRead)
+		},
+	}
+}
+
+// correct 見積もりと実際の消費量の差を反映する
+func (l *Limiter) correct(estimates map[key]Units, consumed []types.ConsumedCapacity, read bool) {
+	if len(consumed) == 0 {
+		return
+	}
+	for _, c := range consumed {
+		table := aws.ToString(c.TableName)
+		actual := unitsOf(c.CapacityUnits, c.ReadCapacityUnits, c.WriteCapacityUnits, read)
+		if c.Table != nil {
+			actual = unitsOf(c.Table.CapacityUnits, c.Table.ReadCapacityUnits, c.Table.WriteCapacityUnits, read)
+		}
+		est := estimates[key{table: table}]
+		l.Consume(table, "", Units{Read: actual.Read - est.Read, Write: actual.Write - est.Write})
+		for _, indexes := range []map[string]types.Capacity{c.GlobalSecondaryIndexes, c.LocalSecondaryIndexes} {
+			for index, v := range indexes {
+				k := key{table: table, index: index}
+				actual := unitsOf(v.CapacityUnits, v.ReadCapacityUnits, v.WriteCapacityUnits, read)
+				est := estimates[k]
+				l.Consume(table, index, Units{Read: actual.Read - est.Read, Write: actual.Write - est.Write})
+			}
+		}
+	}
+}
+
+func unitsOf(total, read, write *float64, isRead bool) Units {
+	r, w := capacity.Split(total, read, write, isRead)
+	return Units{Read: r, Write: w}
+}
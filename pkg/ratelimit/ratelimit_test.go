@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/batches"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+type Order struct {
+	ID     string `dynamodbav:"id" dynamodbkey:"hash"`
+	Status string `dynamodbav:"status" dynamodbindex:"status-index"`
+}
+
+func TestLimiter(t *testing.T) {
+	l := New(Table("orders", 10, 5), Index("orders", "status-index", 0, 2))
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	take := func(table, index string, units Units) time.Duration {
+		return l.reserve(map[key]Units{{table: table, index: index}: units})
+	}
+	if d := take("orders", "", Units{Read: 10}); d != 0 {
+		t.Fatalf("expected the burst, got %v", d)
+	}
+	if d := take("orders", "", Units{Read: 5}); d != 500*time.Millisecond {
+		t.Fatalf("unexpected delay: %v", d)
+	}
+	now = now.Add(time.Second)
+	if d := take("orders", "", Units{Read: 5}); d != 0 {
+		t.Fatalf("expected the refilled units, got %v", d)
+	}
+	// インデックスの超過分は書き込みを待たせる
+	l.correct(map[key]Units{{table: "orders"}: {Write: 1}}, []types.ConsumedCapacity{{
+		TableName:              aws.String("orders"),
+		Table:                  &types.Capacity{CapacityUnits: aws.Float64(1)},
+		GlobalSecondaryIndexes: map[string]types.Capacity{"status-index": {CapacityUnits: aws.Float64(4)}},
+	}}, false)
+	if d := take("orders", "", Units{Write: 1}); d != time.Second {
+		t.Fatalf("unexpected delay: %v", d)
+	}
+	if d := take("unknown", "", Units{Write: 100}); d != 0 {
+		t.Fatalf("expected no limit, got %v", d)
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("orders"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	l := New(Table("orders", 0, 400))
+	db := foundations.NewDB(cli, foundations.Interceptors(l.Interceptor()))
+	repo, err := foundations.NewRepository[Order]("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := make([]Order, 600)
+	for i := range orders {
+		orders[i] = Order{ID: fmt.Sprintf("o%d", i), Status: "open"}
+	}
+	start := time.Now()
+	if err = batches.PutAll(ctx, db.Client(), repo, orders); err != nil {
+		t.Fatal(err)
+	}
+	// 400WCUのバーストの後、残りの200WCUは0.5秒かかる
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("expected the writes to be limited, took %v", d)
+	}
+}
@@ -24,9 +24,17 @@ func (builder *GetBuilder) HasError() bool {
 }
 
 func Get(keys ...foundations.GetItemFunc) *GetBuilder {
+	return GetWithRegistry(foundations.DefaultKeyRegistry, keys...)
+}
+
+// GetWithRegistry Derives the keys of the items with the key schemas of r in place of foundations.DefaultKeyRegistry.
+func GetWithRegistry(r *foundations.KeyRegistry, keys ...foundations.GetItemFunc) *GetBuilder {
 	items := make([]types.TransactGetItem, 0, MaxGetItems)
 	for _, k := range keys {
 		table, key, expr, err := k()
+		if err == nil {
+			key, err = r.KeyOrItem(table, key)
+		}
 		if err != nil {
 			return &GetBuilder{
 				err: err,
@@ -67,8 +75,12 @@ func get(ctx context.Context, cli Client, items []types.TransactGetItem, fetch f
 	if len(items) > MaxGetItems {
 		return nil, fmt.Errorf("transaction size is within %d items", MaxGetItems)
 	}
-	if out, err = cli.TransactGetItems(ctx, &dynamodb.TransactGetItemsInput{TransactItems: items}); err != nil {
-		return nil, errors.WithStack(err)
+	err = foundations.RetryPolicyFrom(ctx).Do(ctx, func(ctx context.Context) (err error) {
+		out, err = cli.TransactGetItems(ctx, &dynamodb.TransactGetItemsInput{TransactItems: items})
+		return err
+	})
+	if err != nil {
+		return nil, errors.WithStack(foundations.Classify("", err))
 	}
 	for i, v := range out.Responses { // each of which corresponds to the TransactGetItem object in the same position in the TransactItems array
 		if err = fetch(*items[i].Get.TableName, v.Item); err != nil {
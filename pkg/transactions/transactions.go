@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/goccha/dynamodb-verse/pkg/foundations"
 	"github.com/goccha/dynamodb-verse/pkg/foundations/options"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -35,34 +36,55 @@ func Limit(limit int) options.Option {
 	}
 }
 
+// KeyRegistry Derives the keys of the deleted and updated items with the key schemas of r in place of foundations.DefaultKeyRegistry.
+func KeyRegistry(r *foundations.KeyRegistry) options.Option {
+	return func(input any) any {
+		if v, ok := input.(*Builder); ok {
+			v.keys = r
+		}
+		return input
+	}
+}
+
+// RetryPolicy Retries the transactions of the builder with p in place of the policy of the context.
+func RetryPolicy(p *foundations.RetryPolicy) options.Option {
+	return func(input any) any {
+		if v, ok := input.(*Builder); ok {
+			v.retry = p
+		}
+		return input
+	}
+}
+
 type Transaction interface {
-	PutItem(ctx context.Context, expiredAt ...time.Time) foundations.WriteItemFunc
-	DeleteItem(ctx context.Context) foundations.WriteItemFunc
-	UpdateItem(ctx context.Context, fields ...foundations.UpdateField) foundations.WriteItemFunc
+	PutItem(ctx context.Context, expiredAt ...time.Time) foundations.VersionedWriteItemFunc
+	DeleteItem(ctx context.Context) foundations.VersionedWriteItemFunc
+	UpdateItem(ctx context.Context, fields ...foundations.UpdateField) foundations.VersionedWriteItemFunc
 }
 
 type transactionItem interface {
-	apply(opt ...options.Option) (res types.TransactWriteItem, err error)
+	apply(opt ...options.Option) (res types.TransactWriteItem, check *foundations.VersionCheck, err error)
 }
 
 type putItem struct {
-	item *types.Put
+	item  *types.Put
+	check *foundations.VersionCheck
 }
 
-func (p *putItem) apply(opt ...options.Option) (res types.TransactWriteItem, err error) {
+func (p *putItem) apply(opt ...options.Option) (res types.TransactWriteItem, check *foundations.VersionCheck, err error) {
 	return types.TransactWriteItem{
 		Put: p.item,
-	}, nil
+	}, p.check, nil
 }
 
 type delayedPutItem struct {
-	key foundations.WriteItemFunc
+	key foundations.WriteItem
 }
 
-func (p *delayedPutItem) apply(opt ...options.Option) (res types.TransactWriteItem, err error) {
-	table, item, expr, err := p.key()
+func (p *delayedPutItem) apply(opt ...options.Option) (res types.TransactWriteItem, check *foundations.VersionCheck, err error) {
+	table, item, expr, version, err := p.key.WriteItem()
 	if err != nil {
-		return res, err
+		return res, nil, err
 	}
 	input := &types.Put{
 		TableName:                 aws.String(table),
@@ -71,32 +93,39 @@ func (p *delayedPutItem) apply(opt ...options.Option) (res types.TransactWriteIt
 		ExpressionAttributeValues: expr.Values(),
 		ConditionExpression:       expr.Condition(),
 	}
+	check = foundations.VersionCheckOf(table, version, item)
+	input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 	for _, f := range opt {
 		input = f(input).(*types.Put)
 	}
 	return types.TransactWriteItem{
 		Put: input,
-	}, nil
+	}, check, nil
 }
 
 type deleteItem struct {
-	item *types.Delete
+	item  *types.Delete
+	check *foundations.VersionCheck
 }
 
-func (p *deleteItem) apply(opt ...options.Option) (res types.TransactWriteItem, err error) {
+func (p *deleteItem) apply(opt ...options.Option) (res types.TransactWriteItem, check *foundations.VersionCheck, err error) {
 	return types.TransactWriteItem{
 		Delete: p.item,
-	}, nil
+	}, p.check, nil
 }
 
 type delayedDeleteItem struct {
-	key foundations.WriteItemFunc
+	key  foundations.WriteItem
+	keys *foundations.KeyRegistry
 }
 
-func (p *delayedDeleteItem) apply(opt ...options.Option) (res types.TransactWriteItem, err error) {
-	table, item, expr, err := p.key()
+func (p *delayedDeleteItem) apply(opt ...options.Option) (res types.TransactWriteItem, check *foundations.VersionCheck, err error) {
+	table, item, expr, version, err := p.key.WriteItem()
 	if err != nil {
-		return res, err
+		return res, nil, err
+	}
+	if item, err = p.keys.KeyOrItem(table, item); err != nil {
+		return res, nil, err
 	}
 	input := &types.Delete{
 		TableName:                 aws.String(table),
@@ -105,32 +134,39 @@ func (p *delayedDeleteItem) apply(opt ...options.Option) (res types.TransactWrit
 		ExpressionAttributeValues: expr.Values(),
 		ConditionExpression:       expr.Condition(),
 	}
+	check = foundations.VersionCheckOf(table, version, item)
+	input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 	for _, f := range opt {
 		input = f(input).(*types.Delete)
 	}
 	return types.TransactWriteItem{
 		Delete: input,
-	}, nil
+	}, check, nil
 }
 
 type updateItem struct {
-	item *types.Update
+	item  *types.Update
+	check *foundations.VersionCheck
 }
 
-func (p *updateItem) apply(opt ...options.Option) (res types.TransactWriteItem, err error) {
+func (p *updateItem) apply(opt ...options.Option) (res types.TransactWriteItem, check *foundations.VersionCheck, err error) {
 	return types.TransactWriteItem{
 		Update: p.item,
-	}, nil
+	}, p.check, nil
 }
 
 type delayedUpdateItem struct {
-	key foundations.WriteItemFunc
+	key  foundations.WriteItem
+	keys *foundations.KeyRegistry
 }
 
-func (p *delayedUpdateItem) apply(opt ...options.Option) (res types.TransactWriteItem, err error) {
-	table, item, expr, err := p.key()
+func (p *delayedUpdateItem) apply(opt ...options.Option) (res types.TransactWriteItem, check *foundations.VersionCheck, err error) {
+	table, item, expr, version, err := p.key.WriteItem()
 	if err != nil {
-		return res, err
+		return res, nil, err
+	}
+	if item, err = p.keys.KeyOrItem(table, item); err != nil {
+		return res, nil, err
 	}
 	input := &types.Update{
 		Key:                       item,
@@ -140,12 +176,14 @@ func (p *delayedUpdateItem) apply(opt ...options.Option) (res types.TransactWrit
 		ExpressionAttributeNames:  expr.Names(),
 		ConditionExpression:       expr.Condition(),
 	}
+	check = foundations.VersionCheckOf(table, version, item)
+	input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 	for _, f := range opt {
 		input = f(input).(*types.Update)
 	}
 	return types.TransactWriteItem{
 		Update: input,
-	}, nil
+	}, check, nil
 }
 
 type Monitor func(items []types.TransactWriteItem, err error)
@@ -155,6 +193,7 @@ func New(opt ...options.Option) *Builder {
 		items: make([]transactionItem, 0, MaxItems),
 		opt:   opt,
 		limit: MaxItems,
+		keys:  foundations.DefaultKeyRegistry,
 	}
 	for _, o := range opt {
 		o(b)
@@ -169,6 +208,8 @@ type Builder struct {
 	monitor  Monitor
 	failSafe bool
 	limit    int
+	retry    *foundations.RetryPolicy
+	keys     *foundations.KeyRegistry
 }
 
 func (builder *Builder) Monitor(monitor Monitor) *Builder {
@@ -187,7 +228,7 @@ func (builder *Builder) HasError() bool {
 }
 
 // Put 追加用
-func (builder *Builder) Put(keys ...foundations.WriteItemFunc) *Builder {
+func (builder *Builder) Put(keys ...foundations.WriteItem) *Builder {
 	if builder.err != nil {
 		return builder
 	}
@@ -195,7 +236,7 @@ func (builder *Builder) Put(keys ...foundations.WriteItemFunc) *Builder {
 		builder.items = make([]transactionItem, 0, builder.limit)
 	}
 	for _, k := range keys {
-		if table, item, expr, err := k(); err != nil {
+		if table, item, expr, version, err := k.WriteItem(); err != nil {
 			builder.err = err
 			return builder
 		} else {
@@ -206,16 +247,18 @@ func (builder *Builder) Put(keys ...foundations.WriteItemFunc) *Builder {
 				ExpressionAttributeValues: expr.Values(),
 				ConditionExpression:       expr.Condition(),
 			}
+			check := foundations.VersionCheckOf(table, version, item)
+			input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 			for _, f := range builder.opt {
 				input = f(input).(*types.Put)
 			}
-			builder.items = append(builder.items, &putItem{item: input})
+			builder.items = append(builder.items, &putItem{item: input, check: check})
 		}
 	}
 	return builder
 }
 
-func (builder *Builder) DelayedPut(keys ...foundations.WriteItemFunc) *Builder {
+func (builder *Builder) DelayedPut(keys ...foundations.WriteItem) *Builder {
 	if builder.err != nil {
 		return builder
 	}
@@ -229,7 +272,7 @@ func (builder *Builder) DelayedPut(keys ...foundations.WriteItemFunc) *Builder {
 }
 
 // Delete 削除用
-func (builder *Builder) Delete(keys ...foundations.WriteItemFunc) *Builder {
+func (builder *Builder) Delete(keys ...foundations.WriteItem) *Builder {
 	if builder.err != nil {
 		return builder
 	}
@@ -237,7 +280,10 @@ func (builder *Builder) Delete(keys ...foundations.WriteItemFunc) *Builder {
 		builder.items = make([]transactionItem, 0, builder.limit)
 	}
 	for _, k := range keys {
-		if table, item, expr, err := k(); err != nil {
+		if table, item, expr, version, err := k.WriteItem(); err != nil {
+			builder.err = err
+			return builder
+		} else if item, err = builder.keys.KeyOrItem(table, item); err != nil {
 			builder.err = err
 			return builder
 		} else {
@@ -248,17 +294,19 @@ func (builder *Builder) Delete(keys ...foundations.WriteItemFunc) *Builder {
 				ExpressionAttributeValues: expr.Values(),
 				ConditionExpression:       expr.Condition(),
 			}
+			check := foundations.VersionCheckOf(table, version, item)
+			input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 			for _, f := range builder.opt {
 				input = f(input).(*types.Delete)
 			}
-			builder.items = append(builder.items, &deleteItem{item: input})
+			builder.items = append(builder.items, &deleteItem{item: input, check: check})
 		}
 
 	}
 	return builder
 }
 
-func (builder *Builder) DelayedDelete(keys ...foundations.WriteItemFunc) *Builder {
+func (builder *Builder) DelayedDelete(keys ...foundations.WriteItem) *Builder {
 	if builder.err != nil {
 		return builder
 	}
@@ -266,13 +314,13 @@ func (builder *Builder) DelayedDelete(keys ...foundations.WriteItemFunc) *Builde
 		builder.items = make([]transactionItem, 0, builder.limit)
 	}
 	for _, k := range keys {
-		builder.items = append(builder.items, &delayedDeleteItem{key: k})
+		builder.items = append(builder.items, &delayedDeleteItem{key: k, keys: builder.keys})
 	}
 	return builder
 }
 
 // Update 更新用
-func (builder *Builder) Update(keys ...foundations.WriteItemFunc) *Builder {
+func (builder *Builder) Update(keys ...foundations.WriteItem) *Builder {
 	if builder.err != nil {
 		return builder
 	}
@@ -280,7 +328,10 @@ func (builder *Builder) Update(keys ...foundations.WriteItemFunc) *Builder {
 		builder.items = make([]transactionItem, 0, builder.limit)
 	}
 	for _, k := range keys {
-		if table, item, expr, err := k(); err != nil {
+		if table, item, expr, version, err := k.WriteItem(); err != nil {
+			builder.err = err
+			return builder
+		} else if item, err = builder.keys.KeyOrItem(table, item); err != nil {
 			builder.err = err
 			return builder
 		} else {
@@ -292,16 +343,18 @@ func (builder *Builder) Update(keys ...foundations.WriteItemFunc) *Builder {
 				ExpressionAttributeNames:  expr.Names(),
 				ConditionExpression:       expr.Condition(),
 			}
+			check := foundations.VersionCheckOf(table, version, item)
+			input.ReturnValuesOnConditionCheckFailure = check.ReturnValues()
 			for _, f := range builder.opt {
 				input = f(input).(*types.Update)
 			}
-			builder.items = append(builder.items, &updateItem{item: input})
+			builder.items = append(builder.items, &updateItem{item: input, check: check})
 		}
 	}
 	return builder
 }
 
-func (builder *Builder) DelayedUpdate(keys ...foundations.WriteItemFunc) *Builder {
+func (builder *Builder) DelayedUpdate(keys ...foundations.WriteItem) *Builder {
 	if builder.err != nil {
 		return builder
 	}
@@ -309,7 +362,7 @@ func (builder *Builder) DelayedUpdate(keys ...foundations.WriteItemFunc) *Builde
 		builder.items = make([]transactionItem, 0, builder.limit)
 	}
 	for _, k := range keys {
-		builder.items = append(builder.items, &delayedUpdateItem{key: k})
+		builder.items = append(builder.items, &delayedUpdateItem{key: k, keys: builder.keys})
 	}
 	return builder
 }
@@ -344,21 +397,54 @@ func (builder *Builder) run(ctx context.Context, cli Client, items []transaction
 		return nil, fmt.Errorf("transaction size is within %d items", builder.limit)
 	}
 	applies := make([]types.TransactWriteItem, 0, len(items))
+	checks := make([]*foundations.VersionCheck, 0, len(items))
 	for _, v := range items {
 		var item types.TransactWriteItem
-		if item, err = v.apply(opt...); err != nil {
+		var check *foundations.VersionCheck
+		if item, check, err = v.apply(opt...); err != nil {
 			return nil, err
 		}
 		applies = append(applies, item)
+		checks = append(checks, check)
+	}
+	p := builder.retry
+	if p == nil {
+		p = foundations.RetryPolicyFrom(ctx)
 	}
-	if out, err = cli.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: applies}); err != nil {
+	// 同じトークンで再試行すれば、適用済みのトランザクションは二重に適用されない
+	input := &dynamodb.TransactWriteItemsInput{TransactItems: applies, ClientRequestToken: aws.String(uuid.NewString())}
+	err = p.Do(ctx, func(ctx context.Context) (err error) {
+		out, err = cli.TransactWriteItems(ctx, input)
+		return err
+	})
+	if err != nil {
 		builder.monitoring(applies, err)
-		return nil, errors.WithStack(err)
+		if conflict := versionConflict(checks, err); conflict != nil {
+			return nil, errors.WithStack(conflict)
+		}
+		return nil, errors.WithStack(foundations.Classify("", err))
 	}
 	builder.monitoring(applies, nil)
 	return
 }
 
+// versionConflict Returns a VersionConflictError if the transaction was canceled by the version condition of an item.
+func versionConflict(checks []*foundations.VersionCheck, err error) *foundations.VersionConflictError {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return nil
+	}
+	for i, reason := range canceled.CancellationReasons {
+		if i >= len(checks) || aws.ToString(reason.Code) != "ConditionalCheckFailed" {
+			continue
+		}
+		if conflict := checks[i].Conflict(reason.Item, err); conflict != nil {
+			return conflict
+		}
+	}
+	return nil
+}
+
 type Client interface {
 	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
 	TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error)
@@ -397,37 +483,37 @@ func From(ctx context.Context) (*Context, bool) {
 	return t, ok
 }
 
-func Put(ctx context.Context, keys ...foundations.WriteItemFunc) {
+func Put(ctx context.Context, keys ...foundations.WriteItem) {
 	if t, ok := From(ctx); ok {
 		t.Put(keys...)
 	}
 }
 
-func DelayedPut(ctx context.Context, keys ...foundations.WriteItemFunc) {
+func DelayedPut(ctx context.Context, keys ...foundations.WriteItem) {
 	if t, ok := From(ctx); ok {
 		t.DelayedPut(keys...)
 	}
 }
 
-func Update(ctx context.Context, keys ...foundations.WriteItemFunc) {
+func Update(ctx context.Context, keys ...foundations.WriteItem) {
 	if t, ok := From(ctx); ok {
 		t.Update(keys...)
 	}
 }
 
-func DelayedUpdate(ctx context.Context, keys ...foundations.WriteItemFunc) {
+func DelayedUpdate(ctx context.Context, keys ...foundations.WriteItem) {
 	if t, ok := From(ctx); ok {
 		t.DelayedUpdate(keys...)
 	}
 }
 
-func Delete(ctx context.Context, keys ...foundations.WriteItemFunc) {
+func Delete(ctx context.Context, keys ...foundations.WriteItem) {
 	if t, ok := From(ctx); ok {
 		t.Delete(keys...)
 	}
 }
 
-func DelayedDelete(ctx context.Context, keys ...foundations.WriteItemFunc) {
+func DelayedDelete(ctx context.Context, keys ...foundations.WriteItem) {
 	if t, ok := From(ctx); ok {
 		t.DelayedDelete(keys...)
 	}
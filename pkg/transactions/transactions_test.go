@@ -0,0 +1,114 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/goccha/dynamodb-verse/pkg/dynamodbfake"
+	"github.com/goccha/dynamodb-verse/pkg/foundations"
+)
+
+type Account struct {
+	ID        string `dynamodbav:"id" dynamodbkey:"hash"`
+	Balance   int    `dynamodbav:"balance"`
+	UpdateCnt int    `dynamodbav:"update_cnt" dynamodbversion:"true"`
+}
+
+func TestVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("accounts"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := foundations.NewRepository[Account]("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1, a2 := &Account{ID: "a1", Balance: 100}, &Account{ID: "a2"}
+	if _, err = New().Put(repo.PutItem(ctx, a1), repo.PutItem(ctx, a2)).Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	// a1 is stale because its version was not incremented
+	_, err = New().
+		Update(repo.UpdateItem(ctx, a1, foundations.AddValue("balance", -10))).
+		Update(repo.UpdateItem(ctx, a2, foundations.AddValue("balance", 10))).
+		Run(ctx, cli)
+	if !errors.Is(err, foundations.ErrVersionConflict) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+	var conflict *foundations.VersionConflictError
+	if !errors.As(err, &conflict) || conflict.Item == nil {
+		t.Fatalf("expected the current item, got %v", err)
+	}
+	a1.UpdateCnt, a2.UpdateCnt = 1, 1
+	if _, err = New().
+		Update(repo.UpdateItem(ctx, a1, foundations.AddValue("balance", -10))).
+		DelayedUpdate(repo.UpdateItem(ctx, a2, foundations.AddValue("balance", 10))).
+		Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	v, err := repo.Get(ctx, cli, repo.KeyOf("a2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Balance != 10 || v.UpdateCnt != 2 {
+		t.Fatalf("unexpected account: %+v", v)
+	}
+}
+
+func TestKeyRegistry(t *testing.T) {
+	ctx := context.Background()
+	cli := dynamodbfake.New()
+	if _, err := cli.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String("accounts"),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r := foundations.NewKeyRegistry()
+	if err := foundations.RegisterKeys[Account](r, "accounts"); err != nil {
+		t.Fatal(err)
+	}
+	items := func(ids ...string) []foundations.WriteItem {
+		list := make([]foundations.WriteItem, 0, len(ids))
+		for _, id := range ids {
+			list = append(list, foundations.PutItem(ctx, "accounts", map[string]any{"id": id, "balance": 10}))
+		}
+		return list
+	}
+	if _, err := New().Put(items("a1", "a2", "a3")...).Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	// アイテム全体からレジストリのキースキーマでキーを取り出す
+	count := 0
+	if _, err := GetWithRegistry(r, func() (string, map[string]types.AttributeValue, expression.Expression, error) {
+		return "accounts", map[string]types.AttributeValue{
+			"id":      &types.AttributeValueMemberS{Value: "a1"},
+			"balance": &types.AttributeValueMemberN{Value: "10"},
+		}, expression.Expression{}, nil
+	}).Run(ctx, cli, func(tableName string, value foundations.Record) error {
+		count++
+		return nil
+	}); err != nil || count != 1 {
+		t.Fatalf("expected the item, got %d, %v", count, err)
+	}
+	deletes := items("a1", "a2")
+	if _, err := New(KeyRegistry(r)).Delete(deletes[0]).DelayedDelete(deletes[1]).Run(ctx, cli); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New().Delete(items("a3")...).Run(ctx, cli); err == nil {
+		t.Fatal("expected the non-key attributes to be rejected without the registry")
+	}
+}